@@ -15,6 +15,7 @@ import (
 	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -116,6 +117,59 @@ func BenchmarkCodeMarshal(b *testing.B) {
 	b.SetBytes(int64(len(codeJSON)))
 }
 
+// BenchmarkCodeMarshalPool compares parallel Marshal calls with and
+// without reusing pooled encodeStates.
+func BenchmarkCodeMarshalPool(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := Marshal(&codeStruct); err != nil {
+					b.Fatal("Marshal:", err)
+				}
+			}
+		})
+		b.SetBytes(int64(len(codeJSON)))
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				e := &encodeState{ptrSeen: make(map[interface{}]struct{})}
+				if err := defaultJSON.marshal(e, &codeStruct, defaultJSON.encOpts()); err != nil {
+					b.Fatal("Marshal:", err)
+				}
+				_ = append([]byte(nil), e.Bytes()...)
+			}
+		})
+		b.SetBytes(int64(len(codeJSON)))
+	})
+}
+
+func BenchmarkCodeMarshalAppend(b *testing.B) {
+	b.ReportAllocs()
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		var buf []byte
+		for pb.Next() {
+			var err error
+			if buf, err = MarshalAppend(buf[:0], &codeStruct); err != nil {
+				b.Fatal("MarshalAppend:", err)
+			}
+		}
+	})
+	b.SetBytes(int64(len(codeJSON)))
+}
+
 func benchMarshalBytes(n int) func(*testing.B) {
 	sample := []byte("hello world")
 	// Use a struct pointer, to avoid an allocation when passing it as an
@@ -209,6 +263,51 @@ func BenchmarkDecoderStream(b *testing.B) {
 	}
 }
 
+// readCounter counts the number of Read calls made on r.
+type readCounter struct {
+	r     io.Reader
+	reads int
+}
+
+func (rc *readCounter) Read(p []byte) (int, error) {
+	rc.reads++
+	return rc.r.Read(p)
+}
+
+func BenchmarkDecoderBufferSize(b *testing.B) {
+	var buf bytes.Buffer
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&buf, `{"id":%d,"name":"item %[1]d","tags":["a","b","c"]}`+"\n", i)
+	}
+	data := buf.Bytes()
+	for _, size := range []int{0, 4096, 65536} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			c := DecoderBufferSize(size)
+			reads := 0
+			for i := 0; i < b.N; i++ {
+				rc := &readCounter{r: bytes.NewReader(data)}
+				dec := c.NewDecoder(rc)
+				for {
+					var v struct {
+						ID   int
+						Name string
+						Tags []string
+					}
+					if err := dec.Decode(&v); err == io.EOF {
+						break
+					} else if err != nil {
+						b.Fatal("Decode:", err)
+					}
+				}
+				reads += rc.reads
+			}
+			b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+		})
+	}
+}
+
 func BenchmarkCodeUnmarshal(b *testing.B) {
 	b.ReportAllocs()
 	if codeJSON == nil {
@@ -245,6 +344,45 @@ func BenchmarkCodeUnmarshalReuse(b *testing.B) {
 	b.SetBytes(int64(len(codeJSON)))
 }
 
+func BenchmarkUnmarshalRawMessageSlice(b *testing.B) {
+	if codeJSON == nil {
+		b.StopTimer()
+		codeInit()
+		b.StartTimer()
+	}
+	// An array of the children of the code.json tree.
+	var tree struct {
+		Tree struct{ Kids []json.RawMessage }
+	}
+	if err := Unmarshal(codeJSON, &tree); err != nil {
+		b.Fatal("Unmarshal:", err)
+	}
+	data, err := Marshal(tree.Tree.Kids)
+	if err != nil {
+		b.Fatal("Marshal:", err)
+	}
+	b.Run("RawMessage", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var v []json.RawMessage
+			if err := Unmarshal(data, &v); err != nil {
+				b.Fatal("Unmarshal:", err)
+			}
+		}
+		b.SetBytes(int64(len(data)))
+	})
+	b.Run("interface", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var v []interface{}
+			if err := Unmarshal(data, &v); err != nil {
+				b.Fatal("Unmarshal:", err)
+			}
+		}
+		b.SetBytes(int64(len(data)))
+	})
+}
+
 func BenchmarkUnmarshalString(b *testing.B) {
 	b.ReportAllocs()
 	data := []byte(`"hello, world"`)
@@ -0,0 +1,178 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Canonical causes the encoder to produce the canonical form of the output
+// defined by RFC 8785, the JSON Canonicalization Scheme (JCS), which is
+// suitable for hashing and signing: object members, including struct fields,
+// are sorted by their keys compared as UTF-16 code units, numbers are
+// formatted like in JavaScript after being converted to float64 values,
+// and strings only escape the characters that must be escaped.
+// There is no space between the tokens.
+//
+// Duplicate object keys and numbers that don't fit a float64 are errors.
+// Canonicalization is applied to the output of the other encoding options,
+// such as OmitEmpty, except Indent, which makes the output non-canonical
+// and should not be used together with it.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) Canonical() *JSON {
+	j2 := *j
+	j2.canonical = true
+	return &j2
+}
+
+// Canonical causes the encoder to produce the canonical form of the output
+// defined by RFC 8785.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func Canonical() *JSON {
+	return defaultJSON.Canonical()
+}
+
+// canonicalTreeJSON is used to decode the intermediate representation
+// of canonicalized values, preserving numbers exactly.
+// Like treeJSON, it has its own type registry.
+var canonicalTreeJSON = New().UseNumber().DisallowDuplicateKeys()
+
+// canonicalize replaces the value encoded in e from offset start
+// with its canonical form.
+func (c *JSON) canonicalize(e *encodeState, start int) {
+	var tree interface{}
+	if err := canonicalTreeJSON.Unmarshal(e.Bytes()[start:], &tree); err != nil {
+		e.error(err)
+	}
+	b, err := appendCanonical(nil, tree)
+	if err != nil {
+		e.error(err)
+	}
+	e.Truncate(start)
+	e.Write(b)
+}
+
+// appendCanonical appends the canonical encoding of v, which is a value
+// decoded by canonicalTreeJSON, to b.
+func appendCanonical(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, "null"...), nil
+	case bool:
+		return strconv.AppendBool(b, v), nil
+	case string:
+		return appendCanonicalString(b, v), nil
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return b, &json.UnsupportedValueError{Value: reflect.ValueOf(v), Str: string(v)}
+		}
+		return appendCanonicalNumber(b, f), nil
+	case []interface{}:
+		b = append(b, '[')
+		for i, elem := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			var err error
+			if b, err = appendCanonical(b, elem); err != nil {
+				return b, err
+			}
+		}
+		return append(b, ']'), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return utf16Less(keys[i], keys[j]) })
+		b = append(b, '{')
+		for i, k := range keys {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendCanonicalString(b, k)
+			b = append(b, ':')
+			var err error
+			if b, err = appendCanonical(b, v[k]); err != nil {
+				return b, err
+			}
+		}
+		return append(b, '}'), nil
+	}
+	return b, &json.UnsupportedTypeError{Type: reflect.TypeOf(v)}
+}
+
+// utf16Less reports whether a sorts before b when they are compared
+// as sequences of UTF-16 code units.
+func utf16Less(a, b string) bool {
+	ua := utf16.Encode([]rune(a))
+	ub := utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// appendCanonicalNumber appends f formatted as by the ECMAScript
+// Number.prototype.toString method, which is what RFC 8785 requires.
+// f must be finite.
+func appendCanonicalNumber(b []byte, f float64) []byte {
+	if f == 0 {
+		// Including negative zero.
+		return append(b, '0')
+	}
+	fmt := byte('f')
+	if abs := math.Abs(f); abs < 1e-6 || abs >= 1e21 {
+		fmt = 'e'
+	}
+	start := len(b)
+	b = strconv.AppendFloat(b, f, fmt, -1, 64)
+	if fmt == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n-start >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+// appendCanonicalString appends s as a JSON string, escaping only
+// quotation marks, backslashes and control characters, as RFC 8785 requires.
+func appendCanonicalString(b []byte, s string) []byte {
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b = append(b, '\\', c)
+		case '\b':
+			b = append(b, '\\', 'b')
+		case '\f':
+			b = append(b, '\\', 'f')
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		default:
+			if c < ' ' {
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+	return append(b, '"')
+}
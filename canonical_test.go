@@ -0,0 +1,179 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The examples of RFC 8785, Appendix B.
+var canonicalNumberTests = []struct {
+	bits uint64
+	out  string
+}{
+	{0x0000000000000000, "0"},
+	{0x8000000000000000, "0"},
+	{0x0000000000000001, "5e-324"},
+	{0x8000000000000001, "-5e-324"},
+	{0x7fefffffffffffff, "1.7976931348623157e+308"},
+	{0xffefffffffffffff, "-1.7976931348623157e+308"},
+	{0x4340000000000000, "9007199254740992"},
+	{0xc340000000000000, "-9007199254740992"},
+	{0x4430000000000000, "295147905179352830000"},
+	{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+	{0x44b52d02c7e14af6, "1e+23"},
+	{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+	{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+	{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+	{0x444b1ae4d6e2ef50, "1e+21"},
+	{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+	{0x3eb0c6f7a0b5ed8d, "0.000001"},
+	{0x41b3de4355555553, "333333333.3333332"},
+	{0x41b3de4355555554, "333333333.33333325"},
+	{0x41b3de4355555555, "333333333.3333333"},
+	{0x41b3de4355555556, "333333333.3333334"},
+	{0x41b3de4355555557, "333333333.33333343"},
+	{0xbecbf647612f3696, "-0.0000033333333333333333"},
+	{0x43143ff3c1cb0959, "1424953923781206.2"},
+}
+
+func TestCanonicalNumbers(t *testing.T) {
+	for _, tt := range canonicalNumberTests {
+		f := math.Float64frombits(tt.bits)
+		b, err := Canonical().Marshal(f)
+		if err != nil {
+			t.Errorf("%016x: Marshal: %v", tt.bits, err)
+			continue
+		}
+		if string(b) != tt.out {
+			t.Errorf("%016x: have: %s, want: %s", tt.bits, b, tt.out)
+		}
+		// The same value written differently.
+		b, err = Canonical().Marshal(json.Number(strings.ToUpper(string(b))))
+		if err != nil {
+			t.Errorf("%016x: Marshal Number: %v", tt.bits, err)
+		} else if string(b) != tt.out {
+			t.Errorf("%016x: Number: have: %s, want: %s", tt.bits, b, tt.out)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{
+			// RFC 8785, section 3.2.2.
+			name: "example",
+			in: `{
+  "numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+  "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+  "literals": [null, true, false]
+}`,
+			out: `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			// RFC 8785, section 3.2.3.
+			name: "sorting",
+			in: `{
+  "\u20ac": "Euro Sign",
+  "\r": "Carriage Return",
+  "\ufb33": "Hebrew Letter Dalet With Dagesh",
+  "1": "One",
+  "\ud83d\ude00": "Emoji: Grinning Face",
+  "\u0080": "Control",
+  "\u00f6": "Latin Small Letter O With Diaeresis"
+}`,
+			out: "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"ö\":\"Latin Small Letter O With Diaeresis\"," +
+				"\"€\":\"Euro Sign\",\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{
+			name: "escapes",
+			in:   `["<&>\u2028\b\f\u001f\u007f", {"b": {"d": [], "c": {}}, "a": -0.0}]`,
+			out:  "[\"<&>\u2028\\b\\f\\u001f\u007f\",{\"a\":0,\"b\":{\"c\":{},\"d\":[]}}]",
+		},
+	}
+	for _, tt := range tests {
+		b, err := Canonical().Marshal(json.RawMessage(tt.in))
+		if err != nil {
+			t.Errorf("%s: Marshal: %v", tt.name, err)
+			continue
+		}
+		if string(b) != tt.out {
+			t.Errorf("%s:\nhave: %s\nwant: %s", tt.name, b, tt.out)
+		}
+	}
+}
+
+func TestCanonicalStruct(t *testing.T) {
+	type Inner struct {
+		Z int     `json:"z"`
+		Y float64 `json:"y,omitempty"`
+	}
+	type T struct {
+		Name  string            `json:"name"`
+		Inner Inner             `json:"inner"`
+		Tags  map[string]string `json:"tags"`
+		Big   int64             `json:"big"`
+	}
+	v := T{Name: "a<b", Inner: Inner{Z: 1}, Tags: map[string]string{"y": "1", "x": "2"}, Big: 1e17}
+	b, err := Canonical().Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected := `{"big":100000000000000000,"inner":{"z":1},"name":"a<b","tags":{"x":"2","y":"1"}}`
+	if string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	var sb strings.Builder
+	if err := Canonical().NewEncoder(&sb).Encode(v); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if sb.String() != expected+"\n" {
+		t.Errorf("Encode: have: %s, want: %s", sb.String(), expected)
+	}
+
+	for _, v := range []interface{}{
+		json.RawMessage(`{"a":1,"a":2}`),
+		json.Number("1e400"),
+		math.NaN(),
+	} {
+		if b, err := Canonical().Marshal(v); err == nil {
+			t.Errorf("%v: expected error, have: %s", v, b)
+		}
+	}
+}
+
+func TestCanonicalDiscriminator(t *testing.T) {
+	type Cat struct {
+		Kind string `json:"canonicalKind"`
+	}
+	// Shares the default registry, like TestRegisterDiscriminator.
+	UseNumber().RegisterDiscriminator("canonicalKind", map[string]reflect.Type{
+		"cat": reflect.TypeOf(Cat{}),
+	})
+	b, err := New().Canonical().Marshal(map[string]interface{}{
+		"pet": json.RawMessage(`{"canonicalKind":"cat","b":1}`),
+	})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"pet":{"b":1,"canonicalKind":"cat"}}`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	if _, err := appendCanonical(nil, Cat{}); err == nil {
+		t.Error("appendCanonical: expected error for unexpected type")
+	} else if _, ok := err.(*json.UnsupportedTypeError); !ok {
+		t.Errorf("appendCanonical: have %T, want *json.UnsupportedTypeError", err)
+	}
+}
@@ -8,13 +8,21 @@
 package jsonx
 
 import (
+	"bytes"
+	"context"
 	"encoding"
 	"encoding/base64"
+	hexenc "encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 	"unicode"
 	"unicode/utf16"
 	"unicode/utf8"
@@ -36,16 +44,29 @@ import (
 //
 // To unmarshal JSON into a value implementing the Unmarshaler interface,
 // Unmarshal calls that value's UnmarshalJSON method, including
-// when the input is a JSON null.
+// when the input is a JSON null. If the value implements OptionsUnmarshaler,
+// Unmarshal calls its UnmarshalJSONx method instead, passing the decoding options.
 // Otherwise, if the value implements encoding.TextUnmarshaler
 // and the input is a JSON quoted string, Unmarshal calls that value's
 // UnmarshalText method with the unquoted form of the string.
+// Once a value implementing the Validator interface has been decoded,
+// Unmarshal calls its Validate method and fails with a ValidationError
+// wrapping any error it returns.
 //
 // To unmarshal JSON into a struct, Unmarshal matches incoming object
 // keys to the keys used by Marshal (either the struct field name or its tag),
 // preferring an exact match but also accepting a case-insensitive match. By
 // default, object keys which don't have a corresponding struct field are
 // ignored (see Decoder.DisallowUnknownFields for an alternative).
+// If a field has the "required" tag option, as in `json:"name,required"`,
+// an object without a matching key is an error naming the field.
+// A JSON null counts as present.
+// If a field has the "default" tag option, as in `json:"port,default=8080"`,
+// an object without a matching key stores the default in the field,
+// replacing any existing value. The default is decoded as a JSON literal,
+// or as the contents of a JSON string if the field has string kind
+// or implements encoding.TextUnmarshaler. If the default is not valid
+// for the field, Unmarshal returns an InvalidDefaultTagError.
 //
 // To unmarshal JSON into an interface value,
 // Unmarshal stores one of these in the interface value:
@@ -95,13 +116,53 @@ import (
 // character U+FFFD.
 //
 func (c *JSON) Unmarshal(data []byte, v interface{}) error {
+	return c.unmarshal(nil, data, v)
+}
+
+// Unmarshal parses the JSON-encoded data and stores the result
+// in the value pointed to by v using the default JSON decoder.
+func Unmarshal(data []byte, v interface{}) error {
+	return defaultJSON.Unmarshal(data, v)
+}
+
+// UnmarshalContext is like Unmarshal, but aborts the decoding and returns
+// ctx.Err() if ctx is cancelled before it finishes.
+// The context is checked before each value is decoded, except for
+// values nested inside an interface{}, which are decoded in one go.
+// If decoding is aborted, v may have been partially filled.
+func (c *JSON) UnmarshalContext(ctx context.Context, data []byte, v interface{}) error {
+	return c.unmarshal(ctx, data, v)
+}
+
+// UnmarshalContext is like Unmarshal, but aborts the decoding and returns
+// ctx.Err() if ctx is cancelled before it finishes.
+func UnmarshalContext(ctx context.Context, data []byte, v interface{}) error {
+	return defaultJSON.UnmarshalContext(ctx, data, v)
+}
+
+// unmarshal implements Unmarshal and UnmarshalContext.
+// ctx may be nil.
+func (c *JSON) unmarshal(ctx context.Context, data []byte, v interface{}) error {
 	// Check for well-formedness.
 	// Avoids filling out half a data structure
 	// before discovering a JSON syntax error.
 	var d decodeState
 	d.converter = c
 	d.useNumber = c.useNumber
+	d.numberType = c.numberType
+	d.decimalMode = c.decimalMode
 	d.disallowUnknownFields = c.disallowUnknownFields
+	d.caseSensitive = c.caseSensitive
+	d.scalarOrArray = c.scalarOrArray
+	d.coerceScalars = c.coerceScalars
+	d.autoUnquoteNumbers = c.autoUnquoteNumbers
+	d.lenientNumbers = c.lenientNumbers
+	d.strictFloat32 = c.strictFloat32
+	d.disallowDuplicateKeys = c.disallowDuplicateKeys
+	d.mergeDecode = c.mergeDecode
+	d.replaceDecode = c.replaceDecode
+	d.ctx = ctx
+	c.initScanner(&d.scan)
 	err := checkValid(data, &d.scan)
 	if err != nil {
 		return err
@@ -111,10 +172,75 @@ func (c *JSON) Unmarshal(data []byte, v interface{}) error {
 	return d.unmarshal(v)
 }
 
-// Unmarshal parses the JSON-encoded data and stores the result
-// in the value pointed to by v using the default JSON decoder.
-func Unmarshal(data []byte, v interface{}) error {
-	return defaultJSON.Unmarshal(data, v)
+// initScanner sets the limits and syntax extensions of c on s.
+func (c *JSON) initScanner(s *scanner) {
+	s.maxDepth = c.maxDepth
+	s.maxStringLen = c.maxStringLen
+	s.maxObjectKeys = c.maxObjectKeys
+	s.allowTrailingCommas = c.allowTrailingCommas
+	s.allowComments = c.allowComments
+	s.allowSingleQuotes = c.allowSingleQuotes
+	s.allowUnquotedKeys = c.allowUnquotedKeys
+	s.allowExtendedNumbers = c.allowExtendedNumbers
+}
+
+// UnmarshalNext decodes the first JSON value in data, which may be followed
+// by more values, and stores the result in the value pointed to by v.
+// It returns the bytes following the value, so that a sequence of
+// concatenated values can be decoded without a Decoder:
+//
+//	for {
+//		rest, err = j.UnmarshalNext(rest, &v)
+//		if err == io.EOF {
+//			break
+//		}
+//		...
+//	}
+//
+// If data contains nothing but white space (and comments, if AllowComments is set),
+// UnmarshalNext returns io.EOF. If the first value is not valid JSON,
+// it returns a syntax error and data unchanged. Otherwise, it returns the rest
+// of data even if decoding the value fails, as Unmarshal would.
+func (c *JSON) UnmarshalNext(data []byte, v interface{}) (rest []byte, err error) {
+	n, err := c.valueEnd(data)
+	if err != nil {
+		return data, err
+	}
+	return data[n:], c.unmarshal(nil, data[:n], v)
+}
+
+// UnmarshalNext decodes the first JSON value in data using the default JSON decoder,
+// and returns the bytes following it.
+func UnmarshalNext(data []byte, v interface{}) (rest []byte, err error) {
+	return defaultJSON.UnmarshalNext(data, v)
+}
+
+// valueEnd returns the offset in data just past the end of the first JSON value.
+func (c *JSON) valueEnd(data []byte) (int, error) {
+	var scan scanner
+	c.initScanner(&scan)
+	scan.reset()
+	for i, b := range data {
+		scan.bytes++
+		switch scan.step(&scan, b) {
+		case scanEnd:
+			// scanEnd is delayed one byte.
+			return i, nil
+		case scanEndObject, scanEndArray:
+			if stateEndValue(&scan, ' ') == scanEnd {
+				return i + 1, nil
+			}
+		case scanError:
+			return 0, scan.err
+		}
+	}
+	if scan.eof() == scanError {
+		if !nonSpace(data) || scan.allowComments && onlyComments(data) {
+			return 0, io.EOF
+		}
+		return 0, scan.err
+	}
+	return len(data), nil
 }
 
 func (d *decodeState) unmarshal(v interface{}) error {
@@ -122,7 +248,16 @@ func (d *decodeState) unmarshal(v interface{}) error {
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return &json.InvalidUnmarshalError{Type: reflect.TypeOf(v)}
 	}
+	if d.needsRewrite() {
+		d.rewriteRelaxed()
+	}
+	if d.converter.flattenSep != "" {
+		if err := d.unflatten(); err != nil {
+			return err
+		}
+	}
 
+	d.allowFields = d.converter.allowFields
 	d.scan.reset()
 	d.scanWhile(scanSkipSpace)
 	// We decode rv not rv.Elem because the Unmarshaler interface
@@ -134,6 +269,85 @@ func (d *decodeState) unmarshal(v interface{}) error {
 	return d.savedError
 }
 
+// A DuplicateKeyError is returned by Unmarshal when DisallowDuplicateKeys is set
+// and an object contains the same key more than once.
+type DuplicateKeyError struct {
+	Key    string // the duplicated key
+	Offset int64  // offset of the second occurrence of the key
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return "json: duplicate key " + strconv.Quote(e.Key) + " at offset " + strconv.FormatInt(e.Offset, 10)
+}
+
+// An InvalidDefaultTagError is returned by Unmarshal when the value
+// of the ",default" struct tag option is not valid for the field:
+// it must be a JSON literal, or any string if the field decodes from one.
+type InvalidDefaultTagError struct {
+	Struct  reflect.Type // the struct type containing the field
+	Field   string       // the Go name of the field
+	Type    reflect.Type // the type of the field
+	Default string       // the value of the default option
+}
+
+func (e *InvalidDefaultTagError) Error() string {
+	return "json: invalid ,default value " + strconv.Quote(e.Default) + " in struct tag on field " + e.Struct.String() + "." + e.Field + " of type " + e.Type.String()
+}
+
+// A LimitError is returned by Unmarshal and Decoder.Decode when the input
+// exceeds a limit set by MaxDepth, MaxStringLen, MaxObjectKeys or MaxInterfaceDepth,
+// and by UnmarshalGzip when the decompressed data exceeds GzipMaxSize.
+type LimitError struct {
+	Limit  string // name of the exceeded limit, e.g. "depth"
+	Max    int    // value of the limit
+	Offset int64  // error occurred after reading Offset bytes
+}
+
+func (e *LimitError) Error() string {
+	return "json: exceeded maximum " + e.Limit + " of " + strconv.Itoa(e.Max) + " at offset " + strconv.FormatInt(e.Offset, 10)
+}
+
+// ErrorOffset returns the input byte offset reported by err,
+// which must be a *SyntaxError, a *json.SyntaxError, a *json.UnmarshalTypeError,
+// a *DuplicateKeyError or a *LimitError, or wrap one of them.
+// The boolean is false if err does not carry an offset.
+func ErrorOffset(err error) (int64, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case *SyntaxError:
+			return e.Offset, true
+		case *json.SyntaxError:
+			return e.Offset, true
+		case *json.UnmarshalTypeError:
+			return e.Offset, true
+		case *DuplicateKeyError:
+			return e.Offset, true
+		case *LimitError:
+			return e.Offset, true
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+	return 0, false
+}
+
+// checkDuplicateKey records key in seen, saving a DuplicateKeyError
+// if it has already been seen. start is the offset of the key.
+// seen is allocated on first use.
+func (d *decodeState) checkDuplicateKey(seen *map[string]struct{}, key string, start int) {
+	if *seen == nil {
+		*seen = make(map[string]struct{})
+	}
+	if _, ok := (*seen)[key]; ok {
+		d.saveError(&DuplicateKeyError{Key: key, Offset: int64(start)})
+		return
+	}
+	(*seen)[key] = struct{}{}
+}
+
 // decodeState represents the state while decoding a JSON value.
 type decodeState struct {
 	data         []byte
@@ -146,8 +360,24 @@ type decodeState struct {
 		FieldStack []string
 	}
 	savedError            error
+	ctx                   context.Context // checked for cancellation, if set
+	orderedObjects        bool            // decode objects in interface values as OrderedMap
 	useNumber             bool
+	numberType            bool
+	decimalMode           bool
 	disallowUnknownFields bool
+	caseSensitive         bool
+	scalarOrArray         bool
+	coerceScalars         bool
+	autoUnquoteNumbers    bool
+	lenientNumbers        bool
+	strictFloat32         bool
+	disallowDuplicateKeys bool
+	mergeDecode           bool
+	stringValues          bool // the next object is a map field with the stringvalues option
+	replaceDecode         bool
+	allowFields           fieldPaths // the allowed paths below the current object, if set
+	interfaceDepth        int        // nesting of the maps and slices being decoded into interface values
 	// safeUnquote is the number of current string literal bytes that don't
 	// need to be unquoted. When negative, no bytes need unquoting.
 	safeUnquote int
@@ -168,6 +398,7 @@ func (d *decodeState) init(data []byte) *decodeState {
 	d.off = 0
 	d.savedError = nil
 	d.errorContext.Struct = nil
+	d.interfaceDepth = 0
 
 	// Reuse the allocated space for the FieldStack slice.
 	d.errorContext.FieldStack = d.errorContext.FieldStack[:0]
@@ -303,6 +534,16 @@ Switch:
 // reads the following byte ahead. If v is invalid, the value is discarded.
 // The first byte of the value has been read already.
 func (d *decodeState) value(v reflect.Value) error {
+	if d.ctx != nil {
+		if err := d.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if v.IsValid() && v.Type() == rawMessageType && v.CanSet() &&
+		atomic.LoadInt32(&d.converter.types.hasDecoders) == 0 {
+		d.rawValue(v)
+		return nil
+	}
 	switch d.opcode {
 	default:
 		panic(phasePanicMsg)
@@ -318,6 +559,11 @@ func (d *decodeState) value(v reflect.Value) error {
 		d.scanNext()
 
 	case scanBeginObject:
+		if v.IsValid() && d.scalarOrArray {
+			if ev, ok := d.singleElement(v, false); ok {
+				v = ev
+			}
+		}
 		if v.IsValid() {
 			if err := d.object(v); err != nil {
 				return err
@@ -332,15 +578,75 @@ func (d *decodeState) value(v reflect.Value) error {
 		start := d.readIndex()
 		d.rescanLiteral()
 
+		if v.IsValid() && d.scalarOrArray && d.data[start] != 'n' {
+			if ev, ok := d.singleElement(v, d.data[start] == '"'); ok {
+				v = ev
+			}
+		}
 		if v.IsValid() {
 			if err := d.literalStore(d.data[start:d.readIndex()], v, false); err != nil {
 				return err
 			}
 		}
 	}
+	if v.IsValid() {
+		d.validate(v)
+	}
 	return nil
 }
 
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// rawValue copies the bytes of the next value into v, which must be
+// a settable json.RawMessage. It has the same result as calling
+// RawMessage.UnmarshalJSON, but skips the value without decoding it
+// and avoids looking up the Unmarshaler for every value.
+func (d *decodeState) rawValue(v reflect.Value) {
+	start := d.readIndex()
+	d.skipValue()
+	v.SetBytes(append(v.Bytes()[0:0], d.data[start:d.readIndex()]...))
+}
+
+// singleElement is used by ScalarOrArray to decode a value that is not an array
+// into a slice. If v is, or points to, a slice that doesn't have its own
+// decoding method, singleElement sets its length to 1 and returns its element.
+// isString reports whether the value is a string, which is decoded into
+// a byte slice as usual.
+func (d *decodeState) singleElement(v reflect.Value, isString bool) (reflect.Value, bool) {
+	if fn, _ := d.typeDecoder(v, false); fn != nil {
+		return reflect.Value{}, false
+	}
+	u, ut, pv := indirect(v, false)
+	if u != nil || ut != nil || pv.Kind() != reflect.Slice {
+		return reflect.Value{}, false
+	}
+	if isString && pv.Type().Elem().Kind() == reflect.Uint8 {
+		return reflect.Value{}, false
+	}
+	if pv.Cap() == 0 {
+		pv.Set(reflect.MakeSlice(pv.Type(), 1, 1))
+	} else {
+		pv.SetLen(1)
+		if d.replaceDecode {
+			pv.Index(0).Set(reflect.Zero(pv.Type().Elem()))
+		}
+	}
+	return pv.Index(0), true
+}
+
+// skipValue skips over the next value without decoding it.
+func (d *decodeState) skipValue() {
+	switch d.opcode {
+	default:
+		panic(phasePanicMsg)
+	case scanBeginArray, scanBeginObject:
+		d.skip()
+		d.scanNext()
+	case scanBeginLiteral:
+		d.rescanLiteral()
+	}
+}
+
 type unquotedValue struct{}
 
 // valueQuoted is like value but decodes a
@@ -368,7 +674,8 @@ func (d *decodeState) valueQuoted() interface{} {
 
 // indirect walks down v allocating pointers as needed,
 // until it gets to a non-pointer.
-// If it encounters an Unmarshaler, indirect stops and returns that.
+// If it encounters an Unmarshaler or OptionsUnmarshaler, indirect stops
+// and returns that.
 // If decodingNull is true, indirect stops at the first settable pointer so it
 // can be set to nil.
 func indirect(v reflect.Value, decodingNull bool) (json.Unmarshaler, encoding.TextUnmarshaler, reflect.Value) {
@@ -424,6 +731,9 @@ func indirect(v reflect.Value, decodingNull bool) (json.Unmarshaler, encoding.Te
 			v.Set(reflect.New(v.Type().Elem()))
 		}
 		if v.Type().NumMethod() > 0 && v.CanInterface() {
+			if u, ok := v.Interface().(OptionsUnmarshaler); ok {
+				return optionsUnmarshaler{u}, nil, reflect.Value{}
+			}
 			if u, ok := v.Interface().(json.Unmarshaler); ok {
 				return u, nil, reflect.Value{}
 			}
@@ -444,15 +754,170 @@ func indirect(v reflect.Value, decodingNull bool) (json.Unmarshaler, encoding.Te
 	return nil, nil, v
 }
 
+// typeDecoder walks down v allocating pointers as needed,
+// until it gets to a value whose type has a decoder registered with
+// RegisterTypeDecoder, and returns the decoder and the address of the value.
+// If decodingNull is true, typeDecoder stops at the first settable pointer
+// that is not itself of a registered type, so that it can be set to nil.
+// If there is no registered decoder, it returns nil.
+func (d *decodeState) typeDecoder(v reflect.Value, decodingNull bool) (func([]byte, interface{}) error, reflect.Value) {
+	types := d.converter.types
+	if atomic.LoadInt32(&types.hasDecoders) == 0 {
+		return nil, reflect.Value{}
+	}
+	var fn interface{}
+	pv := indirectType(v, decodingNull, func(t reflect.Type) bool {
+		f, ok := types.decoders.Load(t)
+		if ok {
+			fn = f
+		}
+		return ok
+	})
+	if !pv.IsValid() {
+		return nil, reflect.Value{}
+	}
+	return fn.(func([]byte, interface{}) error), pv
+}
+
+// discriminatedObject decodes the object starting at d.data[d.off-1]
+// into a new value of the type registered with RegisterDiscriminator
+// for its discriminator field, and returns the value and true.
+// If the object has no registered discriminator, it consumes nothing
+// and returns false.
+func (d *decodeState) discriminatedObject() (reflect.Value, bool, error) {
+	types := d.converter.types
+	if atomic.LoadInt32(&types.hasDiscriminators) == 0 {
+		return reflect.Value{}, false, nil
+	}
+	start := d.readIndex()
+	t := d.discriminatedType(start)
+	if t == nil {
+		return reflect.Value{}, false, nil
+	}
+	d.skip()
+	pv := reflect.New(t)
+	sub := *d
+	sub.scan = scanner{
+		allowTrailingCommas: d.scan.allowTrailingCommas,
+		allowComments:       d.scan.allowComments,
+	}
+	sub.data = d.data[start:d.off]
+	sub.off = 0
+	sub.savedError = nil
+	sub.scan.reset()
+	sub.scanWhile(scanSkipSpace)
+	err := sub.value(pv)
+	if d.savedError == nil {
+		d.savedError = sub.savedError
+	}
+	return pv.Elem(), true, err
+}
+
+// discriminatedType scans the object starting at d.data[start] for a member
+// whose key is a registered discriminator field, and returns the type
+// its value is mapped to, or nil if there is none. It does not modify d.
+func (d *decodeState) discriminatedType(start int) reflect.Type {
+	types := d.converter.types
+	var p decodeState
+	p.data = d.data
+	p.off = start
+	p.scan.allowTrailingCommas = d.scan.allowTrailingCommas
+	p.scan.allowComments = d.scan.allowComments
+	p.scan.reset()
+	p.scanWhile(scanSkipSpace)
+	for {
+		// Read opening " of string key or closing }.
+		p.scanWhile(scanSkipSpace)
+		if p.opcode != scanBeginLiteral {
+			return nil
+		}
+		keyStart := p.readIndex()
+		p.rescanLiteral()
+		key, ok := p.unquote(p.data[keyStart:p.readIndex()])
+		if !ok {
+			return nil
+		}
+		if p.opcode == scanSkipSpace {
+			p.scanWhile(scanSkipSpace)
+		}
+		p.scanWhile(scanSkipSpace)
+		if mapping, ok := types.discriminators.Load(key); ok && p.opcode == scanBeginLiteral && p.data[p.readIndex()] == '"' {
+			valueStart := p.readIndex()
+			p.rescanLiteral()
+			value, ok := p.unquote(p.data[valueStart:p.readIndex()])
+			if !ok {
+				return nil
+			}
+			if t, ok := mapping.(map[string]reflect.Type)[value]; ok {
+				return t
+			}
+		} else {
+			p.skipValue()
+		}
+		if p.opcode == scanSkipSpace {
+			p.scanWhile(scanSkipSpace)
+		}
+		if p.opcode != scanObjectValue {
+			return nil
+		}
+	}
+}
+
+// indirectType walks down v allocating pointers as needed,
+// until it gets to an addressable value whose type satisfies match,
+// and returns a pointer to it.
+// If there is no such value, it returns the zero Value.
+// If decodingNull is true, indirectType stops at the first settable pointer.
+func indirectType(v reflect.Value, decodingNull bool, match func(reflect.Type) bool) reflect.Value {
+	for {
+		if v.CanAddr() && match(v.Type()) {
+			return v.Addr()
+		}
+		if v.Kind() != reflect.Ptr || decodingNull && v.CanSet() {
+			return reflect.Value{}
+		}
+		if v.IsNil() {
+			if !v.CanSet() {
+				return reflect.Value{}
+			}
+			if elem := v.Type().Elem(); elem.Kind() != reflect.Ptr && !match(elem) {
+				// Don't allocate if there is nothing to decode into.
+				return reflect.Value{}
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+}
+
+func isTimeType(t reflect.Type) bool {
+	return t == timeType
+}
+
+func isDurationType(t reflect.Type) bool {
+	return t == durationType
+}
+
+func isBigFloatType(t reflect.Type) bool {
+	return t == bigFloatType
+}
+
 // array consumes an array from d.data[d.off-1:], decoding into v.
 // The first byte of the array ('[') has been read already.
 func (d *decodeState) array(v reflect.Value) error {
+	// Check for registered decoder.
+	if fn, pv := d.typeDecoder(v, false); fn != nil {
+		start := d.readIndex()
+		d.skip()
+		return fn(d.data[start:d.off], pv.Interface())
+	}
+
 	// Check for unmarshaler.
 	u, ut, pv := indirect(v, false)
 	if u != nil {
 		start := d.readIndex()
 		d.skip()
-		return u.UnmarshalJSON(d.data[start:d.off])
+		return d.callUnmarshaler(u, d.data[start:d.off])
 	}
 	if ut != nil {
 		d.saveError(&json.UnmarshalTypeError{Value: "array", Type: v.Type(), Offset: int64(d.off)})
@@ -461,11 +926,20 @@ func (d *decodeState) array(v reflect.Value) error {
 	}
 	v = pv
 
+	if v.Type() == orderedMapType || v.Type() == syncMapType {
+		d.saveError(&json.UnmarshalTypeError{Value: "array", Type: v.Type(), Offset: int64(d.off)})
+		d.skip()
+		return nil
+	}
+
 	// Check type of target.
 	switch v.Kind() {
 	case reflect.Interface:
 		if v.NumMethod() == 0 {
 			// Decoding into nil interface? Switch to non-reflect code.
+			if !d.interfaceAllowed("array", v.Type()) {
+				return nil
+			}
 			ai := d.arrayInterface()
 			v.Set(reflect.ValueOf(ai))
 			return nil
@@ -480,6 +954,10 @@ func (d *decodeState) array(v reflect.Value) error {
 		break
 	}
 
+	if d.replaceDecode && v.Kind() == reflect.Slice {
+		v.SetLen(0)
+	}
+
 	i := 0
 	for {
 		// Look ahead for ] - can only happen on first iteration.
@@ -506,6 +984,9 @@ func (d *decodeState) array(v reflect.Value) error {
 		}
 
 		if i < v.Len() {
+			if d.replaceDecode {
+				v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+			}
 			// Decode into element.
 			if err := d.value(v.Index(i)); err != nil {
 				return err
@@ -553,12 +1034,22 @@ var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem(
 // object consumes an object from d.data[d.off-1:], decoding into v.
 // The first byte ('{') of the object has been read already.
 func (d *decodeState) object(v reflect.Value) error {
+	stringValues := d.stringValues
+	d.stringValues = false
+
+	// Check for registered decoder.
+	if fn, pv := d.typeDecoder(v, false); fn != nil {
+		start := d.readIndex()
+		d.skip()
+		return fn(d.data[start:d.off], pv.Interface())
+	}
+
 	// Check for unmarshaler.
 	u, ut, pv := indirect(v, false)
 	if u != nil {
 		start := d.readIndex()
 		d.skip()
-		return u.UnmarshalJSON(d.data[start:d.off])
+		return d.callUnmarshaler(u, d.data[start:d.off])
 	}
 	if ut != nil {
 		d.saveError(&json.UnmarshalTypeError{Value: "object", Type: v.Type(), Offset: int64(d.off)})
@@ -568,13 +1059,46 @@ func (d *decodeState) object(v reflect.Value) error {
 	v = pv
 	t := v.Type()
 
+	// Merging into a map held by an interface?
+	if d.mergeDecode && v.Kind() == reflect.Interface && !v.IsNil() && v.Elem().Kind() == reflect.Map && !v.Elem().IsNil() {
+		return d.object(v.Elem())
+	}
+
+	// Decoding a discriminated object into an interface?
+	if v.Kind() == reflect.Interface {
+		if dv, ok, err := d.discriminatedObject(); ok {
+			if err != nil {
+				return err
+			}
+			if !dv.Type().AssignableTo(t) {
+				d.saveError(&json.UnmarshalTypeError{Value: "object", Type: t, Offset: int64(d.off)})
+				return nil
+			}
+			v.Set(dv)
+			return nil
+		}
+	}
+
 	// Decoding into nil interface? Switch to non-reflect code.
 	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		if !d.interfaceAllowed("object", t) {
+			return nil
+		}
 		oi := d.objectInterface()
 		v.Set(reflect.ValueOf(oi))
 		return nil
 	}
 
+	if t == orderedMapType {
+		v.Set(reflect.ValueOf(d.orderedMapInterface()))
+		return nil
+	}
+
+	if t == syncMapType {
+		d.syncMapObject(v)
+		return nil
+	}
+
 	var fields structFields
 
 	// Check type of target:
@@ -596,7 +1120,7 @@ func (d *decodeState) object(v reflect.Value) error {
 				return nil
 			}
 		}
-		if v.IsNil() {
+		if v.IsNil() || d.replaceDecode {
 			v.Set(reflect.MakeMap(t))
 		}
 	case reflect.Struct:
@@ -609,7 +1133,14 @@ func (d *decodeState) object(v reflect.Value) error {
 	}
 
 	var mapElem reflect.Value
+	var seenKeys map[string]struct{}
+	var seenChecked []bool
+	if len(fields.checked) > 0 {
+		seenChecked = make([]bool, len(fields.checked))
+	}
 	origErrorContext := d.errorContext
+	allowed := d.allowFields
+	stringValues = stringValues && v.Kind() == reflect.Map
 
 	for {
 		// Read opening " of string key or closing }.
@@ -630,10 +1161,16 @@ func (d *decodeState) object(v reflect.Value) error {
 		if !ok {
 			panic(phasePanicMsg)
 		}
+		if d.disallowDuplicateKeys {
+			d.checkDuplicateKey(&seenKeys, string(key), start)
+		}
 
 		// Figure out field corresponding to key.
 		var subv reflect.Value
-		destring := false // whether the value is wrapped in a string to be decoded first
+		var kv reflect.Value
+		var hookField *field
+		destring := false    // whether the value is wrapped in a string to be decoded first
+		quoteValues := false // whether the values of the map field may be wrapped in strings
 
 		if v.Kind() == reflect.Map {
 			elemType := t.Elem()
@@ -642,13 +1179,48 @@ func (d *decodeState) object(v reflect.Value) error {
 			} else {
 				mapElem.Set(reflect.Zero(elemType))
 			}
+			if d.mergeDecode {
+				// Start from the existing entry, if any.
+				var err error
+				if kv, err = d.mapKey(t.Key(), key, item, start); err != nil {
+					return err
+				}
+				if kv.IsValid() {
+					if ev := v.MapIndex(kv); ev.IsValid() {
+						mapElem.Set(ev)
+					}
+				}
+			}
 			subv = mapElem
 		} else {
 			var f *field
-			if i, ok := fields.nameIndex[string(key)]; ok {
+			if i, ok := fields.nameIndex[string(key)]; ok && (fields.decodeIndex == nil || fields.list[i].tag) {
 				// Found an exact name match.
 				f = &fields.list[i]
-			} else {
+			} else if fields.decodeIndex != nil {
+				// Match the decoded key against the Go field names.
+				if i, ok := fields.decodeIndex[d.converter.keyDecodeFn(string(key))]; ok {
+					f = &fields.list[i]
+				}
+			} else if namer := d.converter.keyNamer; namer != nil {
+				// Match the key against the Go names of untagged fields
+				// and the names of tagged fields. The first matching
+				// field wins; namerIndex finds the untagged one directly.
+				n := len(fields.list)
+				if fields.namerIndex != nil {
+					if i, ok := fields.namerIndex[SnakeCase(string(key))]; ok {
+						n = i
+						f = &fields.list[i]
+					}
+				}
+				for i := 0; i < n; i++ {
+					ff := &fields.list[i]
+					if ff.tag && !d.caseSensitive && ff.equalFold(ff.nameBytes, key) || !ff.tag && fields.namerIndex == nil && namer.Match(string(key), ff.goName) {
+						f = ff
+						break
+					}
+				}
+			} else if !d.caseSensitive {
 				// Fall back to the expensive case-insensitive
 				// linear search.
 				for i := range fields.list {
@@ -659,9 +1231,38 @@ func (d *decodeState) object(v reflect.Value) error {
 					}
 				}
 			}
+			disallowed := false
+			if allowed != nil {
+				name := string(key)
+				if f != nil {
+					name = f.name
+				}
+				sub, ok := allowed[name]
+				if ok {
+					d.allowFields = sub
+				} else {
+					disallowed = true
+					f = nil
+					if d.converter.strictAllowFields {
+						d.saveError(fmt.Errorf("json: disallowed field %q", key))
+					}
+				}
+			}
+			if f != nil && f.badOption(d.converter.strictStringTag) != "" {
+				d.saveError(&InvalidStringTagError{Struct: t, Field: f.goName, Type: f.typ, Option: f.badQuoted})
+			}
+			if f != nil && f.badDefault {
+				d.saveError(&InvalidDefaultTagError{Struct: t, Field: f.goName, Type: f.typ, Default: f.defaultTag})
+			}
 			if f != nil {
+				for i, r := range fields.checked {
+					if f == &fields.list[r] {
+						seenChecked[i] = true
+					}
+				}
 				subv = v
 				destring = f.quoted
+				quoteValues = f.quoteValues
 				for _, i := range f.index {
 					if subv.Kind() == reflect.Ptr {
 						if subv.IsNil() {
@@ -684,9 +1285,12 @@ func (d *decodeState) object(v reflect.Value) error {
 					}
 					subv = subv.Field(i)
 				}
+				if d.converter.decodeFieldHook != nil && subv.IsValid() {
+					hookField = f
+				}
 				d.errorContext.FieldStack = append(d.errorContext.FieldStack, f.name)
 				d.errorContext.Struct = t
-			} else if d.disallowUnknownFields {
+			} else if d.disallowUnknownFields && !disallowed {
 				d.saveError(fmt.Errorf("json: unknown field %q", key))
 			}
 		}
@@ -700,60 +1304,32 @@ func (d *decodeState) object(v reflect.Value) error {
 		}
 		d.scanWhile(scanSkipSpace)
 
-		if destring {
-			switch qv := d.valueQuoted().(type) {
-			case nil:
-				if err := d.literalStore(nullLiteral, subv, false); err != nil {
-					return err
-				}
-			case string:
-				if err := d.literalStore([]byte(qv), subv, true); err != nil {
-					return err
-				}
-			default:
-				d.saveError(fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal unquoted value into %v", subv.Type()))
+		if stringValues && d.data[d.readIndex()] == '"' {
+			// Accept both quoted and unquoted map values.
+			destring = true
+		}
+		if hookField != nil {
+			start := d.readIndex()
+			d.skipValue()
+			raw, err := d.converter.decodeFieldHook(d.converter.fieldInfo(t, hookField), d.data[start:d.readIndex()])
+			if err != nil {
+				return err
 			}
-		} else {
-			if err := d.value(subv); err != nil {
+			if err := d.rawFieldValue(raw, subv, destring, quoteValues); err != nil {
 				return err
 			}
+		} else if err := d.fieldValue(subv, destring, quoteValues); err != nil {
+			return err
 		}
 
 		// Write value back to map;
 		// if using struct, subv points into struct already.
 		if v.Kind() == reflect.Map {
-			kt := t.Key()
-			var kv reflect.Value
-			switch {
-			case reflect.PtrTo(kt).Implements(textUnmarshalerType):
-				kv = reflect.New(kt)
-				if err := d.literalStore(item, kv, true); err != nil {
+			if !d.mergeDecode {
+				var err error
+				if kv, err = d.mapKey(t.Key(), key, item, start); err != nil {
 					return err
 				}
-				kv = kv.Elem()
-			case kt.Kind() == reflect.String:
-				kv = reflect.ValueOf(key).Convert(kt)
-			default:
-				switch kt.Kind() {
-				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-					s := string(key)
-					n, err := strconv.ParseInt(s, 10, 64)
-					if err != nil || reflect.Zero(kt).OverflowInt(n) {
-						d.saveError(&json.UnmarshalTypeError{Value: "number " + s, Type: kt, Offset: int64(start + 1)})
-						break
-					}
-					kv = reflect.ValueOf(n).Convert(kt)
-				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-					s := string(key)
-					n, err := strconv.ParseUint(s, 10, 64)
-					if err != nil || reflect.Zero(kt).OverflowUint(n) {
-						d.saveError(&json.UnmarshalTypeError{Value: "number " + s, Type: kt, Offset: int64(start + 1)})
-						break
-					}
-					kv = reflect.ValueOf(n).Convert(kt)
-				default:
-					panic("json: Unexpected key type") // should never occur
-				}
 			}
 			if kv.IsValid() {
 				v.SetMapIndex(kv, subv)
@@ -769,6 +1345,7 @@ func (d *decodeState) object(v reflect.Value) error {
 		// space and avoid unnecessary allocs.
 		d.errorContext.FieldStack = d.errorContext.FieldStack[:len(origErrorContext.FieldStack)]
 		d.errorContext.Struct = origErrorContext.Struct
+		d.allowFields = allowed
 		if d.opcode == scanEndObject {
 			break
 		}
@@ -776,12 +1353,160 @@ func (d *decodeState) object(v reflect.Value) error {
 			panic(phasePanicMsg)
 		}
 	}
+	for i, r := range fields.checked {
+		if seenChecked[i] {
+			continue
+		}
+		f := &fields.list[r]
+		if f.required {
+			d.saveError(fmt.Errorf("json: missing required field %q in %v", f.name, t))
+		} else {
+			d.storeDefault(v, f)
+		}
+	}
 	return nil
 }
 
-// convertNumber converts the number literal s to a float64 or a Number
-// depending on the setting of d.useNumber.
+// storeDefault stores the default value of the field f in the struct v.
+func (d *decodeState) storeDefault(v reflect.Value, f *field) {
+	t := v.Type()
+	if f.badOption(d.converter.strictStringTag) != "" {
+		d.saveError(&InvalidStringTagError{Struct: t, Field: f.goName, Type: f.typ, Option: f.badQuoted})
+		return
+	}
+	if f.badDefault {
+		d.saveError(&InvalidDefaultTagError{Struct: t, Field: f.goName, Type: f.typ, Default: f.defaultTag})
+		return
+	}
+	for _, i := range f.index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	origErrorContext := d.errorContext
+	d.errorContext.FieldStack = append(d.errorContext.FieldStack, f.name)
+	d.errorContext.Struct = t
+	if err := d.literalStore(f.defaultVal, v, false); err != nil {
+		d.saveError(err)
+	}
+	d.errorContext.FieldStack = d.errorContext.FieldStack[:len(origErrorContext.FieldStack)]
+	d.errorContext.Struct = origErrorContext.Struct
+}
+
+// fieldValue decodes the value of an object field into v.
+// destring and quoteValues are set by the string and stringvalues tag options.
+func (d *decodeState) fieldValue(v reflect.Value, destring, quoteValues bool) error {
+	if destring {
+		switch qv := d.valueQuoted().(type) {
+		case nil:
+			if err := d.literalStore(nullLiteral, v, false); err != nil {
+				return err
+			}
+		case string:
+			if err := d.literalStore([]byte(qv), v, true); err != nil {
+				return err
+			}
+		default:
+			d.saveError(fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal unquoted value into %v", v.Type()))
+		}
+		return nil
+	}
+	d.stringValues = quoteValues
+	err := d.value(v)
+	d.stringValues = false
+	return err
+}
+
+// rawFieldValue is like fieldValue, but decodes the value in data,
+// which was returned by the DecodeFieldHook, instead of the next value in d.data.
+func (d *decodeState) rawFieldValue(data []byte, v reflect.Value, destring, quoteValues bool) error {
+	sub := *d
+	sub.scan = scanner{
+		maxDepth:            d.scan.maxDepth,
+		maxStringLen:        d.scan.maxStringLen,
+		maxObjectKeys:       d.scan.maxObjectKeys,
+		allowTrailingCommas: d.scan.allowTrailingCommas,
+		allowComments:       d.scan.allowComments,
+	}
+	if err := checkValid(data, &sub.scan); err != nil {
+		return err
+	}
+	sub.data = data
+	sub.off = 0
+	sub.savedError = nil
+	sub.scan.reset()
+	sub.scanWhile(scanSkipSpace)
+	err := sub.fieldValue(v, destring, quoteValues)
+	if d.savedError == nil {
+		// Already has error context added by sub.
+		d.savedError = sub.savedError
+	}
+	return err
+}
+
+// mapKey converts the object key to a value of the map key type kt.
+// item is the quoted key, key is its unquoted form, starting at offset start.
+// If the key cannot be converted, the error is saved and
+// the zero Value is returned.
+func (d *decodeState) mapKey(kt reflect.Type, key, item []byte, start int) (reflect.Value, error) {
+	var kv reflect.Value
+	switch {
+	case reflect.PtrTo(kt).Implements(textUnmarshalerType):
+		kv = reflect.New(kt)
+		if err := d.literalStore(item, kv, true); err != nil {
+			return reflect.Value{}, err
+		}
+		kv = kv.Elem()
+	case kt.Kind() == reflect.String:
+		kv = reflect.ValueOf(key).Convert(kt)
+	default:
+		switch kt.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			s := string(key)
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || reflect.Zero(kt).OverflowInt(n) {
+				d.saveError(&json.UnmarshalTypeError{Value: "number " + s, Type: kt, Offset: int64(start + 1)})
+				break
+			}
+			kv = reflect.ValueOf(n).Convert(kt)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			s := string(key)
+			n, err := strconv.ParseUint(s, 10, 64)
+			if err != nil || reflect.Zero(kt).OverflowUint(n) {
+				d.saveError(&json.UnmarshalTypeError{Value: "number " + s, Type: kt, Offset: int64(start + 1)})
+				break
+			}
+			kv = reflect.ValueOf(n).Convert(kt)
+		default:
+			panic("json: Unexpected key type") // should never occur
+		}
+	}
+	return kv, nil
+}
+
+// convertNumber converts the number literal s to a float64, a json.Number
+// or a Number depending on the setting of d.useNumber, d.numberType and
+// d.decimalMode.
 func (d *decodeState) convertNumber(s string) (interface{}, error) {
+	if d.decimalMode {
+		if !fitsDecimal(s) {
+			return nil, &json.UnmarshalTypeError{Value: "number " + s, Type: numberType, Offset: int64(d.off)}
+		}
+		if d.numberType {
+			return Number(s), nil
+		}
+		return json.Number(s), nil
+	}
+	if d.numberType {
+		return Number(s), nil
+	}
 	if d.useNumber {
 		return json.Number(s), nil
 	}
@@ -794,6 +1519,32 @@ func (d *decodeState) convertNumber(s string) (interface{}, error) {
 
 var numberType = reflect.TypeOf(json.Number(""))
 
+// fitsDecimal reports whether the number literal s can be represented
+// as a decimal with an integer coefficient and an int32 exponent.
+func fitsDecimal(s string) bool {
+	exp := int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		exp, err = strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return false
+		}
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		// Each fractional digit shifts the exponent.
+		exp -= int64(len(s) - i - 1)
+	}
+	return exp >= math.MinInt32 && exp <= math.MaxInt32
+}
+
+// ToDecimal converts a json.Number, such as one decoded in DecimalMode,
+// to an arbitrary-precision decimal type, by calling dst's UnmarshalText
+// method with the exact digits of the number.
+func ToDecimal(n json.Number, dst encoding.TextUnmarshaler) error {
+	return dst.UnmarshalText([]byte(n))
+}
+
 // literalStore decodes a literal stored in item into v.
 //
 // fromQuoted indicates whether this literal came from unwrapping a
@@ -807,9 +1558,67 @@ func (d *decodeState) literalStore(item []byte, v reflect.Value, fromQuoted bool
 		return nil
 	}
 	isNull := item[0] == 'n' // null
+	if fn, pv := d.typeDecoder(v, isNull); fn != nil {
+		return fn(item, pv.Interface())
+	}
+	if layout := d.converter.timeFormat; layout != "" && item[0] == '"' {
+		if pv := indirectType(v, false, isTimeType); pv.IsValid() {
+			s, ok := d.unquote(item)
+			if !ok {
+				if fromQuoted {
+					return fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal %q into %v", item, v.Type())
+				}
+				panic(phasePanicMsg)
+			}
+			t, err := time.Parse(layout, s)
+			if err != nil {
+				d.saveError(&json.UnmarshalTypeError{Value: "string " + strconv.Quote(s), Type: v.Type(), Offset: int64(d.readIndex())})
+				return nil
+			}
+			pv.Elem().Set(reflect.ValueOf(t))
+			return nil
+		}
+	}
+	if d.converter.durationAsString && item[0] == '"' {
+		if pv := indirectType(v, false, isDurationType); pv.IsValid() {
+			s, ok := d.unquote(item)
+			if !ok {
+				if fromQuoted {
+					return fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal %q into %v", item, v.Type())
+				}
+				panic(phasePanicMsg)
+			}
+			dur, err := time.ParseDuration(s)
+			if err != nil {
+				d.saveError(&json.UnmarshalTypeError{Value: "string " + strconv.Quote(s), Type: v.Type(), Offset: int64(d.readIndex())})
+				return nil
+			}
+			pv.Elem().SetInt(int64(dur))
+			return nil
+		}
+	}
+	if c := item[0]; c == '-' || '0' <= c && c <= '9' {
+		if pv := indirectType(v, false, isBigFloatType); pv.IsValid() {
+			// *big.Float only implements TextUnmarshaler,
+			// so decode the number literal here.
+			f := pv.Interface().(*big.Float)
+			if f.Prec() == 0 {
+				// Keep all the digits of the literal.
+				prec := uint(len(item)) * 4
+				if prec < 64 {
+					prec = 64
+				}
+				f.SetPrec(prec)
+			}
+			if _, ok := f.SetString(string(item)); !ok {
+				d.saveError(&json.UnmarshalTypeError{Value: "number " + string(item), Type: v.Type(), Offset: int64(d.readIndex())})
+			}
+			return nil
+		}
+	}
 	u, ut, pv := indirect(v, isNull)
 	if u != nil {
-		return u.UnmarshalJSON(item)
+		return d.callUnmarshaler(u, item)
 	}
 	if ut != nil {
 		if item[0] != '"' {
@@ -887,21 +1696,47 @@ func (d *decodeState) literalStore(item []byte, v reflect.Value, fromQuoted bool
 		}
 		switch v.Kind() {
 		default:
+			if d.enumValue(s, v) {
+				break
+			}
+			if d.coerceScalars && d.coerceString(s, v) {
+				break
+			}
+			if d.autoUnquoteNumbers && d.unquotedNumber(s, v) {
+				break
+			}
 			d.saveError(&json.UnmarshalTypeError{Value: "string", Type: v.Type(), Offset: int64(d.readIndex())})
 		case reflect.Slice:
 			if v.Type().Elem().Kind() != reflect.Uint8 {
 				d.saveError(&json.UnmarshalTypeError{Value: "string", Type: v.Type(), Offset: int64(d.readIndex())})
 				break
 			}
-			b := make([]byte, base64.StdEncoding.DecodedLen(len(s)))
-			n, err := base64.StdEncoding.Decode(b, s)
+			if d.converter.bytesFormat == bytesHex {
+				b := make([]byte, hexenc.DecodedLen(len(s)))
+				n, err := hexenc.Decode(b, s)
+				if err != nil {
+					d.saveError(err)
+					break
+				}
+				v.SetBytes(b[:n])
+				break
+			}
+			b64 := d.converter.base64Encoding
+			if b64 == nil {
+				b64 = base64.StdEncoding
+			} else if b64.EncodedLen(1) < 4 {
+				// Encodings without padding also accept padded input.
+				s = bytes.TrimRight(s, "=")
+			}
+			b := make([]byte, b64.DecodedLen(len(s)))
+			n, err := b64.Decode(b, s)
 			if err != nil {
 				d.saveError(err)
 				break
 			}
 			v.SetBytes(b[:n])
 		case reflect.String:
-			if v.Type() == numberType && !isValidNumber(string(s)) {
+			if isNumberType(v.Type()) && !d.lenientNumbers && !isValidNumber(string(s)) {
 				return fmt.Errorf("json: invalid number literal, trying to unmarshal %q into Number", item)
 			}
 			v.SetString(string(s))
@@ -923,9 +1758,17 @@ func (d *decodeState) literalStore(item []byte, v reflect.Value, fromQuoted bool
 		s := string(item)
 		switch v.Kind() {
 		default:
-			if v.Kind() == reflect.String && v.Type() == numberType {
+			if v.Kind() == reflect.String && isNumberType(v.Type()) {
 				// s must be a valid number, because it's
 				// already been tokenized.
+				if d.decimalMode && !fitsDecimal(s) {
+					d.saveError(&json.UnmarshalTypeError{Value: "number " + s, Type: v.Type(), Offset: int64(d.readIndex())})
+					break
+				}
+				v.SetString(s)
+				break
+			}
+			if v.Kind() == reflect.String && d.coerceScalars {
 				v.SetString(s)
 				break
 			}
@@ -963,7 +1806,7 @@ func (d *decodeState) literalStore(item []byte, v reflect.Value, fromQuoted bool
 
 		case reflect.Float32, reflect.Float64:
 			n, err := strconv.ParseFloat(s, v.Type().Bits())
-			if err != nil || v.OverflowFloat(n) {
+			if err != nil || v.OverflowFloat(n) || d.strictFloat32 && v.Kind() == reflect.Float32 && !isExactFloat32(s, n) {
 				d.saveError(&json.UnmarshalTypeError{Value: "number " + s, Type: v.Type(), Offset: int64(d.readIndex())})
 				break
 			}
@@ -973,6 +1816,42 @@ func (d *decodeState) literalStore(item []byte, v reflect.Value, fromQuoted bool
 	return nil
 }
 
+// coerceString is used by CoerceScalars to store the unquoted string s
+// into a bool or number v. It reports whether s could be converted.
+// A number that doesn't fit v is still an error.
+func (d *decodeState) coerceString(s []byte, v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		switch string(s) {
+		case "true":
+			v.SetBool(true)
+			return true
+		case "false":
+			v.SetBool(false)
+			return true
+		}
+	default:
+		return d.unquotedNumber(s, v)
+	}
+	return false
+}
+
+// unquotedNumber decodes s, the contents of a string, into v
+// if v is numeric and s is a valid number, and reports whether it did.
+func (d *decodeState) unquotedNumber(s []byte, v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		if isValidNumber(string(s)) {
+			// Cannot fail for a valid number.
+			d.literalStore(s, v, false)
+			return true
+		}
+	}
+	return false
+}
+
 // The xxxInterface routines build up a value to be stored
 // in an empty interface. They are not strictly necessary,
 // but they avoid the weight of reflection in this common case.
@@ -983,10 +1862,24 @@ func (d *decodeState) valueInterface() (val interface{}) {
 	default:
 		panic(phasePanicMsg)
 	case scanBeginArray:
-		val = d.arrayInterface()
+		if d.interfaceAllowed("array", emptyInterfaceType) {
+			val = d.arrayInterface()
+		}
 		d.scanNext()
 	case scanBeginObject:
-		val = d.objectInterface()
+		if dv, ok, err := d.discriminatedObject(); ok {
+			if err != nil {
+				d.saveError(err)
+			} else {
+				val = dv.Interface()
+			}
+		} else if !d.interfaceAllowed("object", emptyInterfaceType) {
+			val = nil
+		} else if d.orderedObjects {
+			val = d.orderedMapInterface()
+		} else {
+			val = d.objectInterface()
+		}
 		d.scanNext()
 	case scanBeginLiteral:
 		val = d.literalInterface()
@@ -994,8 +1887,30 @@ func (d *decodeState) valueInterface() (val interface{}) {
 	return
 }
 
+var emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// interfaceAllowed reports whether the array or object, named by value,
+// that is about to be decoded into an interface value of type t is allowed
+// by the MaxInterfaceDepth and RegisteredTypesOnly options.
+// Discriminated objects must have been handled already.
+// If it is not allowed, interfaceAllowed saves an error and skips the value.
+func (d *decodeState) interfaceAllowed(value string, t reflect.Type) bool {
+	if max := d.converter.maxInterfaceDepth; max > 0 && d.interfaceDepth >= max {
+		d.saveError(&LimitError{Limit: "interface depth", Max: max, Offset: int64(d.off)})
+		d.skip()
+		return false
+	}
+	if value == "object" && d.converter.registeredTypesOnly {
+		d.saveError(&json.UnmarshalTypeError{Value: "object", Type: t, Offset: int64(d.off)})
+		d.skip()
+		return false
+	}
+	return true
+}
+
 // arrayInterface is like array but returns []interface{}.
 func (d *decodeState) arrayInterface() []interface{} {
+	d.interfaceDepth++
 	var v = make([]interface{}, 0)
 	for {
 		// Look ahead for ] - can only happen on first iteration.
@@ -1017,12 +1932,15 @@ func (d *decodeState) arrayInterface() []interface{} {
 			panic(phasePanicMsg)
 		}
 	}
+	d.interfaceDepth--
 	return v
 }
 
 // objectInterface is like object but returns map[string]interface{}.
 func (d *decodeState) objectInterface() map[string]interface{} {
+	d.interfaceDepth++
 	m := make(map[string]interface{})
+	var seenKeys map[string]struct{}
 	for {
 		// Read opening " of string key or closing }.
 		d.scanWhile(scanSkipSpace)
@@ -1042,6 +1960,9 @@ func (d *decodeState) objectInterface() map[string]interface{} {
 		if !ok {
 			panic(phasePanicMsg)
 		}
+		if d.disallowDuplicateKeys {
+			d.checkDuplicateKey(&seenKeys, key, start)
+		}
 
 		// Read : before value.
 		if d.opcode == scanSkipSpace {
@@ -1066,6 +1987,7 @@ func (d *decodeState) objectInterface() map[string]interface{} {
 			panic(phasePanicMsg)
 		}
 	}
+	d.interfaceDepth--
 	return m
 }
 
@@ -12,17 +12,22 @@ package jsonx
 
 import (
 	"bytes"
+	"context"
 	"encoding"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
+	"math/big"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
+	"unicode/utf16"
 	"unicode/utf8"
 )
 
@@ -31,7 +36,9 @@ import (
 // Marshal traverses the value v recursively.
 // If an encountered value implements the Marshaler interface
 // and is not a nil pointer, Marshal calls its MarshalJSON method
-// to produce JSON. If no MarshalJSON method is present but the
+// to produce JSON. If the value implements OptionsMarshaler,
+// Marshal calls its MarshalJSONx method instead, passing the encoding options.
+// If no MarshalJSON method is present but the
 // value implements encoding.TextMarshaler instead, Marshal calls
 // its MarshalText method and encodes the result as a JSON string.
 // The nil pointer exception is not strictly necessary
@@ -157,41 +164,117 @@ import (
 // an error.
 //
 func (c *JSON) Marshal(v interface{}) ([]byte, error) {
+	return c.MarshalAppend(nil, v)
+}
+
+// Marshal returns the JSON encoding of v using the default JSON encoder.
+func Marshal(v interface{}) ([]byte, error) {
+	return defaultJSON.Marshal(v)
+}
+
+// MarshalAppend appends the JSON encoding of v to dst and returns the extended buffer.
+// If an error occurs, dst is returned unchanged.
+//
+// Reusing dst avoids allocating a new byte slice for each call.
+// See the documentation for Marshal for details about the
+// conversion of Go values to JSON.
+func (c *JSON) MarshalAppend(dst []byte, v interface{}) ([]byte, error) {
+	return c.marshalAppend(nil, dst, v)
+}
+
+// MarshalAppend appends the JSON encoding of v to dst using the default JSON encoder
+// and returns the extended buffer.
+func MarshalAppend(dst []byte, v interface{}) ([]byte, error) {
+	return defaultJSON.MarshalAppend(dst, v)
+}
+
+// MarshalContext is like Marshal, but aborts the encoding and returns
+// ctx.Err() if ctx is cancelled before it finishes.
+// The context is checked before each struct and before each element
+// of an array, slice or map.
+func (c *JSON) MarshalContext(ctx context.Context, v interface{}) ([]byte, error) {
+	return c.marshalAppend(ctx, nil, v)
+}
+
+// MarshalContext is like Marshal, but aborts the encoding and returns
+// ctx.Err() if ctx is cancelled before it finishes.
+func MarshalContext(ctx context.Context, v interface{}) ([]byte, error) {
+	return defaultJSON.MarshalContext(ctx, v)
+}
+
+// MarshalToWriter writes the JSON encoding of v to w, without
+// a trailing newline, such as to a hash.Hash or a compressor.
+// Unlike Marshal, it doesn't keep the whole encoding in memory:
+// the output is written to w in chunks while v is being encoded.
+// If an error occurs, part of the encoding may already have been written.
+// Indentation, Flatten and Canonical need the whole encoding, so if they
+// are set, the output is written at the end instead.
+func (c *JSON) MarshalToWriter(w io.Writer, v interface{}) error {
+	if c.indentPrefix != "" || c.indentValue != "" || c.flattenSep != "" || c.canonical {
+		b, err := c.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
 	e := newEncodeState()
+	defer freeEncodeState(e)
+	e.w = w
 
-	err := c.marshal(e, v, encOpts{escapeHTML: !c.dontEscapeHTML, omitEmpty: c.omitEmpty})
+	err := c.marshal(e, v, c.encOpts())
 	if err != nil {
-		return nil, err
+		return err
 	}
-	buf := append([]byte(nil), e.Bytes()...)
-
-	encodeStatePool.Put(e)
+	_, err = e.WriteTo(w)
+	return err
+}
 
-	return buf, nil
+// MarshalToWriter writes the JSON encoding of v to w using the default
+// JSON encoder, without a trailing newline.
+func MarshalToWriter(w io.Writer, v interface{}) error {
+	return defaultJSON.MarshalToWriter(w, v)
 }
 
-// Marshal returns the JSON encoding of v using the default JSON encoder.
-func Marshal(v interface{}) ([]byte, error) {
-	return defaultJSON.Marshal(v)
+// marshalAppend implements MarshalAppend and MarshalContext.
+// ctx may be nil.
+func (c *JSON) marshalAppend(ctx context.Context, dst []byte, v interface{}) ([]byte, error) {
+	if ctx != nil {
+		if err := ctx.Err(); err != nil {
+			return dst, err
+		}
+	}
+	e := newEncodeState()
+	defer freeEncodeState(e)
+	e.ctx = ctx
+
+	err := c.marshal(e, v, c.encOpts())
+	if err != nil {
+		return dst, err
+	}
+	if c.indentPrefix != "" || c.indentValue != "" {
+		buf := bytes.NewBuffer(dst)
+		err = json.Indent(buf, e.Bytes(), c.indentPrefix, c.indentValue)
+		if err != nil {
+			return dst, err
+		}
+		dst = buf.Bytes()
+	} else {
+		dst = append(dst, e.Bytes()...)
+	}
+
+	return dst, nil
 }
 
 // MarshalIndent is like Marshal but applies Indent to format the output.
 // Each JSON element in the output will begin on a new line beginning with prefix
 // followed by one or more copies of indent according to the indentation nesting.
 func (c *JSON) MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
-	b, err := c.Marshal(v)
-	if err != nil {
-		return nil, err
-	}
-	var buf bytes.Buffer
-	err = json.Indent(&buf, b, prefix, indent)
-	if err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
+	return c.Indent(prefix, indent).Marshal(v)
 }
 
-// MarshalIndent is like Marshal but applies Indent to format the output.
+// MarshalIndent is like Marshal but applies Indent to format the output
+// using the default JSON encoder.
 // Each JSON element in the output will begin on a new line beginning with prefix
 // followed by one or more copies of indent according to the indentation nesting.
 func MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
@@ -218,6 +301,33 @@ func (e *MarshalerError) Error() string {
 // Unwrap returns the underlying error.
 func (e *MarshalerError) Unwrap() error { return e.Err }
 
+// An InvalidUTF8Error is returned by Marshal when RejectInvalidUTF8 is set
+// and a string contains invalid UTF-8.
+type InvalidUTF8Error struct {
+	S      string // the whole string value that caused the error
+	Offset int    // byte offset of the first invalid byte in S
+}
+
+func (e *InvalidUTF8Error) Error() string {
+	return "json: invalid UTF-8 in string at byte offset " + strconv.Itoa(e.Offset) + ": " + strconv.Quote(e.S)
+}
+
+// An InvalidStringTagError is returned by Marshal and Unmarshal
+// when the ",string" struct tag option is used on a field
+// whose type is not a string, floating point, integer or boolean type
+// and StrictStringTag is set, or when the ",stringvalues" option is used
+// on a field that is not a map with floating point or integer values.
+type InvalidStringTagError struct {
+	Struct reflect.Type // the struct type containing the field
+	Field  string       // the Go name of the field
+	Type   reflect.Type // the type of the field
+	Option string       // the tag option, "string" or "stringvalues"
+}
+
+func (e *InvalidStringTagError) Error() string {
+	return "json: invalid use of ," + e.Option + " struct tag on field " + e.Struct.String() + "." + e.Field + " of type " + e.Type.String()
+}
+
 var hex = "0123456789abcdef"
 
 // An encodeState encodes JSON into a bytes.Buffer.
@@ -232,10 +342,32 @@ type encodeState struct {
 	// reasonable amount of nested pointers deep.
 	ptrLevel uint
 	ptrSeen  map[interface{}]struct{}
+
+	// escapeSet holds additional runes to escape in strings, if any.
+	escapeSet *runeSet
+	// rejectInvalidUTF8 causes invalid UTF-8 in strings to be an error.
+	rejectInvalidUTF8 bool
+
+	// ctx, if set, is checked for cancellation while encoding.
+	ctx context.Context
+
+	// w, if set, receives the output in chunks while encoding,
+	// see MarshalToWriter.
+	w io.Writer
+
+	// path is the path of the value being encoded, maintained only if
+	// an EncodeValueHook is set.
+	path []byte
 }
 
 const startDetectingCyclesAfter = 1000
 
+// streamFlushSize is the amount of output that MarshalToWriter
+// accumulates before writing it.
+const streamFlushSize = 4096
+
+// encodeStatePool holds encodeStates for reuse, so that concurrent calls
+// to Marshal don't each have to allocate and grow a new buffer.
 var encodeStatePool sync.Pool
 
 func newEncodeState() *encodeState {
@@ -246,11 +378,24 @@ func newEncodeState() *encodeState {
 			panic("ptrEncoder.encode should have emptied ptrSeen via defers")
 		}
 		e.ptrLevel = 0
+		e.ctx = nil
+		e.w = nil
+		e.path = e.path[:0]
 		return e
 	}
 	return &encodeState{ptrSeen: make(map[interface{}]struct{})}
 }
 
+// freeEncodeState returns e to encodeStatePool. The caller must not use e,
+// or a slice of its buffer, afterwards.
+// It is safe to reuse an encodeState after an aborted encoding,
+// since ptrSeen is emptied by defers and everything else is reset by newEncodeState.
+func freeEncodeState(e *encodeState) {
+	e.ctx = nil
+	e.w = nil
+	encodeStatePool.Put(e)
+}
+
 // jsonError is an error wrapper type for internal use only.
 // Panics with errors are wrapped in jsonError so that the top-level recover
 // can distinguish intentional panics from this package.
@@ -266,7 +411,19 @@ func (c *JSON) marshal(e *encodeState, v interface{}, opts encOpts) (err error)
 			}
 		}
 	}()
-	c.reflectValue(e, reflect.ValueOf(v), opts)
+	e.escapeSet = c.escapeSet
+	e.rejectInvalidUTF8 = c.rejectInvalidUTF8
+	start := e.Len()
+	rv := reflect.ValueOf(v)
+	if opts.valueHook == nil || !opts.valueHook.replace(e, rv, opts) {
+		c.reflectValue(e, rv, opts)
+	}
+	if c.flattenSep != "" {
+		c.flatten(e, start, opts)
+	}
+	if c.canonical {
+		c.canonicalize(e, start)
+	}
 	return nil
 }
 
@@ -275,6 +432,28 @@ func (e *encodeState) error(err error) {
 	panic(jsonError{err})
 }
 
+// checkpoint is called before each struct and before each element
+// of an array, slice or map. It aborts the encoding if e's context
+// has been cancelled, and writes the accumulated output to e.w
+// if there is enough of it.
+func (e *encodeState) checkpoint() {
+	if e.ctx != nil {
+		if err := e.ctx.Err(); err != nil {
+			e.error(err)
+		}
+	}
+	if e.w != nil && e.Len() >= streamFlushSize {
+		e.flush()
+	}
+}
+
+// flush writes the accumulated output to e.w and empties the buffer.
+func (e *encodeState) flush() {
+	if _, err := e.WriteTo(e.w); err != nil {
+		e.error(err)
+	}
+}
+
 func isEmptyValue(v reflect.Value) bool {
 	switch v.Kind() {
 	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
@@ -293,6 +472,53 @@ func isEmptyValue(v reflect.Value) bool {
 	return false
 }
 
+// isEmpty reports whether v is empty, using isEmptyFn if it is set.
+func (opts encOpts) isEmpty(v reflect.Value) bool {
+	if opts.isEmptyFn != nil {
+		return opts.isEmptyFn(v)
+	}
+	return isEmptyValue(v)
+}
+
+// isZeroValue reports whether v is the zero value of its type.
+// Structs and arrays are zero if all of their elements are.
+func isZeroValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !isZeroValue(v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !isZeroValue(v.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return math.Float64bits(v.Float()) == 0
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return math.Float64bits(real(c)) == 0 && math.Float64bits(imag(c)) == 0
+	case reflect.Map, reflect.Slice, reflect.Interface, reflect.Ptr, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	case reflect.UnsafePointer:
+		return v.Pointer() == 0
+	}
+	return false
+}
+
 func (c *JSON) reflectValue(e *encodeState, v reflect.Value, opts encOpts) {
 	c.valueEncoder(v)(e, v, opts)
 }
@@ -300,12 +526,99 @@ func (c *JSON) reflectValue(e *encodeState, v reflect.Value, opts encOpts) {
 type encOpts struct {
 	// quoted causes primitive fields to be encoded inside JSON strings.
 	quoted bool
+	// quoteValues causes the values of a map to be encoded inside JSON strings.
+	quoteValues bool
 	// escapeHTML causes '<', '>', and '&' to be escaped in JSON strings.
 	escapeHTML bool
 	// omitEmpty causes all empty fields to be omitted.
 	omitEmpty bool
+	// omitEmptyStructs causes fields holding zero structs to be omitted.
+	omitEmptyStructs bool
+	// isEmptyFn replaces isEmptyValue, if set.
+	isEmptyFn func(v reflect.Value) bool
 	// nameMappingFn is applied to struct field names.
 	nameMappingFn func(string) string
+	// floatMode controls the formatting of floating point numbers.
+	floatMode FloatMode
+	// specialFloats controls the encoding of NaN and infinite values.
+	specialFloats SpecialFloatMode
+	// lenientNumbers causes invalid Numbers to be encoded as strings.
+	lenientNumbers bool
+	// strictStringTag causes the string tag option on unsupported fields to be an error.
+	strictStringTag bool
+	// mapKeyCompare is used to sort map keys, if set.
+	mapKeyCompare func(a, b string) int
+	// sortMapKeys causes map keys to be sorted by their encoding.
+	sortMapKeys bool
+	// emptyAsNull causes empty slices and maps to be encoded as null.
+	emptyAsNull bool
+	// nilAsEmpty causes nil slices and maps to be encoded as [] and {}.
+	nilAsEmpty bool
+	// timeFormat is the layout used to encode time.Time values, if set.
+	timeFormat string
+	// durationAsString causes time.Duration values to be encoded as strings.
+	durationAsString bool
+	// errorsAsString causes errors to be encoded as strings.
+	errorsAsString bool
+	// valueHook is called for every value, if set.
+	valueHook *valueHook
+	// showRedacted causes fields with the redact tag option to be encoded normally.
+	showRedacted bool
+	// discriminators is used to inject discriminator fields into structs, if set.
+	discriminators *typeRegistry
+	// enumAsString causes enum values to be encoded as their names.
+	enumAsString bool
+	// bytesFormat is the encoding of byte slices.
+	bytesFormat bytesFormat
+	// base64Encoding is used to encode byte slices, if set.
+	base64Encoding *base64.Encoding
+	// selectFields are the paths of the struct fields to encode, if set.
+	selectFields fieldPaths
+	// excludeFields are the paths of the struct fields to omit, if set.
+	excludeFields fieldPaths
+	// indentPrefix and indentValue are the indentation applied to the output.
+	// They are only passed to OptionsMarshaler, the encoders don't indent.
+	indentPrefix string
+	indentValue  string
+}
+
+// encOpts returns the encoding options configured on c.
+func (c *JSON) encOpts() encOpts {
+	return encOpts{
+		escapeHTML:       !c.dontEscapeHTML,
+		omitEmpty:        c.omitEmpty,
+		omitEmptyStructs: c.omitEmptyStructs,
+		isEmptyFn:        c.isEmptyFn,
+		floatMode:        c.floatMode,
+		specialFloats:    c.specialFloats,
+		lenientNumbers:   c.lenientNumbers,
+		strictStringTag:  c.strictStringTag,
+		mapKeyCompare:    c.mapKeyCompare,
+		sortMapKeys:      c.sortMapKeys,
+		emptyAsNull:      c.emptyAsNull,
+		nilAsEmpty:       c.nilAsEmpty,
+		timeFormat:       c.timeFormat,
+		durationAsString: c.durationAsString,
+		errorsAsString:   c.errorsAsString,
+		valueHook:        c.valueHook(),
+		showRedacted:     c.showRedacted,
+		discriminators:   c.discriminators(),
+		enumAsString:     c.enumAsString,
+		bytesFormat:      c.bytesFormat,
+		base64Encoding:   c.base64Encoding,
+		selectFields:     c.selectFields,
+		excludeFields:    c.excludeFields,
+		indentPrefix:     c.indentPrefix,
+		indentValue:      c.indentValue,
+	}
+}
+
+// discriminators returns the type registry if InjectDiscriminators is set.
+func (c *JSON) discriminators() *typeRegistry {
+	if !c.injectDiscriminators {
+		return nil
+	}
+	return c.types
 }
 
 type encoderFunc func(e *encodeState, v reflect.Value, opts encOpts)
@@ -349,27 +662,80 @@ func (c *JSON) typeEncoder(t reflect.Type) encoderFunc {
 var (
 	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
 	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	errorType         = reflect.TypeOf((*error)(nil)).Elem()
+	bigFloatType      = reflect.TypeOf(big.Float{})
 )
 
 // newTypeEncoder constructs an encoderFunc for a type.
 // The returned encoder only checks CanAddr when allowAddr is true.
 func (c *JSON) newTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
+	// Errors are encoded as strings if ErrorsAsString is set,
+	// which is only known when encoding.
+	if _, ok := c.types.encoders.Load(t); !ok && t.Kind() != reflect.Interface {
+		if t.Implements(errorType) {
+			return errorEncoder{elemEnc: c.newValueTypeEncoder(t, allowAddr)}.encode
+		}
+		if t.Kind() != reflect.Ptr && allowAddr && reflect.PtrTo(t).Implements(errorType) {
+			return newCondAddrEncoder(errorEncoder{elemEnc: c.newValueTypeEncoder(t, true), addr: true}.encode, c.newValueTypeEncoder(t, false))
+		}
+	}
+	return c.newValueTypeEncoder(t, allowAddr)
+}
+
+// newValueTypeEncoder is like newTypeEncoder, but it ignores the error
+// interface of t.
+func (c *JSON) newValueTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
+	if fn, ok := c.types.encoders.Load(t); ok {
+		return newRegisteredEncoder(fn.(func(interface{}) ([]byte, error)))
+	}
+	if t == orderedMapType {
+		return c.orderedMapEncoder
+	}
+	if t == syncMapType {
+		return c.syncMapEncoder
+	}
+	if t == timeType {
+		return timeEncoder
+	}
+	if t == durationType {
+		return durationEncoder
+	}
+	if t == bigFloatType {
+		return bigFloatEncoder
+	}
+	if t.Kind() == reflect.Ptr && (t.Elem() == timeType || t.Elem() == bigFloatType) {
+		// *time.Time and *big.Float implement Marshaler or TextMarshaler too,
+		// don't let that bypass their encoders.
+		return c.newPtrEncoder(t)
+	}
+
 	// If we have a non-pointer value whose type implements
 	// Marshaler with a value receiver, then we're better off taking
 	// the address of the value - otherwise we end up with an
 	// allocation as we cast the value to an interface.
+	if t.Kind() != reflect.Ptr && allowAddr && reflect.PtrTo(t).Implements(optionsMarshalerType) {
+		return newCondAddrEncoder(addrOptionsMarshalerEncoder, c.newValueTypeEncoder(t, false))
+	}
+	if t.Implements(optionsMarshalerType) {
+		return optionsMarshalerEncoder
+	}
 	if t.Kind() != reflect.Ptr && allowAddr && reflect.PtrTo(t).Implements(marshalerType) {
-		return newCondAddrEncoder(addrMarshalerEncoder, c.newTypeEncoder(t, false))
+		return newCondAddrEncoder(addrMarshalerEncoder, c.newValueTypeEncoder(t, false))
 	}
 	if t.Implements(marshalerType) {
 		return marshalerEncoder
 	}
 	if t.Kind() != reflect.Ptr && allowAddr && reflect.PtrTo(t).Implements(textMarshalerType) {
-		return newCondAddrEncoder(addrTextMarshalerEncoder, c.newTypeEncoder(t, false))
+		return newCondAddrEncoder(addrTextMarshalerEncoder, c.newValueTypeEncoder(t, false))
 	}
 	if t.Implements(textMarshalerType) {
 		return textMarshalerEncoder
 	}
+	if enc := c.newEnumEncoder(t); enc != nil {
+		return enc
+	}
 
 	switch t.Kind() {
 	case reflect.Bool:
@@ -425,6 +791,73 @@ func marshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 	}
 }
 
+func timeEncoder(e *encodeState, v reflect.Value, opts encOpts) {
+	if opts.timeFormat == "" {
+		marshalerEncoder(e, v, opts)
+		return
+	}
+	e.string(v.Interface().(time.Time).Format(opts.timeFormat), opts.escapeHTML)
+}
+
+func durationEncoder(e *encodeState, v reflect.Value, opts encOpts) {
+	if !opts.durationAsString {
+		intEncoder(e, v, opts)
+		return
+	}
+	s := time.Duration(v.Int()).String()
+	if opts.quoted {
+		// Quoted like a string with the ,string option.
+		e.stringBytes([]byte(`"`+s+`"`), opts.escapeHTML)
+		return
+	}
+	e.string(s, opts.escapeHTML)
+}
+
+// bigFloatEncoder encodes a big.Float as a number, with all its digits
+// and without an exponent.
+func bigFloatEncoder(e *encodeState, v reflect.Value, opts encOpts) {
+	var f *big.Float
+	if v.CanAddr() {
+		f = v.Addr().Interface().(*big.Float)
+	} else {
+		fv := v.Interface().(big.Float)
+		f = &fv
+	}
+	if f.IsInf() {
+		e.error(&json.UnsupportedValueError{Value: v, Str: f.String()})
+	}
+	b := f.Append(e.scratch[:0], 'f', -1)
+	if opts.quoted {
+		e.WriteByte('"')
+	}
+	e.Write(b)
+	if opts.quoted {
+		e.WriteByte('"')
+	}
+}
+
+type registeredEncoder struct {
+	fn func(interface{}) ([]byte, error)
+}
+
+func (re registeredEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
+	b, err := re.fn(v.Interface())
+	if err == nil {
+		// copy JSON into buffer, checking validity.
+		err = compact(&e.Buffer, b, opts.escapeHTML)
+	}
+	if err != nil {
+		e.error(&MarshalerError{Type: v.Type(), Err: err, sourceFunc: "registered encoder"})
+	}
+}
+
+// newRegisteredEncoder returns an encoder that calls fn, which was
+// registered with RegisterTypeEncoder.
+func newRegisteredEncoder(fn func(interface{}) ([]byte, error)) encoderFunc {
+	enc := registeredEncoder{fn: fn}
+	return enc.encode
+}
+
 func addrMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 	va := v.Addr()
 	if va.IsNil() {
@@ -514,7 +947,23 @@ type floatEncoder int // number of bits
 func (bits floatEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 	f := v.Float()
 	if math.IsInf(f, 0) || math.IsNaN(f) {
-		e.error(&json.UnsupportedValueError{Value: v, Str: strconv.FormatFloat(f, 'g', -1, int(bits))})
+		if opts.specialFloats == SpecialFloatsError {
+			e.error(&json.UnsupportedValueError{Value: v, Str: strconv.FormatFloat(f, 'g', -1, int(bits))})
+		}
+		s := "NaN"
+		if math.IsInf(f, 1) {
+			s = "Infinity"
+		} else if math.IsInf(f, -1) {
+			s = "-Infinity"
+		}
+		if opts.quoted || opts.specialFloats == SpecialFloatsQuoted {
+			e.WriteByte('"')
+			e.WriteString(s)
+			e.WriteByte('"')
+		} else {
+			e.WriteString(s)
+		}
+		return
 	}
 
 	// Convert as if by ES6 number to string conversion.
@@ -526,7 +975,8 @@ func (bits floatEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 	abs := math.Abs(f)
 	fmt := byte('f')
 	// Note: Must use float32 comparisons for underlying float32 value to get precise cutoffs right.
-	if abs != 0 {
+	// In FloatModeInteger, whole numbers are written out in full, without an exponent.
+	if abs != 0 && (opts.floatMode != FloatModeInteger || f != math.Trunc(f)) {
 		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
 			fmt = 'e'
 		}
@@ -556,7 +1006,7 @@ var (
 )
 
 func stringEncoder(e *encodeState, v reflect.Value, opts encOpts) {
-	if v.Type() == numberType {
+	if isNumberType(v.Type()) {
 		numStr := v.String()
 		// In Go1.5 the empty string encodes to "0", while this is not a valid number literal
 		// we keep compatibility so check validity after this.
@@ -564,6 +1014,10 @@ func stringEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 			numStr = "0" // Number's zero-val
 		}
 		if !isValidNumber(numStr) {
+			if opts.lenientNumbers {
+				e.string(numStr, opts.escapeHTML)
+				return
+			}
 			e.error(fmt.Errorf("json: invalid number literal %q", numStr))
 		}
 		if opts.quoted {
@@ -576,6 +1030,11 @@ func stringEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		return
 	}
 	if opts.quoted {
+		if e.rejectInvalidUTF8 {
+			if i := invalidUTF8Offset(v.String()); i >= 0 {
+				e.error(&InvalidUTF8Error{S: v.String(), Offset: i})
+			}
+		}
 		b := make([]byte, 0, v.Len()+2)
 		b = append(b, '"')
 		b = append(b, []byte(v.String())...)
@@ -586,6 +1045,34 @@ func stringEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 	}
 }
 
+// isNumericType reports whether t, or the type it points to,
+// is a floating point or integer type.
+func isNumericType(t reflect.Type) bool {
+	if t.Name() == "" && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// invalidUTF8Offset returns the byte offset of the first invalid UTF-8
+// sequence in s, or -1 if s is valid UTF-8.
+func invalidUTF8Offset(s string) int {
+	for i := 0; i < len(s); {
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
 // isValidNumber reports whether s is a valid JSON number literal.
 func isValidNumber(s string) bool {
 	// This function implements the JSON numbers grammar.
@@ -654,6 +1141,29 @@ func (c *JSON) interfaceEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 	c.reflectValue(e, v.Elem(), opts)
 }
 
+// errorEncoder encodes values of types implementing error as the strings
+// returned by their Error method if ErrorsAsString is set, and with elemEnc
+// otherwise. If addr is set, the pointer to the value implements error.
+type errorEncoder struct {
+	elemEnc encoderFunc
+	addr    bool
+}
+
+func (ee errorEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
+	if !opts.errorsAsString {
+		ee.elemEnc(e, v, opts)
+		return
+	}
+	if ee.addr {
+		v = v.Addr()
+	}
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		e.WriteString("null")
+		return
+	}
+	e.string(v.Interface().(error).Error(), opts.escapeHTML)
+}
+
 func unsupportedTypeEncoder(e *encodeState, v reflect.Value, _ encOpts) {
 	e.error(&json.UnsupportedTypeError{Type: v.Type()})
 }
@@ -665,14 +1175,52 @@ type structEncoder struct {
 type structFields struct {
 	list      []field
 	nameIndex map[string]int
+	// decodeIndex maps the Go names of untagged fields to their index.
+	// It is only built if a key decoding function is set.
+	decodeIndex map[string]int
+	// namerIndex maps the snake_case Go names of untagged fields to their index.
+	// It is only built if the KeyNamer is one of the built-in ones,
+	// which match keys by their snake_case form.
+	namerIndex map[string]int
+	// checked holds the indexes of the fields with the required or default tag option,
+	// which the object decoder tracks to find the absent ones.
+	checked []int
 }
 
 func (se structEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
+	e.checkpoint()
 	next := byte('{')
+	if opts.discriminators != nil {
+		if dv, ok := opts.discriminators.discriminator(v.Type()); ok {
+			if _, ok := se.fields.nameIndex[dv.field]; !ok {
+				e.WriteByte(next)
+				next = ','
+				e.string(dv.field, opts.escapeHTML)
+				e.WriteByte(':')
+				e.string(dv.value, opts.escapeHTML)
+			}
+		}
+	}
+	selected, excluded := opts.selectFields, opts.excludeFields
 FieldLoop:
 	for i := range se.fields.list {
 		f := &se.fields.list[i]
 
+		if selected != nil {
+			sub, ok := selected[f.name]
+			if !ok {
+				continue
+			}
+			opts.selectFields = sub
+		}
+		if excluded != nil {
+			sub, ok := excluded[f.name]
+			if ok && sub == nil {
+				continue
+			}
+			opts.excludeFields = sub
+		}
+
 		// Find the nested struct field by following f.index.
 		fv := v
 		for _, i := range f.index {
@@ -685,18 +1233,36 @@ FieldLoop:
 			fv = fv.Field(i)
 		}
 
-		if (f.omitEmpty || opts.omitEmpty) && isEmptyValue(fv) {
+		if (f.omitEmpty || opts.omitEmpty) && opts.isEmpty(fv) {
 			continue
 		}
+		if opts.omitEmptyStructs && fv.Kind() == reflect.Struct && isZeroValue(fv) {
+			continue
+		}
+		if option := f.badOption(opts.strictStringTag); option != "" {
+			e.error(&InvalidStringTagError{Struct: v.Type(), Field: f.goName, Type: f.typ, Option: option})
+		}
 		e.WriteByte(next)
 		next = ','
-		if opts.escapeHTML {
+		if e.escapeSet != nil {
+			e.string(f.name, opts.escapeHTML)
+			e.WriteByte(':')
+		} else if opts.escapeHTML {
 			e.WriteString(f.nameEscHTML)
 		} else {
 			e.WriteString(f.nameNonEsc)
 		}
+		if f.redact && !opts.showRedacted {
+			e.WriteString(redactedValue)
+			continue
+		}
 		opts.quoted = f.quoted
-		f.encoder(e, fv, opts)
+		opts.quoteValues = f.quoteValues
+		if opts.valueHook != nil {
+			opts.valueHook.encode(e, f.encoder, fv, f.name, opts)
+		} else {
+			f.encoder(e, fv, opts)
+		}
 	}
 	if next == '{' {
 		e.WriteString("{}")
@@ -705,6 +1271,9 @@ FieldLoop:
 	}
 }
 
+// redactedValue is encoded instead of the value of fields with the redact tag option.
+const redactedValue = `"[REDACTED]"`
+
 func (c *JSON) newStructEncoder(t reflect.Type) encoderFunc {
 	se := structEncoder{fields: c.cachedTypeFields(t)}
 	return se.encode
@@ -715,10 +1284,18 @@ type mapEncoder struct {
 }
 
 func (me mapEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
-	if v.IsNil() {
+	if opts.emptyAsNull && v.Len() == 0 {
 		e.WriteString("null")
 		return
 	}
+	if v.IsNil() {
+		if opts.nilAsEmpty {
+			e.WriteString("{}")
+		} else {
+			e.WriteString("null")
+		}
+		return
+	}
 	e.WriteByte('{')
 
 	// Extract and sort the keys.
@@ -730,19 +1307,54 @@ func (me mapEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 			e.error(fmt.Errorf("json: encoding error for type %q: %q", v.Type().String(), err.Error()))
 		}
 	}
-	sort.Slice(sv, func(i, j int) bool { return sv[i].s < sv[j].s })
+	elemOpts := opts
+	elemOpts.quoted = opts.quoteValues
+	elemOpts.quoteValues = false
+	var encodedKeys []string
+	if opts.sortMapKeys {
+		keys := make([]string, len(sv))
+		for i := range sv {
+			keys[i] = sv[i].s
+		}
+		encodedKeys = sortEncodedKeys(e, keys, opts, func(e *encodeState, i int) {
+			me.elemEnc(e, v.MapIndex(sv[i].v), elemOpts)
+		}, func(i, j int) { sv[i], sv[j] = sv[j], sv[i] })
+	} else {
+		sort.Slice(sv, func(i, j int) bool { return mapKeyLess(sv[i].s, sv[j].s, opts.mapKeyCompare) })
+	}
 
 	for i, kv := range sv {
+		e.checkpoint()
 		if i > 0 {
 			e.WriteByte(',')
 		}
-		e.string(kv.s, opts.escapeHTML)
+		if encodedKeys != nil {
+			e.WriteString(encodedKeys[i])
+		} else {
+			e.string(kv.s, opts.escapeHTML)
+		}
 		e.WriteByte(':')
-		me.elemEnc(e, v.MapIndex(kv.v), opts)
+		if opts.valueHook != nil {
+			opts.valueHook.encode(e, me.elemEnc, v.MapIndex(kv.v), kv.s, elemOpts)
+		} else {
+			me.elemEnc(e, v.MapIndex(kv.v), elemOpts)
+		}
 	}
 	e.WriteByte('}')
 }
 
+// mapKeyLess reports whether the map key a sorts before b,
+// using cmp if it is set.
+func mapKeyLess(a, b string, cmp func(a, b string) int) bool {
+	if cmp != nil {
+		if c := cmp(a, b); c != 0 {
+			return c < 0
+		}
+		// Break ties lexicographically to keep the output deterministic.
+	}
+	return a < b
+}
+
 func (c *JSON) newMapEncoder(t reflect.Type) encoderFunc {
 	switch t.Key().Kind() {
 	case reflect.String,
@@ -757,30 +1369,64 @@ func (c *JSON) newMapEncoder(t reflect.Type) encoderFunc {
 	return me.encode
 }
 
-func encodeByteSlice(e *encodeState, v reflect.Value, _ encOpts) {
-	if v.IsNil() {
+func encodeByteSlice(e *encodeState, v reflect.Value, opts encOpts) {
+	if opts.emptyAsNull && v.Len() == 0 {
 		e.WriteString("null")
 		return
 	}
+	if v.IsNil() {
+		if !opts.nilAsEmpty {
+			e.WriteString("null")
+		} else if opts.bytesFormat == bytesArray {
+			e.WriteString("[]")
+		} else {
+			e.WriteString(`""`)
+		}
+		return
+	}
 	s := v.Bytes()
+	switch opts.bytesFormat {
+	case bytesArray:
+		e.WriteByte('[')
+		for i, b := range s {
+			if i > 0 {
+				e.WriteByte(',')
+			}
+			e.Write(strconv.AppendUint(e.scratch[:0], uint64(b), 10))
+		}
+		e.WriteByte(']')
+		return
+	case bytesHex:
+		e.WriteByte('"')
+		for _, b := range s {
+			e.WriteByte(hex[b>>4])
+			e.WriteByte(hex[b&0xF])
+		}
+		e.WriteByte('"')
+		return
+	}
+	b64 := opts.base64Encoding
+	if b64 == nil {
+		b64 = base64.StdEncoding
+	}
 	e.WriteByte('"')
-	encodedLen := base64.StdEncoding.EncodedLen(len(s))
+	encodedLen := b64.EncodedLen(len(s))
 	if encodedLen <= len(e.scratch) {
 		// If the encoded bytes fit in e.scratch, avoid an extra
 		// allocation and use the cheaper Encoding.Encode.
 		dst := e.scratch[:encodedLen]
-		base64.StdEncoding.Encode(dst, s)
+		b64.Encode(dst, s)
 		e.Write(dst)
 	} else if encodedLen <= 1024 {
 		// The encoded bytes are short enough to allocate for, and
 		// Encoding.Encode is still cheaper.
 		dst := make([]byte, encodedLen)
-		base64.StdEncoding.Encode(dst, s)
+		b64.Encode(dst, s)
 		e.Write(dst)
 	} else {
 		// The encoded bytes are too long to cheaply allocate, and
 		// Encoding.Encode is no longer noticeably cheaper.
-		enc := base64.NewEncoder(base64.StdEncoding, e)
+		enc := base64.NewEncoder(b64, e)
 		enc.Write(s)
 		enc.Close()
 	}
@@ -793,10 +1439,18 @@ type sliceEncoder struct {
 }
 
 func (se sliceEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
-	if v.IsNil() {
+	if opts.emptyAsNull && v.Len() == 0 {
 		e.WriteString("null")
 		return
 	}
+	if v.IsNil() {
+		if opts.nilAsEmpty {
+			e.WriteString("[]")
+		} else {
+			e.WriteString("null")
+		}
+		return
+	}
 	se.arrayEnc(e, v, opts)
 }
 
@@ -804,7 +1458,7 @@ func (c *JSON) newSliceEncoder(t reflect.Type) encoderFunc {
 	// Byte slices get special treatment; arrays don't.
 	if t.Elem().Kind() == reflect.Uint8 {
 		p := reflect.PtrTo(t.Elem())
-		if !p.Implements(marshalerType) && !p.Implements(textMarshalerType) {
+		if !p.Implements(marshalerType) && !p.Implements(textMarshalerType) && !p.Implements(optionsMarshalerType) {
 			return encodeByteSlice
 		}
 	}
@@ -817,13 +1471,19 @@ type arrayEncoder struct {
 }
 
 func (ae arrayEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
+	e.checkpoint()
 	e.WriteByte('[')
 	n := v.Len()
 	for i := 0; i < n; i++ {
+		e.checkpoint()
 		if i > 0 {
 			e.WriteByte(',')
 		}
-		ae.elemEnc(e, v.Index(i), opts)
+		if opts.valueHook != nil {
+			opts.valueHook.encode(e, ae.elemEnc, v.Index(i), strconv.Itoa(i), opts)
+		} else {
+			ae.elemEnc(e, v.Index(i), opts)
+		}
 	}
 	e.WriteByte(']')
 }
@@ -833,6 +1493,47 @@ func (c *JSON) newArrayEncoder(t reflect.Type) encoderFunc {
 	return enc.encode
 }
 
+// valueHook calls the function set by EncodeValueHook.
+type valueHook struct {
+	fn func(path string, v reflect.Value) (interface{}, bool)
+	c  *JSON
+}
+
+// valueHook returns the valueHook for the EncodeValueHook set on c, if any.
+func (c *JSON) valueHook() *valueHook {
+	if c.encodeValueHook == nil {
+		return nil
+	}
+	return &valueHook{fn: c.encodeValueHook, c: c}
+}
+
+// encode encodes v, the value of the object key or array index elem, using enc,
+// unless the hook replaces it.
+func (h *valueHook) encode(e *encodeState, enc encoderFunc, v reflect.Value, elem string, opts encOpts) {
+	n := len(e.path)
+	if n > 0 {
+		e.path = append(e.path, '.')
+	}
+	e.path = append(e.path, elem...)
+	if !h.replace(e, v, opts) {
+		enc(e, v, opts)
+	}
+	e.path = e.path[:n]
+}
+
+// replace calls the hook for v at the current path and
+// encodes its replacement, if any, without calling the hook again.
+// It reports whether v was replaced.
+func (h *valueHook) replace(e *encodeState, v reflect.Value, opts encOpts) bool {
+	r, ok := h.fn(string(e.path), v)
+	if !ok {
+		return false
+	}
+	opts.valueHook = nil
+	h.c.reflectValue(e, reflect.ValueOf(r), opts)
+	return true
+}
+
 type ptrEncoder struct {
 	elemEnc encoderFunc
 }
@@ -942,7 +1643,7 @@ func (e *encodeState) string(s string, escapeHTML bool) {
 	start := 0
 	for i := 0; i < len(s); {
 		if b := s[i]; b < utf8.RuneSelf {
-			if htmlSafeSet[b] || (!escapeHTML && safeSet[b]) {
+			if (htmlSafeSet[b] || (!escapeHTML && safeSet[b])) && (e.escapeSet == nil || !e.escapeSet.ascii[b]) {
 				i++
 				continue
 			}
@@ -975,6 +1676,9 @@ func (e *encodeState) string(s string, escapeHTML bool) {
 		}
 		c, size := utf8.DecodeRuneInString(s[i:])
 		if c == utf8.RuneError && size == 1 {
+			if e.rejectInvalidUTF8 {
+				e.error(&InvalidUTF8Error{S: s, Offset: i})
+			}
 			if start < i {
 				e.WriteString(s[start:i])
 			}
@@ -983,6 +1687,15 @@ func (e *encodeState) string(s string, escapeHTML bool) {
 			start = i
 			continue
 		}
+		if e.escapeSet != nil && e.escapeSet.other[c] {
+			if start < i {
+				e.WriteString(s[start:i])
+			}
+			e.escapeRune(c)
+			i += size
+			start = i
+			continue
+		}
 		// U+2028 is LINE SEPARATOR.
 		// U+2029 is PARAGRAPH SEPARATOR.
 		// They are both technically valid characters in JSON strings,
@@ -1014,7 +1727,7 @@ func (e *encodeState) stringBytes(s []byte, escapeHTML bool) {
 	start := 0
 	for i := 0; i < len(s); {
 		if b := s[i]; b < utf8.RuneSelf {
-			if htmlSafeSet[b] || (!escapeHTML && safeSet[b]) {
+			if (htmlSafeSet[b] || (!escapeHTML && safeSet[b])) && (e.escapeSet == nil || !e.escapeSet.ascii[b]) {
 				i++
 				continue
 			}
@@ -1047,6 +1760,9 @@ func (e *encodeState) stringBytes(s []byte, escapeHTML bool) {
 		}
 		c, size := utf8.DecodeRune(s[i:])
 		if c == utf8.RuneError && size == 1 {
+			if e.rejectInvalidUTF8 {
+				e.error(&InvalidUTF8Error{S: string(s), Offset: i})
+			}
 			if start < i {
 				e.Write(s[start:i])
 			}
@@ -1055,6 +1771,15 @@ func (e *encodeState) stringBytes(s []byte, escapeHTML bool) {
 			start = i
 			continue
 		}
+		if e.escapeSet != nil && e.escapeSet.other[c] {
+			if start < i {
+				e.Write(s[start:i])
+			}
+			e.escapeRune(c)
+			i += size
+			start = i
+			continue
+		}
 		// U+2028 is LINE SEPARATOR.
 		// U+2029 is PARAGRAPH SEPARATOR.
 		// They are both technically valid characters in JSON strings,
@@ -1080,6 +1805,47 @@ func (e *encodeState) stringBytes(s []byte, escapeHTML bool) {
 	e.WriteByte('"')
 }
 
+// runeSet is a set of runes that are always escaped in JSON strings.
+type runeSet struct {
+	ascii [utf8.RuneSelf]bool
+	other map[rune]bool
+}
+
+// newRuneSet returns a runeSet containing runes,
+// or nil if runes is empty. Invalid runes are ignored.
+func newRuneSet(runes []rune) *runeSet {
+	if len(runes) == 0 {
+		return nil
+	}
+	set := &runeSet{other: make(map[rune]bool)}
+	for _, r := range runes {
+		if !utf8.ValidRune(r) {
+			continue
+		}
+		if r < utf8.RuneSelf {
+			set.ascii[r] = true
+		} else {
+			set.other[r] = true
+		}
+	}
+	return set
+}
+
+// escapeRune writes r as a \uXXXX escape sequence,
+// or as a surrogate pair of them if r is outside the Basic Multilingual Plane.
+func (e *encodeState) escapeRune(r rune) {
+	if r1, r2 := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+		e.escapeRune(r1)
+		e.escapeRune(r2)
+		return
+	}
+	e.WriteString(`\u`)
+	e.WriteByte(hex[r>>12&0xF])
+	e.WriteByte(hex[r>>8&0xF])
+	e.WriteByte(hex[r>>4&0xF])
+	e.WriteByte(hex[r&0xF])
+}
+
 // A field represents a single field found in a struct.
 type field struct {
 	name      string
@@ -1089,15 +1855,34 @@ type field struct {
 	nameNonEsc  string // `"` + name + `":`
 	nameEscHTML string // `"` + HTMLEscape(name) + `":`
 
-	tag       bool
-	index     []int
-	typ       reflect.Type
-	omitEmpty bool
-	quoted    bool
+	goName string // Go struct field name
+
+	tag         bool
+	index       []int
+	typ         reflect.Type
+	omitEmpty   bool
+	quoted      bool
+	quoteValues bool   // values of a numeric map are quoted
+	redact      bool   // value is replaced by redactedValue unless ShowRedacted is set
+	required    bool   // decoding an object without the field is an error
+	defaultVal  []byte // JSON value stored when decoding an object without the field
+	defaultTag  string // value of the default tag option
+	badDefault  bool   // defaultTag is not valid for the field
+	badQuoted   string // tag option used on a type it doesn't apply to, if any
 
 	encoder encoderFunc
 }
 
+// badOption returns the tag option of f that is used on a type it doesn't
+// apply to, or "" if there is none. Like encoding/json, the string option
+// is ignored on such types unless strictStringTag is set.
+func (f *field) badOption(strictStringTag bool) string {
+	if f.badQuoted == "string" && !strictStringTag {
+		return ""
+	}
+	return f.badQuoted
+}
+
 // byIndex sorts field by index sequence.
 type byIndex []field
 
@@ -1156,8 +1941,9 @@ func (c *JSON) typeFields(t reflect.Type) structFields {
 					if t.Kind() == reflect.Ptr {
 						t = t.Elem()
 					}
-					if isUnexported && t.Kind() != reflect.Struct {
-						// Ignore embedded fields of unexported non-struct types.
+					if isUnexported && (t.Kind() != reflect.Struct || c.nestEmbedded) {
+						// Ignore embedded fields of unexported non-struct types,
+						// and of unexported struct types if they are not promoted.
 						continue
 					}
 					// Do not ignore embedded fields of unexported struct types
@@ -1166,7 +1952,7 @@ func (c *JSON) typeFields(t reflect.Type) structFields {
 					// Ignore unexported non-embedded fields.
 					continue
 				}
-				tag := sf.Tag.Get("json")
+				tag := c.fieldTag(sf.Tag)
 				if tag == "-" {
 					continue
 				}
@@ -1184,8 +1970,10 @@ func (c *JSON) typeFields(t reflect.Type) structFields {
 					ft = ft.Elem()
 				}
 
-				// Only strings, floats, integers, and booleans can be quoted.
+				// Only strings, floats, integers, and booleans can be quoted,
+				// including named types with one of those underlying kinds.
 				quoted := false
+				badQuoted := ""
 				if opts.Contains("string") {
 					switch ft.Kind() {
 					case reflect.Bool,
@@ -1194,25 +1982,61 @@ func (c *JSON) typeFields(t reflect.Type) structFields {
 						reflect.Float32, reflect.Float64,
 						reflect.String:
 						quoted = true
+					default:
+						badQuoted = "string"
+					}
+				}
+
+				// Only maps with float or integer values can have their values quoted.
+				quoteValues := false
+				if opts.Contains("stringvalues") {
+					if ft.Kind() == reflect.Map && isNumericType(ft.Elem()) {
+						quoteValues = true
+					} else {
+						badQuoted = "stringvalues"
+					}
+				}
+
+				// The default value is a JSON literal,
+				// or the contents of a string if the field decodes from one.
+				var defaultVal []byte
+				defaultTag, hasDefault := opts.Value("default")
+				if hasDefault {
+					if isDefaultQuoted(ft) {
+						defaultVal, _ = json.Marshal(defaultTag)
+					} else if json.Valid([]byte(defaultTag)) && defaultTag[0] != '{' && defaultTag[0] != '[' {
+						defaultVal = []byte(defaultTag)
 					}
 				}
 
 				// Record found field and index sequence.
-				if name != "" || !sf.Anonymous || ft.Kind() != reflect.Struct {
+				if name != "" || !sf.Anonymous || ft.Kind() != reflect.Struct || c.nestEmbedded {
 					tagged := name != ""
 					if name == "" {
 						name = sf.Name
-						if c.keyEncodeFn != nil {
+						if c.keyEncodeFnContext != nil {
+							name = c.keyEncodeFnContext(name, f.typ, sf.Tag)
+						} else if c.keyNamer != nil {
+							name = c.keyNamer.Encode(name)
+						} else if c.keyEncodeFn != nil {
 							name = c.keyEncodeFn(name)
 						}
 					}
 					field := field{
-						name:      name,
-						tag:       tagged,
-						index:     index,
-						typ:       ft,
-						omitEmpty: opts.Contains("omitempty"),
-						quoted:    quoted,
+						name:        name,
+						goName:      sf.Name,
+						tag:         tagged,
+						index:       index,
+						typ:         ft,
+						omitEmpty:   opts.Contains("omitempty"),
+						quoted:      quoted,
+						quoteValues: quoteValues,
+						redact:      opts.Contains("redact"),
+						required:    opts.Contains("required"),
+						defaultVal:  defaultVal,
+						defaultTag:  defaultTag,
+						badDefault:  hasDefault && defaultVal == nil,
+						badQuoted:   badQuoted,
 					}
 					field.nameBytes = []byte(field.name)
 					field.equalFold = foldFunc(field.nameBytes)
@@ -1301,7 +2125,44 @@ func (c *JSON) typeFields(t reflect.Type) structFields {
 	for i, field := range fields {
 		nameIndex[field.name] = i
 	}
-	return structFields{fields, nameIndex}
+	var decodeIndex map[string]int
+	if c.keyDecodeFn != nil {
+		decodeIndex = make(map[string]int, len(fields))
+		for i, field := range fields {
+			if !field.tag {
+				decodeIndex[field.goName] = i
+			}
+		}
+	}
+	var namerIndex map[string]int
+	if _, ok := c.keyNamer.(caseNamer); ok {
+		namerIndex = make(map[string]int, len(fields))
+		for i, field := range fields {
+			if field.tag {
+				continue
+			}
+			name := SnakeCase(field.goName)
+			if _, ok := namerIndex[name]; !ok {
+				namerIndex[name] = i
+			}
+		}
+	}
+	var checked []int
+	for i, field := range fields {
+		if field.required || field.defaultVal != nil || field.badDefault {
+			checked = append(checked, i)
+		}
+	}
+	return structFields{fields, nameIndex, decodeIndex, namerIndex, checked}
+}
+
+// isDefaultQuoted reports whether the default tag option of a field of type t
+// is the contents of a JSON string rather than a JSON literal.
+func isDefaultQuoted(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.String || reflect.PtrTo(t).Implements(textUnmarshalerType)
 }
 
 // dominantField looks through the fields, all of which are known to
@@ -1320,6 +2181,20 @@ func dominantField(fields []field) (field, bool) {
 	return fields[0], true
 }
 
+// fieldTag returns the value of the first configured tag key
+// that is present in tag, or the json tag by default.
+func (c *JSON) fieldTag(tag reflect.StructTag) string {
+	if len(c.tagKeys) == 0 {
+		return tag.Get("json")
+	}
+	for _, key := range c.tagKeys {
+		if v, ok := tag.Lookup(key); ok {
+			return v
+		}
+	}
+	return ""
+}
+
 // cachedTypeFields is like typeFields but uses a cache to avoid repeated work.
 func (c *JSON) cachedTypeFields(t reflect.Type) structFields {
 	if f, ok := c.fieldCache.Load(t); ok {
@@ -0,0 +1,160 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// enumNamer is implemented by integer enum types that can name their values.
+type enumNamer interface {
+	Name() string
+}
+
+var enumNamerType = reflect.TypeOf((*enumNamer)(nil)).Elem()
+
+// enumNames holds the names registered for an enum type.
+type enumNames struct {
+	names  map[int64]string
+	values map[string]int64
+}
+
+// RegisterEnum registers the names of the values of the integer type t.
+// When EnumAsString is set, values of type t are encoded as their names,
+// and values without a name as numbers.
+// When decoding into a value of type t, both names and numbers are accepted,
+// regardless of EnumAsString.
+//
+// Registering an enum resets the cache, so it should be done before
+// the JSON encoder/decoder is used. The registration is shared with
+// the copies of the JSON encoder/decoder that share its cache.
+func (j *JSON) RegisterEnum(t reflect.Type, names map[int64]string) {
+	if !isIntegerKind(t.Kind()) {
+		panic("json: RegisterEnum of non-integer type " + t.String())
+	}
+	en := &enumNames{
+		names:  make(map[int64]string, len(names)),
+		values: make(map[string]int64, len(names)),
+	}
+	for n, name := range names {
+		en.names[n] = name
+		en.values[name] = n
+	}
+	j.types.enums.Store(t, en)
+	atomic.StoreInt32(&j.types.hasEnums, 1)
+	j.resetCache()
+}
+
+// EnumAsString causes values of integer types registered with RegisterEnum,
+// or that have a Name() string method, to be encoded as JSON strings
+// containing their names.
+// Names returned by the Name method cannot be decoded, unless they are
+// registered with RegisterEnum too.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) EnumAsString() *JSON {
+	j2 := *j
+	j2.enumAsString = true
+	return &j2
+}
+
+// EnumAsString causes enum values to be encoded as JSON strings containing their names.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func EnumAsString() *JSON {
+	return defaultJSON.EnumAsString()
+}
+
+func isIntegerKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// enum returns the names registered for t, or nil.
+func (r *typeRegistry) enum(t reflect.Type) *enumNames {
+	if atomic.LoadInt32(&r.hasEnums) == 0 {
+		return nil
+	}
+	en, ok := r.enums.Load(t)
+	if !ok {
+		return nil
+	}
+	return en.(*enumNames)
+}
+
+type enumEncoder struct {
+	names    *enumNames
+	namer    bool
+	fallback encoderFunc
+}
+
+func (ee enumEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
+	if !opts.enumAsString {
+		ee.fallback(e, v, opts)
+		return
+	}
+	if ee.names != nil {
+		var n int64
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = v.Int()
+		default:
+			n = int64(v.Uint())
+		}
+		if name, ok := ee.names.names[n]; ok {
+			e.string(name, opts.escapeHTML)
+			return
+		}
+	}
+	if ee.namer {
+		e.string(v.Interface().(enumNamer).Name(), opts.escapeHTML)
+		return
+	}
+	ee.fallback(e, v, opts)
+}
+
+// newEnumEncoder returns an encoder for the integer type t if it is an enum,
+// or nil.
+func (c *JSON) newEnumEncoder(t reflect.Type) encoderFunc {
+	if !isIntegerKind(t.Kind()) {
+		return nil
+	}
+	ee := enumEncoder{
+		names: c.types.enum(t),
+		namer: t.Implements(enumNamerType),
+	}
+	if ee.names == nil && !ee.namer {
+		return nil
+	}
+	if t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uintptr {
+		ee.fallback = uintEncoder
+	} else {
+		ee.fallback = intEncoder
+	}
+	return ee.encode
+}
+
+// enumValue stores the value named s in v, if v's type is a registered enum
+// with such a name, and reports whether it did.
+func (d *decodeState) enumValue(s []byte, v reflect.Value) bool {
+	en := d.converter.types.enum(v.Type())
+	if en == nil {
+		return false
+	}
+	n, ok := en.values[string(s)]
+	if !ok {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(n)
+	default:
+		v.SetUint(uint64(n))
+	}
+	return true
+}
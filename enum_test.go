@@ -0,0 +1,110 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"reflect"
+	"testing"
+)
+
+type enumColor int
+
+const (
+	enumRed enumColor = iota
+	enumGreen
+	enumBlue
+)
+
+type enumSize uint8
+
+func (s enumSize) Name() string {
+	switch s {
+	case 0:
+		return "small"
+	case 1:
+		return "large"
+	}
+	return "unknown"
+}
+
+func newEnumJSON() *JSON {
+	j := New()
+	j.RegisterEnum(reflect.TypeOf(enumColor(0)), map[int64]string{
+		int64(enumRed):   "red",
+		int64(enumGreen): "green",
+		int64(enumBlue):  "blue",
+	})
+	return j
+}
+
+func TestEnumAsString(t *testing.T) {
+	type T struct {
+		Color  enumColor
+		Colors []enumColor
+		Ptr    *enumColor
+		Size   enumSize
+		Other  int
+	}
+	blue := enumBlue
+	v := T{Color: enumGreen, Colors: []enumColor{enumRed, 7}, Ptr: &blue, Size: 1, Other: 2}
+	j := newEnumJSON()
+
+	b, err := j.EnumAsString().Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"Color":"green","Colors":["red",7],"Ptr":"blue","Size":"large","Other":2}`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	// Without the option, enums are encoded as numbers.
+	b2, err := j.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"Color":1,"Colors":[0,7],"Ptr":2,"Size":1,"Other":2}`; string(b2) != expected {
+		t.Errorf("have: %s, want: %s", b2, expected)
+	}
+
+	// Both names and numbers decode.
+	var v2 T
+	if err := j.Unmarshal([]byte(`{"Color":"green","Colors":["red",7],"Ptr":"blue","Size":1,"Other":2}`), &v2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v2, v) {
+		t.Errorf("have: %+v, want: %+v", v2, v)
+	}
+	var v3 T
+	if err := j.Unmarshal(b2, &v3); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v3, v) {
+		t.Errorf("have: %+v, want: %+v", v3, v)
+	}
+}
+
+func TestEnumErrors(t *testing.T) {
+	j := newEnumJSON()
+	var c enumColor
+	if err := j.Unmarshal([]byte(`"purple"`), &c); err == nil {
+		t.Errorf("expected error for unknown name")
+	}
+	// Names returned by Name can't be decoded.
+	var s enumSize
+	if err := j.Unmarshal([]byte(`"large"`), &s); err == nil {
+		t.Errorf("expected error for unregistered enum")
+	}
+	// The default JSON encoder/decoder is not affected.
+	if err := Unmarshal([]byte(`"red"`), &c); err == nil {
+		t.Errorf("expected error for enum of default JSON")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic for non-integer type")
+		}
+	}()
+	j.RegisterEnum(reflect.TypeOf(""), nil)
+}
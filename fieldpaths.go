@@ -0,0 +1,126 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import "strings"
+
+// fieldPaths is a tree of dotted field paths, keyed by object key.
+// A nil subtree means that the path ends there and covers everything below it.
+type fieldPaths map[string]fieldPaths
+
+// newFieldPaths builds the tree of the dotted paths, or returns nil if
+// there are none.
+func newFieldPaths(paths []string) fieldPaths {
+	if len(paths) == 0 {
+		return nil
+	}
+	root := fieldPaths{}
+	for _, p := range paths {
+		node := root
+		keys := strings.Split(p, ".")
+		for i, key := range keys {
+			child, ok := node[key]
+			if ok && child == nil {
+				// A shorter path already covers this one.
+				break
+			}
+			if i == len(keys)-1 {
+				node[key] = nil
+				break
+			}
+			if !ok {
+				child = fieldPaths{}
+				node[key] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+// SelectFields specifies that only the struct fields at the given dotted
+// paths of object keys, such as "user.name", should be encoded.
+// Selecting a field selects all of its contents. The fields on the way
+// to a selected field are encoded with only their selected fields,
+// and all other fields are omitted.
+// The paths do not include array or slice indexes: a path selects the field
+// in every element. Map keys are not filtered.
+// Calling SelectFields again replaces the paths, and calling it with no paths
+// encodes all fields again.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) SelectFields(paths ...string) *JSON {
+	j2 := *j
+	j2.selectFields = newFieldPaths(paths)
+	return &j2
+}
+
+// SelectFields specifies that only the struct fields at the given dotted paths
+// should be encoded.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func SelectFields(paths ...string) *JSON {
+	return defaultJSON.SelectFields(paths...)
+}
+
+// ExcludeFields specifies that the struct fields at the given dotted
+// paths of object keys, such as "internal.token", should be omitted,
+// while all other fields are encoded.
+// Like with SelectFields, the paths do not include array or slice indexes,
+// and map keys are not filtered.
+// If both SelectFields and ExcludeFields are set, a field is encoded
+// only if it is selected and not excluded.
+// Calling ExcludeFields again replaces the paths.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) ExcludeFields(paths ...string) *JSON {
+	j2 := *j
+	j2.excludeFields = newFieldPaths(paths)
+	return &j2
+}
+
+// ExcludeFields specifies that the struct fields at the given dotted paths
+// should be omitted from encoding.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func ExcludeFields(paths ...string) *JSON {
+	return defaultJSON.ExcludeFields(paths...)
+}
+
+// AllowFields specifies that only the object keys at the given dotted paths,
+// such as "user.name", should be decoded into struct fields.
+// Other keys are ignored, even if they match a struct field,
+// or cause an error if StrictAllowFields is set.
+// Allowing a field allows all of its contents.
+// Like with SelectFields, the paths use the encoded names of the fields
+// and do not include array or slice indexes, and map keys are not filtered.
+// Calling AllowFields again replaces the paths, and calling it with no paths
+// allows all fields again.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) AllowFields(paths ...string) *JSON {
+	j2 := *j
+	j2.allowFields = newFieldPaths(paths)
+	return &j2
+}
+
+// AllowFields specifies that only the object keys at the given dotted paths
+// should be decoded into struct fields.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func AllowFields(paths ...string) *JSON {
+	return defaultJSON.AllowFields(paths...)
+}
+
+// StrictAllowFields causes the decoder to return an error when the input
+// contains object keys that are not allowed by AllowFields,
+// instead of ignoring them.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) StrictAllowFields() *JSON {
+	j2 := *j
+	j2.strictAllowFields = true
+	return &j2
+}
+
+// StrictAllowFields causes the decoder to return an error when the input
+// contains object keys that are not allowed by AllowFields.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func StrictAllowFields() *JSON {
+	return defaultJSON.StrictAllowFields()
+}
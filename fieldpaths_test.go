@@ -0,0 +1,209 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fieldPathsAddress struct {
+	City   string `json:"city"`
+	Street string `json:"street"`
+}
+
+type fieldPathsUser struct {
+	ID      int               `json:"id"`
+	Name    string            `json:"name"`
+	Email   string            `json:"email"`
+	Address fieldPathsAddress `json:"address"`
+}
+
+type fieldPathsResponse struct {
+	User    fieldPathsUser   `json:"user"`
+	Friends []fieldPathsUser `json:"friends"`
+	Total   int              `json:"total"`
+}
+
+var fieldPathsValue = fieldPathsResponse{
+	User: fieldPathsUser{
+		ID:      1,
+		Name:    "Alice",
+		Email:   "alice@example.com",
+		Address: fieldPathsAddress{City: "Paris", Street: "Main"},
+	},
+	Friends: []fieldPathsUser{
+		{ID: 2, Name: "Bob", Address: fieldPathsAddress{City: "Rome"}},
+		{ID: 3, Name: "Carol"},
+	},
+	Total: 2,
+}
+
+func TestSelectFields(t *testing.T) {
+	testCases := []struct {
+		paths    []string
+		expected string
+	}{
+		{
+			paths:    []string{"user.name", "user.id"},
+			expected: `{"user":{"id":1,"name":"Alice"}}`,
+		},
+		{
+			paths:    []string{"user.address.city", "total"},
+			expected: `{"user":{"address":{"city":"Paris"}},"total":2}`,
+		},
+		{
+			paths:    []string{"user.address", "user.address.city"},
+			expected: `{"user":{"address":{"city":"Paris","street":"Main"}}}`,
+		},
+		{
+			paths:    []string{"friends.name"},
+			expected: `{"friends":[{"name":"Bob"},{"name":"Carol"}]}`,
+		},
+		{
+			paths:    []string{"missing", "user.missing"},
+			expected: `{"user":{}}`,
+		},
+	}
+	for _, tc := range testCases {
+		b, err := SelectFields(tc.paths...).Marshal(fieldPathsValue)
+		if err != nil {
+			t.Errorf("%q: Marshal: %v", tc.paths, err)
+			continue
+		}
+		if string(b) != tc.expected {
+			t.Errorf("%q:\nhave: %s\nwant: %s", tc.paths, b, tc.expected)
+		}
+	}
+
+	// Calling SelectFields with no paths encodes all fields.
+	b, err := SelectFields("total").SelectFields().Marshal(fieldPathsValue.User.Address)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"city":"Paris","street":"Main"}`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+}
+
+type fieldPathsInternal struct {
+	Token   string `json:"token"`
+	Version int    `json:"version"`
+}
+
+type fieldPathsDocument struct {
+	Name     string               `json:"name"`
+	Internal fieldPathsInternal   `json:"internal"`
+	Items    []fieldPathsInternal `json:"items"`
+	Token    string               `json:"token"`
+}
+
+func TestExcludeFields(t *testing.T) {
+	v := fieldPathsDocument{
+		Name:     "doc",
+		Internal: fieldPathsInternal{Token: "secret", Version: 2},
+		Items:    []fieldPathsInternal{{Token: "a", Version: 1}},
+		Token:    "public",
+	}
+	testCases := []struct {
+		json     *JSON
+		expected string
+	}{
+		{
+			json:     ExcludeFields("internal.token"),
+			expected: `{"name":"doc","internal":{"version":2},"items":[{"token":"a","version":1}],"token":"public"}`,
+		},
+		{
+			json:     ExcludeFields("internal", "items.version"),
+			expected: `{"name":"doc","items":[{"token":"a"}],"token":"public"}`,
+		},
+		{
+			json:     ExcludeFields("internal.token").ExcludeFields(),
+			expected: `{"name":"doc","internal":{"token":"secret","version":2},"items":[{"token":"a","version":1}],"token":"public"}`,
+		},
+		{
+			json:     SelectFields("internal", "name").ExcludeFields("internal.token"),
+			expected: `{"name":"doc","internal":{"version":2}}`,
+		},
+	}
+	for i, tc := range testCases {
+		b, err := tc.json.Marshal(v)
+		if err != nil {
+			t.Errorf("#%d: Marshal: %v", i, err)
+			continue
+		}
+		if string(b) != tc.expected {
+			t.Errorf("#%d:\nhave: %s\nwant: %s", i, b, tc.expected)
+		}
+	}
+}
+
+type fieldPathsAccount struct {
+	Name  string            `json:"name"`
+	Admin bool              `json:"admin"`
+	Owner fieldPathsUser    `json:"owner"`
+	Users []fieldPathsUser  `json:"users"`
+	Meta  map[string]string `json:"meta"`
+}
+
+func TestAllowFields(t *testing.T) {
+	const data = `{
+		"name": "acme",
+		"admin": true,
+		"owner": {"id": 1, "name": "Alice", "email": "alice@example.com"},
+		"users": [{"id": 2, "name": "Bob"}, {"id": 3, "name": "Carol"}],
+		"meta": {"a": "b"},
+		"unknown": 1
+	}`
+
+	var v fieldPathsAccount
+	err := AllowFields("name", "owner.name", "users.id", "meta").Unmarshal([]byte(data), &v)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	expected := fieldPathsAccount{
+		Name:  "acme",
+		Owner: fieldPathsUser{Name: "Alice"},
+		Users: []fieldPathsUser{{ID: 2}, {ID: 3}},
+		Meta:  map[string]string{"a": "b"},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("have: %+v\nwant: %+v", v, expected)
+	}
+
+	// The decoder resets the allowed paths for each value.
+	dec := AllowFields("admin").NewDecoder(strings.NewReader(data + data))
+	for i := 0; i < 2; i++ {
+		var v fieldPathsAccount
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if expected := (fieldPathsAccount{Admin: true}); !reflect.DeepEqual(v, expected) {
+			t.Errorf("#%d: have: %+v\nwant: %+v", i, v, expected)
+		}
+	}
+
+	// StrictAllowFields reports disallowed keys, but still decodes the rest.
+	var v2 fieldPathsAccount
+	err = AllowFields("name", "unknown").StrictAllowFields().Unmarshal([]byte(data), &v2)
+	if err == nil || err.Error() != `json: disallowed field "admin"` {
+		t.Errorf("have error: %v", err)
+	}
+	if v2.Name != "acme" || v2.Admin {
+		t.Errorf("have: %+v", v2)
+	}
+
+	// Disallowed keys are not reported as unknown.
+	var v3 fieldPathsAccount
+	err = AllowFields("name", "unknown").DisallowUnknownFields().Unmarshal([]byte(data), &v3)
+	if err == nil || err.Error() != `json: unknown field "unknown"` {
+		t.Errorf("have error: %v", err)
+	}
+	err = AllowFields("name").DisallowUnknownFields().Unmarshal([]byte(`{"name":"x","unknown":1}`), &v3)
+	if err != nil {
+		t.Errorf("Unmarshal: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// FieldInfo describes a struct field as it is encoded and decoded.
+type FieldInfo struct {
+	Name      string       // object key, after applying the key encoding function
+	GoName    string       // Go name of the field
+	Index     []int        // index sequence for reflect.Value.FieldByIndex
+	Type      reflect.Type // type of the field
+	Tag       string       // value of the field's json tag, or of the configured tag key
+	Tagged    bool         // whether Name was set in the tag
+	OmitEmpty bool         // whether the omitempty tag option is set
+	Quoted    bool         // whether the string tag option is set and applies to Type
+	Redacted  bool         // whether the redact tag option is set
+	Required  bool         // whether the required tag option is set
+}
+
+// Fields returns the fields of the struct type t, or the struct type t points to,
+// in the order they are encoded, using the default JSON encoder/decoder.
+func Fields(t reflect.Type) ([]FieldInfo, error) {
+	return defaultJSON.Fields(t)
+}
+
+// Fields returns the fields of the struct type t, or the struct type t points to,
+// in the order they are encoded.
+// Fields of embedded structs are promoted following the same rules as when encoding.
+// If t is not a struct type, Fields returns an UnsupportedTypeError.
+func (c *JSON) Fields(t reflect.Type) ([]FieldInfo, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, &json.UnsupportedTypeError{Type: t}
+	}
+	fields := c.cachedTypeFields(t)
+	infos := make([]FieldInfo, len(fields.list))
+	for i := range fields.list {
+		infos[i] = c.fieldInfo(t, &fields.list[i])
+	}
+	return infos, nil
+}
+
+// fieldInfo returns the FieldInfo of the field f of the struct type t.
+func (c *JSON) fieldInfo(t reflect.Type, f *field) FieldInfo {
+	sf := t.FieldByIndex(f.index)
+	return FieldInfo{
+		Name:      f.name,
+		GoName:    f.goName,
+		Index:     append([]int(nil), f.index...),
+		Type:      sf.Type,
+		Tag:       c.fieldTag(sf.Tag),
+		Tagged:    f.tag,
+		OmitEmpty: f.omitEmpty,
+		Quoted:    f.quoted,
+		Redacted:  f.redact,
+		Required:  f.required,
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+type fieldsInner struct {
+	City string
+	Zip  string `json:"zip_code,omitempty"`
+}
+
+type fieldsOther struct {
+	City string
+	Zip  string
+}
+
+type FieldsEmbedded struct {
+	Country string
+}
+
+type fieldsOuter struct {
+	Name string
+	Age  *int `json:",string"`
+	fieldsInner
+	*FieldsEmbedded
+	Nested fieldsOther
+	Hidden string `json:"-"`
+	secret string
+}
+
+func TestFields(t *testing.T) {
+	j := New(KeyEncodeFn(func(s string) string {
+		r, z := utf8.DecodeRuneInString(s)
+		return string(unicode.ToLower(r)) + s[z:]
+	}))
+
+	fields, err := j.Fields(reflect.TypeOf(&fieldsOuter{}))
+	if err != nil {
+		t.Fatalf("Fields: %v", err)
+	}
+	expected := []FieldInfo{
+		{Name: "name", GoName: "Name", Index: []int{0}, Type: reflect.TypeOf("")},
+		{Name: "age", GoName: "Age", Index: []int{1}, Type: reflect.TypeOf((*int)(nil)), Tag: ",string", Quoted: true},
+		{Name: "city", GoName: "City", Index: []int{2, 0}, Type: reflect.TypeOf("")},
+		{Name: "zip_code", GoName: "Zip", Index: []int{2, 1}, Type: reflect.TypeOf(""), Tag: "zip_code,omitempty", Tagged: true, OmitEmpty: true},
+		{Name: "country", GoName: "Country", Index: []int{3, 0}, Type: reflect.TypeOf("")},
+		{Name: "nested", GoName: "Nested", Index: []int{4}, Type: reflect.TypeOf(fieldsOther{})},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("mismatch\nhave: %+v\nwant: %+v", fields, expected)
+	}
+
+	// The returned index can be used to access the field.
+	v := reflect.ValueOf(fieldsOuter{fieldsInner: fieldsInner{Zip: "12345"}})
+	if zip := v.FieldByIndex(fields[3].Index).String(); zip != "12345" {
+		t.Errorf("have: %v, want: 12345", zip)
+	}
+
+	// Modifying the result does not affect the cache.
+	fields[0].Index[0] = 42
+	fields, _ = j.Fields(reflect.TypeOf(fieldsOuter{}))
+	if fields[0].Index[0] != 0 {
+		t.Errorf("cached index was modified")
+	}
+}
+
+func TestFieldsConflict(t *testing.T) {
+	// Conflicting embedded fields at the same depth are dropped.
+	type T struct {
+		fieldsInner
+		fieldsOther
+	}
+	fields, err := Fields(reflect.TypeOf(T{}))
+	if err != nil {
+		t.Fatalf("Fields: %v", err)
+	}
+	var names []string
+	for _, f := range fields {
+		names = append(names, f.Name)
+	}
+	if expected := []string{"zip_code", "Zip"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("have: %v, want: %v", names, expected)
+	}
+}
+
+func TestFieldsNonStruct(t *testing.T) {
+	_, err := Fields(reflect.TypeOf(1))
+	if _, ok := err.(*json.UnsupportedTypeError); !ok {
+		t.Errorf("have: %v, want UnsupportedTypeError", err)
+	}
+}
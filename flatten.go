@@ -0,0 +1,190 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FlattenKeys causes nested objects and arrays to be encoded as a single,
+// flat object, whose keys are the paths to the values joined by sep.
+// For example, {"address":{"city":"Paris"},"items":[{"name":"a"}]} is encoded
+// as {"address.city":"Paris","items.0.name":"a"} with the separator ".".
+// Empty objects and arrays are kept as values.
+//
+// When decoding, the nesting is reconstructed from the keys before the
+// value is decoded. An object whose keys are exactly the indexes 0 to n-1
+// is reconstructed as an array.
+// Only top-level objects are flattened and reconstructed.
+// Calling FlattenKeys("") disables flattening.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) FlattenKeys(sep string) *JSON {
+	j2 := *j
+	j2.flattenSep = sep
+	return &j2
+}
+
+// FlattenKeys causes nested objects and arrays to be encoded as a single, flat object.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func FlattenKeys(sep string) *JSON {
+	return defaultJSON.FlattenKeys(sep)
+}
+
+// treeJSON is used to decode and encode the intermediate representation
+// of flattened objects, preserving numbers exactly.
+// It has its own type registry, so that the types registered
+// on other instances don't change the tree.
+var treeJSON = New().UseNumber()
+
+// flatten replaces the object encoded in e from offset start
+// with its flattened form.
+func (c *JSON) flatten(e *encodeState, start int, opts encOpts) {
+	b := e.Bytes()[start:]
+	if len(b) == 0 || b[0] != '{' {
+		return
+	}
+	var tree OrderedMap
+	if err := treeJSON.Unmarshal(b, &tree); err != nil {
+		e.error(err)
+	}
+	var flat OrderedMap
+	flattenValue(&flat, "", c.flattenSep, tree)
+	e.Truncate(start)
+	opts.valueHook = nil
+	c.reflectValue(e, reflect.ValueOf(flat), opts)
+}
+
+// flattenValue appends v, found at path, to flat, with the contents of
+// non-empty objects and arrays appended separately.
+func flattenValue(flat *OrderedMap, path, sep string, v interface{}) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + sep + key
+	}
+	switch v := v.(type) {
+	case OrderedMap:
+		if len(v) > 0 || path == "" {
+			for _, kv := range v {
+				flattenValue(flat, join(kv.Key), sep, kv.Value)
+			}
+			return
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			for i, elem := range v {
+				flattenValue(flat, join(strconv.Itoa(i)), sep, elem)
+			}
+			return
+		}
+	}
+	*flat = append(*flat, KeyValue{Key: path, Value: v})
+}
+
+// unflatten replaces d.data with the nested form of the flattened object it holds.
+// d.data may use the relaxed syntax enabled on d.converter.
+func (d *decodeState) unflatten() error {
+	i := d.off
+	for i < len(d.data) {
+		if isSpace(d.data[i]) {
+			i++
+		} else if n := commentLen(d.data[i:]); n > 0 {
+			i += n
+		} else {
+			break
+		}
+	}
+	if i == len(d.data) || d.data[i] != '{' {
+		return nil
+	}
+	v, err := d.converter.decodeTree(d.data[d.off:])
+	if err != nil {
+		return err
+	}
+	flat := v.(OrderedMap)
+	var tree OrderedMap
+	for _, kv := range flat {
+		var ok bool
+		tree, ok = unflattenValue(tree, strings.Split(kv.Key, d.converter.flattenSep), kv.Value)
+		if !ok {
+			return fmt.Errorf("json: flattened key %q conflicts with another key", kv.Key)
+		}
+	}
+	for i := range tree {
+		tree[i].Value = restoreArrays(tree[i].Value)
+	}
+	data, err := treeJSON.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	d.init(data)
+	return nil
+}
+
+// unflattenValue stores v in m at the path given by keys,
+// creating nested objects as needed.
+// It reports false if the path already holds a value, or passes through one,
+// such as when both "a" and "a.b" are set.
+func unflattenValue(m OrderedMap, keys []string, v interface{}) (OrderedMap, bool) {
+	child, exists := m.Get(keys[0])
+	if len(keys) == 1 {
+		if exists {
+			return m, false
+		}
+		m.Set(keys[0], v)
+		return m, true
+	}
+	cm, isMap := child.(OrderedMap)
+	if exists && !isMap {
+		return m, false
+	}
+	cm, ok := unflattenValue(cm, keys[1:], v)
+	if !ok {
+		return m, false
+	}
+	m.Set(keys[0], cm)
+	return m, true
+}
+
+// restoreArrays converts the objects in v whose keys are the indexes 0 to n-1
+// into arrays.
+func restoreArrays(v interface{}) interface{} {
+	m, ok := v.(OrderedMap)
+	if !ok {
+		return v
+	}
+	for i := range m {
+		m[i].Value = restoreArrays(m[i].Value)
+	}
+	if len(m) == 0 {
+		return m
+	}
+	indexes := make([]int, len(m))
+	for i, kv := range m {
+		n, err := strconv.Atoi(kv.Key)
+		if err != nil || n < 0 || strconv.Itoa(n) != kv.Key {
+			return m
+		}
+		indexes[i] = n
+	}
+	a := make([]interface{}, len(m))
+	order := make([]int, len(m))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return indexes[order[i]] < indexes[order[j]] })
+	for i, k := range order {
+		if indexes[k] != i {
+			return m
+		}
+		a[i] = m[k].Value
+	}
+	return a
+}
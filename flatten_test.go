@@ -0,0 +1,146 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type flatAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+type flatItem struct {
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+}
+
+type flatOrder struct {
+	ID      int               `json:"id"`
+	Address flatAddress       `json:"address"`
+	Items   []flatItem        `json:"items"`
+	Tags    []string          `json:"tags"`
+	Meta    map[string]string `json:"meta"`
+	Empty   []int             `json:"empty"`
+}
+
+func TestFlattenKeys(t *testing.T) {
+	v := flatOrder{
+		ID:      1,
+		Address: flatAddress{City: "Paris", Zip: "75001"},
+		Items:   []flatItem{{"a", 1.5}, {"b<c", 10}},
+		Tags:    []string{"x"},
+		Meta:    map[string]string{},
+		Empty:   []int{},
+	}
+	j := FlattenKeys(".")
+	b, err := j.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected := `{"id":1,"address.city":"Paris","address.zip":"75001",` +
+		`"items.0.name":"a","items.0.price":1.5,"items.1.name":"b\u003cc","items.1.price":10,` +
+		`"tags.0":"x","meta":{},"empty":[]}`
+	if string(b) != expected {
+		t.Errorf("have: %s\nwant: %s", b, expected)
+	}
+
+	var v2 flatOrder
+	if err := j.Unmarshal(b, &v2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v, v2) {
+		t.Errorf("round trip:\nhave: %+v\nwant: %+v", v2, v)
+	}
+
+	t.Run("separator", func(t *testing.T) {
+		b, err := FlattenKeys("/").Indent("", " ").Marshal(flatAddress{City: "Paris"})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if string(b) != "{\n \"city\": \"Paris\",\n \"zip\": \"\"\n}" {
+			t.Errorf("have: %s", b)
+		}
+		var m map[string]map[string]interface{}
+		if err := FlattenKeys("/").Unmarshal([]byte(`{"a/b":1,"a/c.d":2}`), &m); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if len(m["a"]) != 2 || m["a"]["c.d"] != 2.0 {
+			t.Errorf("have: %v", m)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := j.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		if !strings.Contains(buf.String(), `"items.1.name":"b<c"`) {
+			t.Errorf("have: %s", buf.String())
+		}
+		var v2 flatOrder
+		if err := j.NewDecoder(&buf).Decode(&v2); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if !reflect.DeepEqual(v, v2) {
+			t.Errorf("round trip:\nhave: %+v\nwant: %+v", v2, v)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		for _, in := range []string{
+			`{"a":1,"a.b":2}`,
+			`{"a.b":2,"a":1}`,
+			`{"x":0,"a.b.c":1,"a.b":2}`,
+			`{"a.b":[1],"a.b.0":2}`,
+		} {
+			var v interface{}
+			err := j.Unmarshal([]byte(in), &v)
+			if err == nil || !strings.Contains(err.Error(), "conflicts") {
+				t.Errorf("%s: have: %v, want conflict error", in, err)
+			}
+		}
+		var v interface{}
+		if err := j.Unmarshal([]byte(`{"a.b":1,"a.c":2,"ab":3}`), &v); err != nil {
+			t.Errorf("Unmarshal: %v", err)
+		}
+	})
+
+	t.Run("relaxed", func(t *testing.T) {
+		j := j.AllowComments().AllowTrailingCommas().AllowSingleQuotes()
+		expected := map[string]interface{}{"a": map[string]interface{}{"b": 1.0, "c": "x"}}
+		for _, in := range []string{
+			`{"a.b": 1 /* c */, "a.c": "x"}`,
+			`{"a.b": 1, "a.c": "x",}`,
+			`// hdr
+{'a.b': 1, "a.c": 'x'}`,
+		} {
+			var v interface{}
+			if err := j.Unmarshal([]byte(in), &v); err != nil {
+				t.Errorf("%s: Unmarshal: %v", in, err)
+				continue
+			}
+			if !reflect.DeepEqual(v, expected) {
+				t.Errorf("%s: have: %v, want: %v", in, v, expected)
+			}
+		}
+	})
+
+	t.Run("not an object", func(t *testing.T) {
+		b, err := j.Marshal([]flatAddress{{City: "a"}})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if string(b) != `[{"city":"a","zip":""}]` {
+			t.Errorf("have: %s", b)
+		}
+	})
+}
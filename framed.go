@@ -0,0 +1,75 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// frameHeaderLen is the length of the big-endian length prefix of a frame.
+const frameHeaderLen = 4
+
+// WriteFramed writes the compact JSON encoding of v to w as a single frame:
+// a 4-byte big-endian length followed by that many bytes of JSON,
+// with no trailing newline. The frame is written with a single call to w.Write,
+// and w is flushed afterwards if it has a Flush method.
+// Indentation configured on c is ignored.
+func (c *JSON) WriteFramed(w io.Writer, v interface{}) error {
+	buf, err := c.Indent("", "").MarshalAppend(make([]byte, frameHeaderLen, 512), v)
+	if err != nil {
+		return err
+	}
+	n := len(buf) - frameHeaderLen
+	if uint64(n) > math.MaxUint32 {
+		return errors.New("json: framed value too large")
+	}
+	binary.BigEndian.PutUint32(buf, uint32(n))
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	return flushWriter(w)
+}
+
+// WriteFramed writes the compact JSON encoding of v to w as a frame
+// prefixed by its 4-byte big-endian length, using the default JSON encoder.
+func WriteFramed(w io.Writer, v interface{}) error {
+	return defaultJSON.WriteFramed(w, v)
+}
+
+// ReadFramed reads a frame written by WriteFramed from r and stores the JSON
+// value it contains in the value pointed to by v.
+// It returns io.EOF if r is at the end of its input before the frame,
+// and io.ErrUnexpectedEOF if the input ends inside the frame.
+// ReadFramed doesn't read beyond the end of the frame.
+//
+// See the documentation for Unmarshal for details about
+// the conversion of JSON into a Go value.
+func (c *JSON) ReadFramed(r io.Reader, v interface{}) error {
+	var header [frameHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	n := int64(binary.BigEndian.Uint32(header[:]))
+	// Let the buffer grow as the data arrives instead of trusting the length.
+	var buf bytes.Buffer
+	m, err := buf.ReadFrom(io.LimitReader(r, n))
+	if err != nil {
+		return err
+	}
+	if m < n {
+		return io.ErrUnexpectedEOF
+	}
+	return c.Unmarshal(buf.Bytes(), v)
+}
+
+// ReadFramed reads a frame written by WriteFramed from r and stores the JSON
+// value it contains in the value pointed to by v, using the default JSON decoder.
+func ReadFramed(r io.Reader, v interface{}) error {
+	return defaultJSON.ReadFramed(r, v)
+}
@@ -0,0 +1,83 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestFramedRoundTrip(t *testing.T) {
+	values := []interface{}{
+		map[string]interface{}{"a": []interface{}{1.0, "b"}, "c": nil},
+		"line\nbreak",
+		12.5,
+		[]interface{}{},
+		true,
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		enc := Indent("", "  ")
+		for _, v := range values {
+			if err := enc.WriteFramed(w, v); err != nil {
+				w.CloseWithError(err)
+				return
+			}
+		}
+		w.Close()
+	}()
+
+	for i, want := range values {
+		var v interface{}
+		if err := ReadFramed(r, &v); err != nil {
+			t.Fatalf("ReadFramed #%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(v, want) {
+			t.Errorf("#%d: have: %#v, want: %#v", i, v, want)
+		}
+	}
+	var v interface{}
+	if err := ReadFramed(r, &v); err != io.EOF {
+		t.Errorf("have: %v, want: %v", err, io.EOF)
+	}
+}
+
+func TestFramedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFramed(&buf, map[string]int{"a": 1}); err != nil {
+		t.Fatalf("WriteFramed: %v", err)
+	}
+	expected := append([]byte{0, 0, 0, 7}, `{"a":1}`...)
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("have: %q, want: %q", buf.Bytes(), expected)
+	}
+
+	// ReadFramed doesn't read past the frame.
+	buf.WriteString("rest")
+	var m map[string]int
+	if err := ReadFramed(&buf, &m); err != nil {
+		t.Fatalf("ReadFramed: %v", err)
+	}
+	if m["a"] != 1 || buf.String() != "rest" {
+		t.Errorf("have: %v, remaining %q", m, buf.String())
+	}
+
+	var v interface{}
+	for _, in := range [][]byte{{0, 0}, {0, 0, 0, 7, '{'}} {
+		if err := ReadFramed(bytes.NewReader(in), &v); err != io.ErrUnexpectedEOF {
+			t.Errorf("%q: have: %v, want: %v", in, err, io.ErrUnexpectedEOF)
+		}
+	}
+	// A huge length doesn't allocate before the data arrives.
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, 1<<32-1)
+	if err := ReadFramed(bytes.NewReader(header), &v); err != io.ErrUnexpectedEOF {
+		t.Errorf("have: %v, want: %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// defaultGzipMaxSize is the default limit on the decompressed size of
+// the data passed to UnmarshalGzip.
+const defaultGzipMaxSize = 64 << 20
+
+// GzipLevel sets the compression level used by MarshalGzip, such as
+// gzip.BestSpeed or gzip.BestCompression. By default,
+// gzip.DefaultCompression is used.
+// An invalid level causes MarshalGzip to return an error.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) GzipLevel(level int) *JSON {
+	j2 := *j
+	j2.gzipLevel = level
+	j2.hasGzipLevel = true
+	return &j2
+}
+
+// GzipLevel sets the compression level used by MarshalGzip.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func GzipLevel(level int) *JSON {
+	return defaultJSON.GzipLevel(level)
+}
+
+// GzipMaxSize limits the size of the decompressed JSON accepted by
+// UnmarshalGzip to n bytes, so that a small input can't decompress
+// to more data than the program can hold. Larger data is rejected
+// with a *LimitError. The default limit is 64 MiB.
+// If n is not positive, the size is not limited.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) GzipMaxSize(n int) *JSON {
+	j2 := *j
+	j2.gzipMaxSize = n
+	j2.hasGzipMaxSize = true
+	return &j2
+}
+
+// GzipMaxSize limits the size of the decompressed JSON accepted by UnmarshalGzip.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func GzipMaxSize(n int) *JSON {
+	return defaultJSON.GzipMaxSize(n)
+}
+
+// MarshalGzip returns the gzip-compressed JSON encoding of v.
+// The encoding is the same as the one returned by Marshal.
+func (c *JSON) MarshalGzip(v interface{}) ([]byte, error) {
+	b, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	level := gzip.DefaultCompression
+	if c.hasGzipLevel {
+		level = c.gzipLevel
+	}
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalGzip returns the gzip-compressed JSON encoding of v
+// using the default JSON encoder.
+func MarshalGzip(v interface{}) ([]byte, error) {
+	return defaultJSON.MarshalGzip(v)
+}
+
+// UnmarshalGzip decompresses the gzip-compressed data and
+// unmarshals the JSON it contains into the value pointed to by v,
+// like Unmarshal. The decompressed size is limited by GzipMaxSize.
+func (c *JSON) UnmarshalGzip(data []byte, v interface{}) error {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	max := defaultGzipMaxSize
+	if c.hasGzipMaxSize {
+		max = c.gzipMaxSize
+	}
+	var r io.Reader = zr
+	if max > 0 {
+		// Read one byte more than allowed to detect larger data.
+		r = io.LimitReader(zr, int64(max)+1)
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+	if max > 0 && buf.Len() > max {
+		return &LimitError{Limit: "decompressed size", Max: max, Offset: int64(max)}
+	}
+	if err := zr.Close(); err != nil {
+		return err
+	}
+	return c.Unmarshal(buf.Bytes(), v)
+}
+
+// UnmarshalGzip decompresses the gzip-compressed data and unmarshals
+// the JSON it contains into the value pointed to by v
+// using the default JSON decoder.
+func UnmarshalGzip(data []byte, v interface{}) error {
+	return defaultJSON.UnmarshalGzip(data, v)
+}
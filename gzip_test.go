@@ -0,0 +1,124 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGzipRoundTrip(t *testing.T) {
+	type Item struct {
+		Name  string `json:"name"`
+		Count int    `json:"count,omitempty"`
+	}
+	items := make([]Item, 100)
+	for i := range items {
+		items[i] = Item{Name: strings.Repeat("item", 10), Count: i % 3}
+	}
+
+	c := OmitEmpty()
+	for _, level := range []int{gzip.NoCompression, gzip.BestSpeed, gzip.BestCompression, gzip.HuffmanOnly} {
+		z, err := c.GzipLevel(level).MarshalGzip(items)
+		if err != nil {
+			t.Fatalf("level %d: MarshalGzip: %v", level, err)
+		}
+		var v []Item
+		if err := c.UnmarshalGzip(z, &v); err != nil {
+			t.Fatalf("level %d: UnmarshalGzip: %v", level, err)
+		}
+		if !reflect.DeepEqual(v, items) {
+			t.Errorf("level %d: have: %v, want: %v", level, v, items)
+		}
+	}
+
+	b, err := Marshal(items)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	z, err := MarshalGzip(items)
+	if err != nil {
+		t.Fatalf("MarshalGzip: %v", err)
+	}
+	if len(z) >= len(b)/10 {
+		t.Errorf("compressed length %d, uncompressed %d", len(z), len(b))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(z))
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(zr); err != nil {
+		t.Fatalf("ReadFrom: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), b) {
+		t.Errorf("have: %s, want: %s", buf.Bytes(), b)
+	}
+}
+
+func TestGzipOptions(t *testing.T) {
+	z, err := OmitEmpty().MarshalGzip(struct{ A, B string }{B: "b"})
+	if err != nil {
+		t.Fatalf("MarshalGzip: %v", err)
+	}
+	var m map[string]interface{}
+	if err := UnmarshalGzip(z, &m); err != nil {
+		t.Fatalf("UnmarshalGzip: %v", err)
+	}
+	if expected := map[string]interface{}{"B": "b"}; !reflect.DeepEqual(m, expected) {
+		t.Errorf("have: %v, want: %v", m, expected)
+	}
+
+	var v struct{ A string }
+	if err := DisallowUnknownFields().UnmarshalGzip(z, &v); err == nil {
+		t.Error("expected unknown field error")
+	}
+	if _, err := GzipLevel(42).MarshalGzip(1); err == nil {
+		t.Error("expected invalid level error")
+	}
+	if err := UnmarshalGzip([]byte(`{"B":"not compressed"}`), &m); err != gzip.ErrHeader {
+		t.Errorf("have: %v, want: %v", err, gzip.ErrHeader)
+	}
+}
+
+func TestGzipMaxSize(t *testing.T) {
+	z, err := MarshalGzip(strings.Repeat("x", 98))
+	if err != nil {
+		t.Fatalf("MarshalGzip: %v", err)
+	}
+	var s string
+	if err := GzipMaxSize(100).UnmarshalGzip(z, &s); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+	err = GzipMaxSize(99).UnmarshalGzip(z, &s)
+	if le, ok := err.(*LimitError); !ok || le.Limit != "decompressed size" || le.Max != 99 {
+		t.Errorf("have: %v, want LimitError", err)
+	}
+	if err := GzipMaxSize(0).GzipMaxSize(-1).UnmarshalGzip(z, &s); err != nil {
+		t.Errorf("without a limit: %v", err)
+	}
+
+	// A small input that decompresses to more than the default limit.
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write([]byte("["))
+	chunk := bytes.Repeat([]byte(" "), 1<<20)
+	for i := 0; i < 65; i++ {
+		zw.Write(chunk)
+	}
+	zw.Write([]byte("]"))
+	zw.Close()
+	if buf.Len() > 1<<20 {
+		t.Fatalf("compressed length %d", buf.Len())
+	}
+	var v []int
+	err = UnmarshalGzip(buf.Bytes(), &v)
+	if le, ok := err.(*LimitError); !ok || le.Max != 64<<20 {
+		t.Errorf("have: %v, want LimitError", err)
+	}
+}
@@ -8,6 +8,70 @@ import (
 	"bytes"
 )
 
+// Compact appends to dst the JSON-encoded src with
+// insignificant space characters elided.
+// Problematic HTML characters inside JSON quoted strings are escaped
+// unless escaping has been disabled with EscapeHTML(false).
+func (c *JSON) Compact(dst *bytes.Buffer, src []byte) error {
+	return compact(dst, src, !c.dontEscapeHTML)
+}
+
+// Compact appends to dst the JSON-encoded src with
+// insignificant space characters elided,
+// escaping problematic HTML characters inside JSON quoted strings.
+func Compact(dst *bytes.Buffer, src []byte) error {
+	return defaultJSON.Compact(dst, src)
+}
+
+// HTMLEscape appends to dst the JSON-encoded src with <, >, & characters
+// inside string literals changed to \u003c, \u003e, \u0026,
+// the same way the encoder escapes them, unless escaping has been disabled
+// with EscapeHTML(false).
+// U+2028 and U+2029 characters are always changed to \u2028 and \u2029,
+// because the encoder escapes them unconditionally.
+func (c *JSON) HTMLEscape(dst *bytes.Buffer, src []byte) {
+	htmlEscape(dst, src, !c.dontEscapeHTML)
+}
+
+// HTMLEscape appends to dst the JSON-encoded src with <, >, &, U+2028 and U+2029
+// characters inside string literals changed to \u003c, \u003e, \u0026, \u2028, \u2029
+// so that the JSON will be safe to embed inside HTML <script> tags.
+// For historical reasons, web browsers don't honor standard HTML
+// escaping within <script> tags, so an alternative JSON encoding must
+// be used.
+func HTMLEscape(dst *bytes.Buffer, src []byte) {
+	defaultJSON.HTMLEscape(dst, src)
+}
+
+func htmlEscape(dst *bytes.Buffer, src []byte, escapeHTML bool) {
+	// The characters can only appear in string literals,
+	// so just scan the string one byte at a time.
+	start := 0
+	for i, c := range src {
+		if escapeHTML && (c == '<' || c == '>' || c == '&') {
+			if start < i {
+				dst.Write(src[start:i])
+			}
+			dst.WriteString(`\u00`)
+			dst.WriteByte(hex[c>>4])
+			dst.WriteByte(hex[c&0xF])
+			start = i + 1
+		}
+		// Convert U+2028 and U+2029 (E2 80 A8 and E2 80 A9).
+		if c == 0xE2 && i+2 < len(src) && src[i+1] == 0x80 && src[i+2]&^1 == 0xA8 {
+			if start < i {
+				dst.Write(src[start:i])
+			}
+			dst.WriteString(`\u202`)
+			dst.WriteByte(hex[src[i+2]&0xF])
+			start = i + 3
+		}
+	}
+	if start < len(src) {
+		dst.Write(src[start:])
+	}
+}
+
 func compact(dst *bytes.Buffer, src []byte, escape bool) error {
 	origLen := dst.Len()
 	scan := newScanner()
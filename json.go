@@ -4,24 +4,97 @@
 
 package jsonx
 
-import "sync"
+import (
+	"encoding/base64"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
 
 // JSON is a json encoder/decoder.
 // It is safe for concurrent use by multiple goroutines.
 type JSON struct {
 	// keyEncodeFn is applied to struct field names to create object keys.
-	keyEncodeFn           func(string) string
+	keyEncodeFn func(string) string
+	// keyEncodeFnContext is like keyEncodeFn, but also receives the struct type and tag.
+	keyEncodeFnContext func(name string, parentType reflect.Type, tag reflect.StructTag) string
+	// keyNamer encodes struct field names and matches object keys to them.
+	keyNamer KeyNamer
+	// tagKeys are the struct tag keys to read field options from, in order.
+	// If empty, the json tag is used.
+	tagKeys []string
+	// nestEmbedded disables the promotion of embedded struct fields.
+	nestEmbedded bool
+	// keyDecodeFn is applied to object keys to match them to struct field names.
+	keyDecodeFn           func(string) string
 	fieldCache            *sync.Map // map[reflect.Type]structFields
 	encoderCache          *sync.Map // map[reflect.Type]encoderFunc
+	types                 *typeRegistry
 	omitEmpty             bool
+	omitEmptyStructs      bool
+	isEmptyFn             func(v reflect.Value) bool
 	useNumber             bool
+	numberType            bool
+	decimalMode           bool
 	disallowUnknownFields bool
+	caseSensitive         bool
+	scalarOrArray         bool
+	coerceScalars         bool
+	autoUnquoteNumbers    bool
 	dontEscapeHTML        bool
+	escapeSet             *runeSet
+	rejectInvalidUTF8     bool
+	strictStringTag       bool
+	floatMode             FloatMode
+	specialFloats         SpecialFloatMode
+	lenientNumbers        bool
+	disallowDuplicateKeys bool
+	mergeDecode           bool
+	replaceDecode         bool
+	mapKeyCompare         func(a, b string) int
+	emptyAsNull           bool
+	nilAsEmpty            bool
+	timeFormat            string
+	decoderBufferSize     int
+	maxDepth              int
+	maxStringLen          int
+	maxObjectKeys         int
+	maxInterfaceDepth     int
+	registeredTypesOnly   bool
+	allowTrailingCommas   bool
+	allowComments         bool
+	allowSingleQuotes     bool
+	allowUnquotedKeys     bool
+	allowExtendedNumbers  bool
+	decodeFieldHook       func(field FieldInfo, raw []byte) ([]byte, error)
+	encodeValueHook       func(path string, v reflect.Value) (interface{}, bool)
+	showRedacted          bool
+	injectDiscriminators  bool
+	enumAsString          bool
+	bytesFormat           bytesFormat
+	base64Encoding        *base64.Encoding
+	selectFields          fieldPaths
+	excludeFields         fieldPaths
+	allowFields           fieldPaths
+	strictAllowFields     bool
+	flattenSep            string
+	indentPrefix          string
+	indentValue           string
+	gzipLevel             int
+	hasGzipLevel          bool
+	gzipMaxSize           int
+	hasGzipMaxSize        bool
+	canonical             bool
+	sortMapKeys           bool
+	strictFloat32         bool
+	durationAsString      bool
+	errorsAsString        bool
 }
 
 var defaultJSON = &JSON{
 	fieldCache:   &sync.Map{},
 	encoderCache: &sync.Map{},
+	types:        &typeRegistry{},
 }
 
 // Options are used to customize a JSON encoder/decoder.
@@ -29,8 +102,28 @@ type Options interface {
 	// SetKeyEncodeFn sets the function that is applied to struct field names
 	// to create object keys when marshaling.
 	// It is also used to match incoming object keys to struct fields when unmarshaling,
-	// by encoding the struct fields and then matching them case insensitively.
+	// by encoding the struct fields and then matching them case insensitively,
+	// unless a key decoding function is also set.
 	SetKeyEncodeFn(func(string) string)
+	// SetKeyEncodeFnContext is like SetKeyEncodeFn, but the function also receives
+	// the type of the struct that declares the field and the field's tag.
+	// It takes precedence over the function set by SetKeyEncodeFn.
+	SetKeyEncodeFnContext(func(name string, parentType reflect.Type, tag reflect.StructTag) string)
+	// SetKeyDecodeFn sets the function that is applied to incoming object keys
+	// when unmarshaling. The result is matched against the Go names
+	// of struct fields that do not have a name set in their json tag.
+	SetKeyDecodeFn(func(string) string)
+	// SetKeyNamer sets a KeyNamer, which is used to create object keys from
+	// struct field names when marshaling, and to match incoming object keys
+	// to the Go names of untagged struct fields when unmarshaling.
+	// It takes precedence over the function set by SetKeyEncodeFn.
+	SetKeyNamer(KeyNamer)
+	// SetTagKeys sets the struct tag keys that field names and options
+	// are read from. The first key that is present in a field's tag is used.
+	SetTagKeys(keys ...string)
+	// SetNestEmbedded sets whether embedded structs are encoded
+	// as nested objects instead of promoting their fields.
+	SetNestEmbedded(bool)
 }
 
 // Option is a JSON encoder/decoder option.
@@ -44,6 +137,26 @@ func (w *jsonOptionWrapper) SetKeyEncodeFn(fn func(string) string) {
 	w.json.keyEncodeFn = fn
 }
 
+func (w *jsonOptionWrapper) SetKeyEncodeFnContext(fn func(name string, parentType reflect.Type, tag reflect.StructTag) string) {
+	w.json.keyEncodeFnContext = fn
+}
+
+func (w *jsonOptionWrapper) SetKeyNamer(n KeyNamer) {
+	w.json.keyNamer = n
+}
+
+func (w *jsonOptionWrapper) SetKeyDecodeFn(fn func(string) string) {
+	w.json.keyDecodeFn = fn
+}
+
+func (w *jsonOptionWrapper) SetTagKeys(keys ...string) {
+	w.json.tagKeys = keys
+}
+
+func (w *jsonOptionWrapper) SetNestEmbedded(nest bool) {
+	w.json.nestEmbedded = nest
+}
+
 // KeyEncodeFn sets the key encoding function
 // when creating a new JSON encoder/decoder.
 func KeyEncodeFn(fn func(string) string) Option {
@@ -52,16 +165,91 @@ func KeyEncodeFn(fn func(string) string) Option {
 	}
 }
 
+// KeyEncodeFnContext sets a key encoding function that also receives
+// the type of the struct that declares the field and the field's tag,
+// when creating a new JSON encoder/decoder.
+// For fields promoted from an embedded struct, parentType is the embedded struct.
+// It takes precedence over KeyEncodeFn.
+func KeyEncodeFnContext(fn func(name string, parentType reflect.Type, tag reflect.StructTag) string) Option {
+	return func(opt Options) {
+		opt.SetKeyEncodeFnContext(fn)
+	}
+}
+
+// KeyDecodeFn sets the key decoding function
+// when creating a new JSON encoder/decoder.
+func KeyDecodeFn(fn func(string) string) Option {
+	return func(opt Options) {
+		opt.SetKeyDecodeFn(fn)
+	}
+}
+
+// A KeyNamer converts struct field names to object keys and back.
+type KeyNamer interface {
+	// Encode returns the object key for the Go field name.
+	Encode(fieldName string) string
+	// Match reports whether the object key refers to the Go field name.
+	Match(jsonKey, fieldName string) bool
+}
+
+// KeyNaming sets the KeyNamer when creating a new JSON encoder/decoder.
+// Object keys are first matched to field names exactly, then using the
+// Match method of n. Set a key decoding function instead
+// if the keys can be converted to field names directly.
+func KeyNaming(n KeyNamer) Option {
+	return func(opt Options) {
+		opt.SetKeyNamer(n)
+	}
+}
+
+// TagKey sets the struct tag key that field names and options are read from
+// when creating a new JSON encoder/decoder, instead of "json".
+// If fallback is true, the json tag is used for fields that
+// do not have a tag with the given key.
+func TagKey(name string, fallback bool) Option {
+	return func(opt Options) {
+		if fallback && name != "json" {
+			opt.SetTagKeys(name, "json")
+		} else {
+			opt.SetTagKeys(name)
+		}
+	}
+}
+
+// TagKeys sets the struct tag keys that field names and options are read from
+// when creating a new JSON encoder/decoder, instead of "json".
+// The keys are consulted in order, and the first one that is present
+// in a field's tag is used, even if its value is empty.
+// Fields that have none of the tags use the default name and options.
+func TagKeys(names ...string) Option {
+	return func(opt Options) {
+		opt.SetTagKeys(names...)
+	}
+}
+
+// NestEmbedded causes embedded structs to be treated like regular fields
+// when creating a new JSON encoder/decoder: instead of promoting their fields,
+// they are encoded as nested objects, keyed by the type name
+// after applying the key encoding function.
+// Embedded structs of unexported types are ignored, like unexported fields.
+func NestEmbedded() Option {
+	return func(opt Options) {
+		opt.SetNestEmbedded(true)
+	}
+}
+
 // New creates a new JSON encoder/decoder.
 //
 // The encoder has an internal cache,
 // so it should be reused for best performance.
-// Changing the key encoding function is not possible
-// because it would require invalidating the cache.
+// The key encoding function cannot be changed on an existing
+// JSON encoder/decoder because it would require invalidating the cache;
+// use WithKeyEncodeFn to create a copy with a different one.
 func New(opts ...Option) *JSON {
 	json := &JSON{
 		fieldCache:   &sync.Map{},
 		encoderCache: &sync.Map{},
+		types:        &typeRegistry{},
 	}
 	w := &jsonOptionWrapper{json: json}
 	for _, opt := range opts {
@@ -70,6 +258,174 @@ func New(opts ...Option) *JSON {
 	return json
 }
 
+// typeRegistry holds the encoders and decoders registered for specific types.
+type typeRegistry struct {
+	encoders sync.Map // map[reflect.Type]func(interface{}) ([]byte, error)
+	decoders sync.Map // map[reflect.Type]func([]byte, interface{}) error
+	// hasDecoders is set to 1 when the first decoder is registered,
+	// so that decoding can skip the lookup if there are none.
+	hasDecoders int32
+
+	discriminators    sync.Map // map[string]map[string]reflect.Type
+	hasDiscriminators int32
+	// discriminatorValues maps the registered types to their discriminators.
+	discriminatorValues sync.Map // map[reflect.Type]discriminatorValue
+	discriminatorMu     sync.Mutex
+
+	enums    sync.Map // map[reflect.Type]*enumNames
+	hasEnums int32
+}
+
+// discriminatorValue is the discriminator field and value of a registered type.
+type discriminatorValue struct {
+	field, value string
+}
+
+// RegisterTypeEncoder registers fn as the function used to encode values of type t,
+// taking precedence over MarshalJSON and MarshalText methods.
+// fn is called with the value to encode and must return valid JSON,
+// which is compacted and escaped like the output of MarshalJSON.
+//
+// Registering an encoder resets the cache, so it should be done before
+// the JSON encoder/decoder is used. The registration is shared with
+// the copies of the JSON encoder/decoder that share its cache.
+func (j *JSON) RegisterTypeEncoder(t reflect.Type, fn func(v interface{}) ([]byte, error)) {
+	j.types.encoders.Store(t, fn)
+	j.resetCache()
+}
+
+// RegisterTypeDecoder registers fn as the function used to decode JSON values
+// into values of type t, taking precedence over UnmarshalJSON and UnmarshalText methods.
+// fn is called with the raw JSON value, including the JSON null literal,
+// and a pointer to the value of type t that it should store the result in.
+//
+// The registration is shared with the copies of the JSON encoder/decoder
+// that share its cache.
+func (j *JSON) RegisterTypeDecoder(t reflect.Type, fn func(data []byte, v interface{}) error) {
+	j.types.decoders.Store(t, fn)
+	atomic.StoreInt32(&j.types.hasDecoders, 1)
+}
+
+// RegisterDiscriminator registers the object key field as a discriminator
+// for decoding into interface values: an object whose field member
+// is a string found in mapping is decoded into a new value of the mapped type,
+// instead of a map[string]interface{}. Other objects are decoded as usual.
+// Decoding into a non-empty interface type is only possible for objects with
+// a discriminator, and the mapped type must implement the interface.
+// If an object contains more than one registered discriminator field,
+// the first one with a mapped value is used.
+//
+// For example, with RegisterDiscriminator("type", map[string]reflect.Type{"cat": reflect.TypeOf(Cat{})}),
+// the object {"type":"cat","name":"Tom"} is decoded as a Cat. Map to a pointer
+// type to get pointers instead.
+//
+// The registration is also used by InjectDiscriminators when encoding.
+//
+// Registering the same field again replaces its mapping.
+// The registration is shared with the copies of the JSON encoder/decoder
+// that share its cache.
+func (j *JSON) RegisterDiscriminator(field string, mapping map[string]reflect.Type) {
+	types := j.types
+	types.discriminatorMu.Lock()
+	defer types.discriminatorMu.Unlock()
+	if old, ok := types.discriminators.Load(field); ok {
+		for _, t := range old.(map[string]reflect.Type) {
+			types.discriminatorValues.Delete(t)
+		}
+	}
+	m := make(map[string]reflect.Type, len(mapping))
+	for k, t := range mapping {
+		m[k] = t
+		types.discriminatorValues.Store(t, discriminatorValue{field, k})
+	}
+	types.discriminators.Store(field, m)
+	atomic.StoreInt32(&types.hasDiscriminators, 1)
+}
+
+// discriminator returns the discriminator registered for the struct type t,
+// or for a pointer to it.
+func (r *typeRegistry) discriminator(t reflect.Type) (discriminatorValue, bool) {
+	if atomic.LoadInt32(&r.hasDiscriminators) == 0 {
+		return discriminatorValue{}, false
+	}
+	dv, ok := r.discriminatorValues.Load(t)
+	if !ok {
+		dv, ok = r.discriminatorValues.Load(reflect.PtrTo(t))
+	}
+	if !ok {
+		return discriminatorValue{}, false
+	}
+	return dv.(discriminatorValue), true
+}
+
+// resetCache removes all entries from the caches.
+func (j *JSON) resetCache() {
+	for _, cache := range []*sync.Map{j.fieldCache, j.encoderCache} {
+		cache.Range(func(key, _ interface{}) bool {
+			cache.Delete(key)
+			return true
+		})
+	}
+}
+
+// Clone returns a copy of the JSON encoder/decoder with the same options
+// and registered type encoders, decoders, discriminators and enums, but with its own, empty cache.
+//
+// Methods that set an option, like OmitEmpty, return copies that share
+// the original's cache and type registrations, which is what you want
+// in most cases. Use Clone when the copy has to be independent:
+// types registered on the clone with RegisterTypeEncoder or
+// RegisterTypeDecoder don't affect the original, and vice versa.
+func (j *JSON) Clone() *JSON {
+	j2 := *j
+	j2.fieldCache = &sync.Map{}
+	j2.encoderCache = &sync.Map{}
+	j2.types = &typeRegistry{}
+	j.types.encoders.Range(func(key, value interface{}) bool {
+		j2.types.encoders.Store(key, value)
+		return true
+	})
+	j.types.decoders.Range(func(key, value interface{}) bool {
+		j2.types.decoders.Store(key, value)
+		return true
+	})
+	j2.types.hasDecoders = atomic.LoadInt32(&j.types.hasDecoders)
+	j.types.discriminators.Range(func(key, value interface{}) bool {
+		j2.types.discriminators.Store(key, value)
+		return true
+	})
+	j.types.discriminatorValues.Range(func(key, value interface{}) bool {
+		j2.types.discriminatorValues.Store(key, value)
+		return true
+	})
+	j2.types.hasDiscriminators = atomic.LoadInt32(&j.types.hasDiscriminators)
+	j.types.enums.Range(func(key, value interface{}) bool {
+		j2.types.enums.Store(key, value)
+		return true
+	})
+	j2.types.hasEnums = atomic.LoadInt32(&j.types.hasEnums)
+	return &j2
+}
+
+// WithKeyEncodeFn returns a clone of the JSON encoder/decoder that uses fn
+// as its key encoding function, see KeyEncodeFn.
+// A function set by KeyEncodeFnContext and a KeyNamer are removed.
+// Since the cached fields depend on the key encoding function, the clone has
+// its own cache, like one returned by Clone, and the original is unaffected.
+func (j *JSON) WithKeyEncodeFn(fn func(string) string) *JSON {
+	j2 := j.Clone()
+	j2.keyEncodeFn = fn
+	j2.keyEncodeFnContext = nil
+	j2.keyNamer = nil
+	return j2
+}
+
+// WithKeyEncodeFn returns a clone of the default JSON encoder/decoder
+// that uses fn as its key encoding function.
+func WithKeyEncodeFn(fn func(string) string) *JSON {
+	return defaultJSON.WithKeyEncodeFn(fn)
+}
+
 // OmitEmpty specifies that fields with an empty value
 // should be omitted from encoding.
 // It returns a copy of the original JSON encoder/decoder, sharing its cache.
@@ -86,6 +442,96 @@ func OmitEmpty() *JSON {
 	return defaultJSON.OmitEmpty()
 }
 
+// IsEmptyFn sets the function that decides whether a field is empty,
+// and should be omitted from encoding if it has the omitempty tag option
+// or OmitEmpty is used. It replaces the default definition of empty:
+// false, 0, a nil pointer, a nil interface value, and any empty array,
+// slice, map, or string. fn can call IsEmptyValue to extend the default.
+// For example, to also omit zero times:
+//
+//	jsonx.OmitEmpty().IsEmptyFn(func(v reflect.Value) bool {
+//		if t, ok := v.Interface().(time.Time); ok {
+//			return t.IsZero()
+//		}
+//		return jsonx.IsEmptyValue(v)
+//	})
+//
+// Calling IsEmptyFn(nil) restores the default.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) IsEmptyFn(fn func(v reflect.Value) bool) *JSON {
+	j2 := *j
+	j2.isEmptyFn = fn
+	return &j2
+}
+
+// IsEmptyFn sets the function that decides whether a field is empty.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func IsEmptyFn(fn func(v reflect.Value) bool) *JSON {
+	return defaultJSON.IsEmptyFn(fn)
+}
+
+// IsEmptyValue reports whether v is empty according to the default definition
+// used by the omitempty tag option and OmitEmpty.
+func IsEmptyValue(v reflect.Value) bool {
+	return isEmptyValue(v)
+}
+
+// OmitEmptyStructs specifies that struct fields whose value is a struct
+// equal to its zero value, with all of its fields zero recursively,
+// should be omitted from encoding, like empty fields with the omitempty
+// tag option or OmitEmpty. Pointers to zero structs are not omitted.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) OmitEmptyStructs() *JSON {
+	j2 := *j
+	j2.omitEmptyStructs = true
+	return &j2
+}
+
+// OmitEmptyStructs specifies that struct fields whose value is a zero struct
+// should be omitted from encoding.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func OmitEmptyStructs() *JSON {
+	return defaultJSON.OmitEmptyStructs()
+}
+
+// EmptyAsNull specifies that nil and empty slices and maps
+// should be encoded as the null JSON value.
+// Fields that are omitted because of OmitEmpty or the omitempty tag option
+// are still omitted.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) EmptyAsNull() *JSON {
+	j2 := *j
+	j2.emptyAsNull = true
+	return &j2
+}
+
+// EmptyAsNull specifies that nil and empty slices and maps
+// should be encoded as the null JSON value.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func EmptyAsNull() *JSON {
+	return defaultJSON.EmptyAsNull()
+}
+
+// NilSliceAsEmpty specifies that nil slices should be encoded
+// as an empty JSON array and nil maps as an empty JSON object,
+// instead of the null JSON value.
+// A nil []byte is encoded as an empty string.
+// EmptyAsNull takes precedence over this setting.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) NilSliceAsEmpty() *JSON {
+	j2 := *j
+	j2.nilAsEmpty = true
+	return &j2
+}
+
+// NilSliceAsEmpty specifies that nil slices should be encoded
+// as an empty JSON array and nil maps as an empty JSON object,
+// instead of the null JSON value.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func NilSliceAsEmpty() *JSON {
+	return defaultJSON.NilSliceAsEmpty()
+}
+
 // UseNumber causes the decoder to unmarshal a number into an interface{} as a
 // json.Number instead of as a float64.
 // It returns a copy of the original JSON encoder/decoder, sharing its cache.
@@ -102,6 +548,26 @@ func UseNumber() *JSON {
 	return defaultJSON.UseNumber()
 }
 
+// DecimalMode is like UseNumber, causing the decoder to unmarshal a number
+// into an interface{} as a json.Number, which preserves the exact digits
+// of the input. Additionally, numbers decoded into an interface{} or
+// a json.Number must fit a decimal with an int32 exponent, as used by
+// most arbitrary-precision decimal types; larger exponents, such as in 1e9999999999,
+// cause an UnmarshalTypeError. Use ToDecimal to convert the numbers
+// to a decimal type.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) DecimalMode() *JSON {
+	j2 := *j
+	j2.decimalMode = true
+	return &j2
+}
+
+// DecimalMode is like UseNumber, but also validates that numbers fit a decimal.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func DecimalMode() *JSON {
+	return defaultJSON.DecimalMode()
+}
+
 // DisallowUnknownFields causes the decoder to return an error when the destination
 // is a struct and the input contains object keys which do not match any
 // non-ignored, exported fields in the destination.
@@ -120,6 +586,146 @@ func DisallowUnknownFields() *JSON {
 	return defaultJSON.DisallowUnknownFields()
 }
 
+// CaseSensitive causes the decoder to match object keys to struct fields
+// only if they are exactly equal to the field's encoded name,
+// instead of falling back to a case-insensitive match.
+// Keys converted by a key decoding function are still matched against Go field names.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) CaseSensitive() *JSON {
+	j2 := *j
+	j2.caseSensitive = true
+	return &j2
+}
+
+// CaseSensitive causes the decoder to match object keys to struct fields exactly.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func CaseSensitive() *JSON {
+	return defaultJSON.CaseSensitive()
+}
+
+// ScalarOrArray causes the decoder to accept a single value where a slice
+// is expected, decoding it as a one-element slice. This is useful for APIs that
+// return either a single value or an array of values for the same field.
+// A null value still sets the slice to nil, and a string is still decoded into
+// a byte slice as base64-encoded data.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) ScalarOrArray() *JSON {
+	j2 := *j
+	j2.scalarOrArray = true
+	return &j2
+}
+
+// ScalarOrArray causes the decoder to accept a single value where a slice is expected.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func ScalarOrArray() *JSON {
+	return defaultJSON.ScalarOrArray()
+}
+
+// CoerceScalars causes the decoder to convert scalar values whose type
+// doesn't match the destination: strings containing a number are decoded
+// into numeric types, the strings "true" and "false" into bools, and
+// numbers into strings.
+// Values that cannot be converted, such as "abc" or "300" for an int8,
+// are still an error.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) CoerceScalars() *JSON {
+	j2 := *j
+	j2.coerceScalars = true
+	return &j2
+}
+
+// CoerceScalars causes the decoder to convert scalar values whose type doesn't match the destination.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func CoerceScalars() *JSON {
+	return defaultJSON.CoerceScalars()
+}
+
+// AutoUnquoteNumbers causes the decoder to accept strings containing a number,
+// such as "123", where a numeric type is expected, as if the field had
+// the string tag option. Unlike CoerceScalars, it doesn't convert any other
+// scalar values. Strings that don't contain a valid number are still an error.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) AutoUnquoteNumbers() *JSON {
+	j2 := *j
+	j2.autoUnquoteNumbers = true
+	return &j2
+}
+
+// AutoUnquoteNumbers causes the decoder to accept strings containing a number
+// where a numeric type is expected.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func AutoUnquoteNumbers() *JSON {
+	return defaultJSON.AutoUnquoteNumbers()
+}
+
+// DisallowDuplicateKeys causes the decoder to return a DuplicateKeyError
+// when an object in the input contains the same key more than once.
+// Keys are compared after unquoting, so "a" and "\u0061" are duplicates.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) DisallowDuplicateKeys() *JSON {
+	j2 := *j
+	j2.disallowDuplicateKeys = true
+	return &j2
+}
+
+// DisallowDuplicateKeys causes the decoder to return a DuplicateKeyError
+// when an object in the input contains the same key more than once.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func DisallowDuplicateKeys() *JSON {
+	return defaultJSON.DisallowDuplicateKeys()
+}
+
+// MergeDecode causes the decoder to merge JSON objects into existing values
+// instead of replacing them.
+//
+// Struct fields that are not present in the input are always left unchanged,
+// and existing non-nil pointers are always followed, so nested structs
+// are merged even without this option. MergeDecode extends this to maps:
+// an object decoded into an existing map entry, or into an interface value
+// holding a map, is merged into that entry recursively, instead of
+// replacing it with a newly decoded value.
+// Arrays and other values are decoded as usual.
+// MergeDecode overrides ReplaceDecode.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) MergeDecode() *JSON {
+	j2 := *j
+	j2.mergeDecode = true
+	j2.replaceDecode = false
+	return &j2
+}
+
+// MergeDecode causes the decoder to merge JSON objects into existing values
+// instead of replacing them.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func MergeDecode() *JSON {
+	return defaultJSON.MergeDecode()
+}
+
+// ReplaceDecode causes decoded slices and maps to fully replace
+// the existing value, instead of reusing its contents.
+//
+// By default, a JSON array is decoded into the existing elements of a slice
+// or array, so fields of struct elements that are not present in the input
+// keep their values, and a JSON object is added to the existing entries
+// of a map. With ReplaceDecode, slice and array elements are zeroed
+// before they are decoded, and a JSON object is decoded into a new map.
+// The backing array of a slice is still reused if it is large enough.
+// ReplaceDecode overrides MergeDecode.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) ReplaceDecode() *JSON {
+	j2 := *j
+	j2.replaceDecode = true
+	j2.mergeDecode = false
+	return &j2
+}
+
+// ReplaceDecode causes decoded slices and maps to fully replace
+// the existing value, instead of reusing its contents.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func ReplaceDecode() *JSON {
+	return defaultJSON.ReplaceDecode()
+}
+
 // EscapeHTML specifies whether problematic HTML characters
 // should be escaped inside JSON quoted strings.
 // The default behavior is to escape &, <, and > to \u0026, \u003c, and \u003e
@@ -127,9 +733,588 @@ func DisallowUnknownFields() *JSON {
 //
 // In non-HTML settings where the escaping interferes with the readability
 // of the output, EscapeHTML(false) disables this behavior.
+// The setting also applies to the output of MarshalJSON methods,
+// such as that of json.RawMessage, which is compacted and escaped accordingly.
 // It returns a copy of the original JSON encoder/decoder, sharing its cache.
 func (j *JSON) EscapeHTML(on bool) *JSON {
 	j2 := *j
 	j2.dontEscapeHTML = !on
 	return &j2
 }
+
+// EscapeSet specifies additional runes that should always be escaped
+// inside JSON quoted strings, regardless of the EscapeHTML setting.
+// Runes outside the Basic Multilingual Plane are escaped as UTF-16 surrogate pairs.
+// Invalid runes, such as negative values and surrogate halves, are ignored,
+// because they can't occur in the encoded strings.
+// The set replaces any previously configured set; calling EscapeSet()
+// with no arguments disables the additional escaping.
+// The output of MarshalJSON methods is not affected.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) EscapeSet(runes ...rune) *JSON {
+	j2 := *j
+	j2.escapeSet = newRuneSet(runes)
+	return &j2
+}
+
+// EscapeSet specifies additional runes that should always be escaped
+// inside JSON quoted strings, regardless of the EscapeHTML setting.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func EscapeSet(runes ...rune) *JSON {
+	return defaultJSON.EscapeSet(runes...)
+}
+
+// RejectInvalidUTF8 causes Marshal to return an InvalidUTF8Error
+// when a string contains invalid UTF-8, instead of replacing
+// the invalid bytes with the Unicode replacement character U+FFFD.
+// The output of MarshalJSON methods is not affected.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) RejectInvalidUTF8() *JSON {
+	j2 := *j
+	j2.rejectInvalidUTF8 = true
+	return &j2
+}
+
+// RejectInvalidUTF8 causes Marshal to return an error when a string contains invalid UTF-8.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func RejectInvalidUTF8() *JSON {
+	return defaultJSON.RejectInvalidUTF8()
+}
+
+// StrictStringTag causes Marshal and Unmarshal to return an InvalidStringTagError
+// when the ",string" struct tag option is used on a field whose type is not
+// a string, floating point, integer or boolean type, such as time.Time or a map.
+// By default the option is silently ignored on those fields, like in encoding/json.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) StrictStringTag() *JSON {
+	j2 := *j
+	j2.strictStringTag = true
+	return &j2
+}
+
+// StrictStringTag causes Marshal and Unmarshal to return an error when the ",string"
+// struct tag option is used on a field it doesn't apply to.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func StrictStringTag() *JSON {
+	return defaultJSON.StrictStringTag()
+}
+
+// LenientNumbers causes invalid json.Number values to be accepted.
+// When marshaling, an invalid json.Number is encoded as a JSON string
+// instead of returning an error, and when unmarshaling, a JSON string
+// that is not a valid number literal can be stored in a json.Number.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) LenientNumbers() *JSON {
+	j2 := *j
+	j2.lenientNumbers = true
+	return &j2
+}
+
+// LenientNumbers causes invalid json.Number values to be accepted.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func LenientNumbers() *JSON {
+	return defaultJSON.LenientNumbers()
+}
+
+// MapKeyOrder sets the comparison function used to sort map keys when marshaling.
+// cmp is called with the encoded keys and must return a negative number
+// if a sorts before b, a positive number if a sorts after b and zero
+// if they are equivalent. Equivalent keys are sorted lexicographically.
+// Calling MapKeyOrder(nil) restores the default lexicographic order.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) MapKeyOrder(cmp func(a, b string) int) *JSON {
+	j2 := *j
+	j2.mapKeyCompare = cmp
+	return &j2
+}
+
+// MapKeyOrder sets the comparison function used to sort map keys when marshaling.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func MapKeyOrder(cmp func(a, b string) int) *JSON {
+	return defaultJSON.MapKeyOrder(cmp)
+}
+
+// A FloatMode specifies how floating point numbers are encoded.
+type FloatMode int
+
+const (
+	// FloatModeDefault encodes floating point numbers
+	// as if by ES6 number to string conversion,
+	// using an exponent for very large and very small values.
+	FloatModeDefault FloatMode = iota
+	// FloatModeInteger is like FloatModeDefault,
+	// but floating point numbers with an integral value
+	// are always encoded as integers, without an exponent.
+	FloatModeInteger
+)
+
+// FloatFormat specifies how floating point numbers should be encoded.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) FloatFormat(mode FloatMode) *JSON {
+	j2 := *j
+	j2.floatMode = mode
+	return &j2
+}
+
+// FloatFormat specifies how floating point numbers should be encoded.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func FloatFormat(mode FloatMode) *JSON {
+	return defaultJSON.FloatFormat(mode)
+}
+
+// A SpecialFloatMode specifies how NaN and infinite floating point values are encoded.
+type SpecialFloatMode int
+
+const (
+	// SpecialFloatsError causes Marshal to return an UnsupportedValueError
+	// for NaN and infinite values, like encoding/json does.
+	SpecialFloatsError SpecialFloatMode = iota
+	// SpecialFloatsQuoted encodes NaN and infinite values as the JSON strings
+	// "NaN", "Infinity" and "-Infinity".
+	SpecialFloatsQuoted
+	// SpecialFloatsBare encodes NaN and infinite values as the bare tokens
+	// NaN, Infinity and -Infinity, as understood by JavaScript.
+	// The output is not valid JSON, so it cannot be combined with Indent.
+	SpecialFloatsBare
+)
+
+// AllowSpecialFloats specifies how NaN and infinite floating point values should be encoded.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) AllowSpecialFloats(mode SpecialFloatMode) *JSON {
+	j2 := *j
+	j2.specialFloats = mode
+	return &j2
+}
+
+// AllowSpecialFloats specifies how NaN and infinite floating point values should be encoded.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func AllowSpecialFloats(mode SpecialFloatMode) *JSON {
+	return defaultJSON.AllowSpecialFloats(mode)
+}
+
+// TimeFormat sets the layout used to encode and decode time.Time values,
+// as accepted by time.Time.Format and time.Parse.
+// Times are formatted in their own location; use a layout with a zone
+// offset, such as time.RFC3339, to preserve it.
+// Calling TimeFormat("") restores the default, which uses time.Time's
+// MarshalJSON and UnmarshalJSON methods.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) TimeFormat(layout string) *JSON {
+	j2 := *j
+	j2.timeFormat = layout
+	return &j2
+}
+
+// TimeFormat sets the layout used to encode and decode time.Time values.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func TimeFormat(layout string) *JSON {
+	return defaultJSON.TimeFormat(layout)
+}
+
+// DurationAsString causes time.Duration values to be encoded as strings
+// returned by their String method, such as "1h30m0s", instead of as integer
+// numbers of nanoseconds. When decoding, strings are parsed with
+// time.ParseDuration, and numbers are still accepted as nanoseconds.
+// Fields with the ",string" option are quoted again, like string fields.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) DurationAsString() *JSON {
+	j2 := *j
+	j2.durationAsString = true
+	return &j2
+}
+
+// DurationAsString causes time.Duration values to be encoded and decoded
+// as strings, such as "1h30m0s".
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func DurationAsString() *JSON {
+	return defaultJSON.DurationAsString()
+}
+
+// ErrorsAsString causes non-nil values implementing error, such as
+// struct fields of type error or of a concrete error type, to be encoded
+// as the strings returned by their Error method, instead of as the
+// values themselves, which are usually encoded as {}.
+// As with Marshaler, an Error method with a pointer receiver is only used
+// for addressable values.
+// Error values take precedence over the Marshaler and TextMarshaler methods
+// of their types, but not over encoders registered with RegisterTypeEncoder.
+// A nil pointer implementing error is encoded as null.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) ErrorsAsString() *JSON {
+	j2 := *j
+	j2.errorsAsString = true
+	return &j2
+}
+
+// ErrorsAsString causes errors to be encoded as the strings
+// returned by their Error method.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func ErrorsAsString() *JSON {
+	return defaultJSON.ErrorsAsString()
+}
+
+// DecoderBufferSize sets the minimum number of bytes a Decoder created
+// by NewDecoder reads from its input at once. A larger buffer reduces
+// the number of reads when decoding large values.
+// If n is not positive, the default of 512 bytes is used.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) DecoderBufferSize(n int) *JSON {
+	j2 := *j
+	j2.decoderBufferSize = n
+	return &j2
+}
+
+// DecoderBufferSize sets the minimum number of bytes a Decoder reads from its input at once.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func DecoderBufferSize(n int) *JSON {
+	return defaultJSON.DecoderBufferSize(n)
+}
+
+// MaxDepth limits how deeply arrays and objects may be nested in
+// the input when decoding. A top-level array or object has a depth of 1.
+// Input nested deeper than n is rejected with a *LimitError.
+// If n is not positive, the depth is not limited.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) MaxDepth(n int) *JSON {
+	j2 := *j
+	j2.maxDepth = n
+	return &j2
+}
+
+// MaxDepth limits how deeply arrays and objects may be nested in the input when decoding.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func MaxDepth(n int) *JSON {
+	return defaultJSON.MaxDepth(n)
+}
+
+// MaxStringLen limits the length of strings, including object keys,
+// in the input when decoding. The length is measured in bytes as the
+// string appears in the input, before escape sequences are decoded.
+// Longer strings are rejected with a *LimitError.
+// If n is not positive, the length is not limited.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) MaxStringLen(n int) *JSON {
+	j2 := *j
+	j2.maxStringLen = n
+	return &j2
+}
+
+// MaxStringLen limits the length of strings in the input when decoding.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func MaxStringLen(n int) *JSON {
+	return defaultJSON.MaxStringLen(n)
+}
+
+// MaxObjectKeys limits the number of keys in each object in the input
+// when decoding. Keys are counted per object: the keys of a nested
+// object do not count towards the limit of the object containing it.
+// Objects with more than n keys are rejected with a *LimitError.
+// If n is not positive, the number of keys is not limited.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) MaxObjectKeys(n int) *JSON {
+	j2 := *j
+	j2.maxObjectKeys = n
+	return &j2
+}
+
+// MaxObjectKeys limits the number of keys in each object in the input when decoding.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func MaxObjectKeys(n int) *JSON {
+	return defaultJSON.MaxObjectKeys(n)
+}
+
+// MaxInterfaceDepth limits how deeply the maps and slices created when
+// decoding into an interface value may be nested. The map or slice stored
+// in the interface value itself has a depth of 1. Arrays and objects nested
+// deeper than n are rejected with a *LimitError, and the interface value is left unset.
+// Decoding into typed Go values is not affected, but a Go value
+// inside an interface value's map or slice continues to count its depth.
+// If n is not positive, the depth is not limited.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) MaxInterfaceDepth(n int) *JSON {
+	j2 := *j
+	j2.maxInterfaceDepth = n
+	return &j2
+}
+
+// MaxInterfaceDepth limits how deeply the maps and slices created when decoding
+// into an interface value may be nested.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func MaxInterfaceDepth(n int) *JSON {
+	return defaultJSON.MaxInterfaceDepth(n)
+}
+
+// RegisteredTypesOnly causes the decoder to reject objects decoded into
+// an interface value unless they have a discriminator registered with
+// RegisterDiscriminator, instead of creating a map[string]interface{}
+// or an OrderedMap. This limits the dynamic types that untrusted input
+// can produce to the registered ones. Arrays and literals are still allowed.
+// A rejected object is reported as a *json.UnmarshalTypeError.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) RegisteredTypesOnly() *JSON {
+	j2 := *j
+	j2.registeredTypesOnly = true
+	return &j2
+}
+
+// RegisteredTypesOnly causes the decoder to reject objects decoded into an interface value
+// unless they have a registered discriminator.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func RegisteredTypesOnly() *JSON {
+	return defaultJSON.RegisteredTypesOnly()
+}
+
+// AllowTrailingCommas causes the decoder to accept a comma after the last
+// element of an array or the last member of an object, such as in [1,2,]
+// or {"a":1,}, which is convenient for hand-written configuration files.
+// A comma is still not allowed in an empty array or object, and only one
+// comma is allowed.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) AllowTrailingCommas() *JSON {
+	j2 := *j
+	j2.allowTrailingCommas = true
+	return &j2
+}
+
+// AllowTrailingCommas causes the decoder to accept a comma after the last
+// element of an array or the last member of an object.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func AllowTrailingCommas() *JSON {
+	return defaultJSON.AllowTrailingCommas()
+}
+
+// AllowComments causes the decoder to accept // line comments and
+// /* block */ comments anywhere space is allowed, such as in JSONC
+// configuration files. Comments are skipped like space; a // inside
+// a string is part of the string.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) AllowComments() *JSON {
+	j2 := *j
+	j2.allowComments = true
+	return &j2
+}
+
+// AllowComments causes the decoder to accept // line comments and
+// /* block */ comments anywhere space is allowed.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func AllowComments() *JSON {
+	return defaultJSON.AllowComments()
+}
+
+// AllowSingleQuotes causes the decoder to accept strings and object keys
+// in single quotes, such as 'it\'s', as in JavaScript and JSON5.
+// Single-quoted strings have the same escapes as double-quoted strings,
+// plus \' for a single quote, which is also accepted in double-quoted strings.
+// A double quote doesn't need to be escaped in a single-quoted string.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) AllowSingleQuotes() *JSON {
+	j2 := *j
+	j2.allowSingleQuotes = true
+	return &j2
+}
+
+// AllowSingleQuotes causes the decoder to accept strings and object keys
+// in single quotes.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func AllowSingleQuotes() *JSON {
+	return defaultJSON.AllowSingleQuotes()
+}
+
+// AllowUnquotedKeys causes the decoder to accept object keys without quotes,
+// such as {foo: 1}, as in JavaScript and JSON5. An unquoted key must be
+// an ASCII identifier: a letter, '_' or '$', followed by letters, digits,
+// '_' or '$'. Keywords such as true are allowed as keys.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) AllowUnquotedKeys() *JSON {
+	j2 := *j
+	j2.allowUnquotedKeys = true
+	return &j2
+}
+
+// AllowUnquotedKeys causes the decoder to accept object keys that are
+// identifiers without quotes.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func AllowUnquotedKeys() *JSON {
+	return defaultJSON.AllowUnquotedKeys()
+}
+
+// AllowExtendedNumbers causes the decoder to accept the numbers of JSON5:
+// hexadecimal integers such as 0x1F, a leading + sign, and a decimal point
+// without digits before or after it, such as .5 and 5.
+// They are decoded like the equivalent standard numbers, so 0x1F decodes
+// into a json.Number as "31".
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) AllowExtendedNumbers() *JSON {
+	j2 := *j
+	j2.allowExtendedNumbers = true
+	return &j2
+}
+
+// AllowExtendedNumbers causes the decoder to accept hexadecimal integers,
+// a leading + sign, and a leading or trailing decimal point in numbers.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func AllowExtendedNumbers() *JSON {
+	return defaultJSON.AllowExtendedNumbers()
+}
+
+// DecodeFieldHook sets a function that is called with the raw JSON value
+// of each struct field before it is decoded. The value returned by fn is
+// decoded into the field instead, which allows fn to rewrite it,
+// for example to normalize units. It must be a valid JSON value.
+// If fn returns an error, decoding stops and the error is returned.
+// The raw slice must not be modified or retained.
+// Calling DecodeFieldHook(nil) removes the hook.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) DecodeFieldHook(fn func(field FieldInfo, raw []byte) ([]byte, error)) *JSON {
+	j2 := *j
+	j2.decodeFieldHook = fn
+	return &j2
+}
+
+// DecodeFieldHook sets a function that is called with the raw JSON value of each struct field before it is decoded.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func DecodeFieldHook(fn func(field FieldInfo, raw []byte) ([]byte, error)) *JSON {
+	return defaultJSON.DecodeFieldHook(fn)
+}
+
+// EncodeValueHook sets a function that is called for every value before
+// it is encoded, with the path of the value and the value itself.
+// The path consists of the object keys and array indexes leading to the value,
+// joined by dots, e.g. "users.0.password". The path of the top-level value is empty.
+// If fn returns true, the returned replacement is encoded instead of the value,
+// without calling fn for the replacement or the values inside it.
+// Calling EncodeValueHook(nil) removes the hook.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) EncodeValueHook(fn func(path string, v reflect.Value) (interface{}, bool)) *JSON {
+	j2 := *j
+	j2.encodeValueHook = fn
+	return &j2
+}
+
+// EncodeValueHook sets a function that can replace any value before it is encoded.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func EncodeValueHook(fn func(path string, v reflect.Value) (interface{}, bool)) *JSON {
+	return defaultJSON.EncodeValueHook(fn)
+}
+
+// ShowRedacted controls whether fields with the redact tag option are encoded.
+// By default their values are replaced by the string "[REDACTED]",
+// which makes it safe to marshal values containing secrets for logging.
+// Decoding is not affected.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) ShowRedacted(show bool) *JSON {
+	j2 := *j
+	j2.showRedacted = show
+	return &j2
+}
+
+// ShowRedacted controls whether fields with the redact tag option are encoded.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func ShowRedacted(show bool) *JSON {
+	return defaultJSON.ShowRedacted(show)
+}
+
+// InjectDiscriminators causes structs whose type was registered with
+// RegisterDiscriminator, directly or as a pointer, to be encoded with their
+// discriminator field as the first key, e.g. {"type":"cat","name":"Tom"},
+// so that values stored in interfaces can be decoded into the same types.
+// The field is not added if the struct has a field with the same key.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) InjectDiscriminators() *JSON {
+	j2 := *j
+	j2.injectDiscriminators = true
+	return &j2
+}
+
+// InjectDiscriminators causes structs whose type was registered with
+// RegisterDiscriminator to be encoded with their discriminator field.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func InjectDiscriminators() *JSON {
+	return defaultJSON.InjectDiscriminators()
+}
+
+// bytesFormat is the encoding of byte slices.
+type bytesFormat uint8
+
+const (
+	bytesBase64 bytesFormat = iota
+	bytesArray
+	bytesHex
+)
+
+// BytesAsArray causes byte slices to be encoded as JSON arrays of numbers,
+// e.g. [1,2,3], instead of base64-encoded strings.
+// Byte slices are decoded from arrays regardless of the encoding,
+// and from base64-encoded strings unless BytesAsHex is used.
+// BytesAsArray, BytesAsHex and Base64Encoding are mutually exclusive,
+// the last one called wins.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) BytesAsArray() *JSON {
+	j2 := *j
+	j2.bytesFormat = bytesArray
+	return &j2
+}
+
+// BytesAsArray causes byte slices to be encoded as JSON arrays of numbers.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func BytesAsArray() *JSON {
+	return defaultJSON.BytesAsArray()
+}
+
+// BytesAsHex causes byte slices to be encoded as strings of lowercase
+// hexadecimal digits, e.g. "0a0b", instead of base64-encoded strings,
+// and strings to be decoded into byte slices as hexadecimal digits,
+// in either case. Arrays of numbers are also accepted when decoding.
+// BytesAsArray, BytesAsHex and Base64Encoding are mutually exclusive,
+// the last one called wins.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) BytesAsHex() *JSON {
+	j2 := *j
+	j2.bytesFormat = bytesHex
+	return &j2
+}
+
+// BytesAsHex causes byte slices to be encoded and decoded as hexadecimal strings.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func BytesAsHex() *JSON {
+	return defaultJSON.BytesAsHex()
+}
+
+// Base64Encoding causes byte slices to be encoded and decoded as strings
+// using enc, such as base64.URLEncoding or base64.RawURLEncoding, instead of
+// base64.StdEncoding, which is restored by Base64Encoding(nil).
+// If enc does not use padding, padded input is still accepted when decoding:
+// the trailing padding characters are removed before decoding.
+// BytesAsArray, BytesAsHex and Base64Encoding are mutually exclusive,
+// the last one called wins.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) Base64Encoding(enc *base64.Encoding) *JSON {
+	j2 := *j
+	j2.bytesFormat = bytesBase64
+	j2.base64Encoding = enc
+	return &j2
+}
+
+// Base64Encoding causes byte slices to be encoded and decoded as strings using enc.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func Base64Encoding(enc *base64.Encoding) *JSON {
+	return defaultJSON.Base64Encoding(enc)
+}
+
+// Indent causes the encoder to format its output
+// as if indented by the package-level function json.Indent(dst, src, prefix, indent).
+// Calling Indent("", "") disables indentation.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) Indent(prefix, indent string) *JSON {
+	j2 := *j
+	j2.indentPrefix = prefix
+	j2.indentValue = indent
+	return &j2
+}
+
+// Indent causes the encoder to format its output
+// as if indented by the package-level function json.Indent(dst, src, prefix, indent).
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func Indent(prefix, indent string) *JSON {
+	return defaultJSON.Indent(prefix, indent)
+}
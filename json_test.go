@@ -6,11 +6,21 @@ package jsonx
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -65,6 +75,62 @@ func TestKeyEncodeFn(t *testing.T) {
 	})
 }
 
+type DecodeKeys struct {
+	FirstName string
+	LastName  string
+	UserID    int `json:"user_id"`
+}
+
+func TestKeyDecodeFn(t *testing.T) {
+	json := New(
+		KeyEncodeFn(func(s string) string {
+			r, z := utf8.DecodeRuneInString(s)
+			return string(unicode.ToLower(r)) + s[z:]
+		}),
+		KeyDecodeFn(func(s string) string {
+			parts := strings.Split(s, "_")
+			for i, p := range parts {
+				r, z := utf8.DecodeRuneInString(p)
+				parts[i] = string(unicode.ToUpper(r)) + p[z:]
+			}
+			return strings.Join(parts, "")
+		}),
+	)
+
+	t.Run("snake_case", func(t *testing.T) {
+		var v DecodeKeys
+		err := json.Unmarshal([]byte(`{"first_name":"John","last_name":"Doe","user_id":42}`), &v)
+		if err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		expected := DecodeKeys{FirstName: "John", LastName: "Doe", UserID: 42}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v, expected)
+		}
+	})
+
+	t.Run("no case folding", func(t *testing.T) {
+		// The decode function replaces case insensitive matching of encoded names.
+		var v DecodeKeys
+		err := json.DisallowUnknownFields().Unmarshal([]byte(`{"FIRSTNAME":"John"}`), &v)
+		expectedErr := `json: unknown field "FIRSTNAME"`
+		if err == nil || err.Error() != expectedErr {
+			t.Fatalf("have: %v, want: %v", err, expectedErr)
+		}
+	})
+
+	t.Run("Marshal", func(t *testing.T) {
+		b, err := json.Marshal(DecodeKeys{FirstName: "John", LastName: "Doe", UserID: 42})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		expected := []byte(`{"firstName":"John","lastName":"Doe","user_id":42}`)
+		if !bytes.Equal(b, expected) {
+			diff(t, b, expected)
+		}
+	})
+}
+
 func TestJSONOmitEmpty(t *testing.T) {
 	v := Keys{
 		Foo: "foo",
@@ -130,6 +196,128 @@ func TestJSONOmitEmpty(t *testing.T) {
 	})
 }
 
+func TestJSONOmitEmptyStructs(t *testing.T) {
+	type Inner struct {
+		A int
+		B []string
+	}
+	type Middle struct {
+		Inner Inner
+		Arr   [2]int
+	}
+	type T struct {
+		Name   string
+		Zero   Middle
+		Part   Middle
+		Ptr    *Middle
+		Time   time.Time
+		Tagged Inner `json:",omitempty"`
+	}
+	v := T{
+		Part: Middle{Arr: [2]int{0, 1}},
+		Ptr:  &Middle{},
+	}
+
+	b, err := OmitEmptyStructs().Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected := `{"Name":"","Part":{"Arr":[0,1]},"Ptr":{"Arr":[0,0]}}`
+	if string(b) != expected {
+		diff(t, b, []byte(expected))
+	}
+
+	b, err = OmitEmptyStructs().OmitEmpty().Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected = `{"Part":{"Arr":[0,1]},"Ptr":{"Arr":[0,0]}}`
+	if string(b) != expected {
+		diff(t, b, []byte(expected))
+	}
+
+	// A non-nil empty slice is not a zero value.
+	v = T{Zero: Middle{Inner: Inner{B: []string{}}}}
+	b, err = OmitEmptyStructs().Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected = `{"Name":"","Zero":{"Inner":{"A":0,"B":[]},"Arr":[0,0]},"Ptr":null}`
+	if string(b) != expected {
+		diff(t, b, []byte(expected))
+	}
+
+	// Without the option, zero structs are kept, even with omitempty.
+	b, err = Marshal(T{})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected = `{"Name":"","Zero":{"Inner":{"A":0,"B":null},"Arr":[0,0]},"Part":{"Inner":{"A":0,"B":null},"Arr":[0,0]},"Ptr":null,"Time":"0001-01-01T00:00:00Z","Tagged":{"A":0,"B":null}}`
+	if string(b) != expected {
+		diff(t, b, []byte(expected))
+	}
+}
+
+func TestJSONIsEmptyFn(t *testing.T) {
+	type T struct {
+		Name    string
+		Created time.Time
+		Updated time.Time `json:",omitempty"`
+		Count   int       `json:",omitempty"`
+	}
+	isEmpty := func(v reflect.Value) bool {
+		if t, ok := v.Interface().(time.Time); ok {
+			return t.IsZero()
+		}
+		return IsEmptyValue(v)
+	}
+	v := T{Name: "a"}
+
+	b, err := IsEmptyFn(isEmpty).Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"Name":"a","Created":"0001-01-01T00:00:00Z"}`; string(b) != expected {
+		diff(t, b, []byte(expected))
+	}
+
+	b, err = IsEmptyFn(isEmpty).OmitEmpty().Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"Name":"a"}`; string(b) != expected {
+		diff(t, b, []byte(expected))
+	}
+
+	// Non-zero times are kept.
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	b, err = IsEmptyFn(isEmpty).OmitEmpty().Marshal(T{Updated: now})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"Updated":"2020-01-02T03:04:05Z"}`; string(b) != expected {
+		diff(t, b, []byte(expected))
+	}
+
+	// The function replaces the default definition.
+	b, err = IsEmptyFn(func(v reflect.Value) bool { return false }).OmitEmpty().Marshal(T{})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"Name":"","Created":"0001-01-01T00:00:00Z","Updated":"0001-01-01T00:00:00Z","Count":0}`; string(b) != expected {
+		diff(t, b, []byte(expected))
+	}
+
+	// Without a function, zero times are not empty.
+	b, err = Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"Name":"a","Created":"0001-01-01T00:00:00Z","Updated":"0001-01-01T00:00:00Z"}`; string(b) != expected {
+		diff(t, b, []byte(expected))
+	}
+}
+
 func TestJSONUseNumber(t *testing.T) {
 	data := []byte(`2`)
 	t.Run("true", func(t *testing.T) {
@@ -284,3 +472,3832 @@ func TestJSONEscapeHTML(t *testing.T) {
 		}
 	})
 }
+
+func TestJSONIndent(t *testing.T) {
+	v := map[string]interface{}{
+		"Foo": "foo",
+		"Bar": []interface{}{1, "two", map[string]int{"three": 3}},
+		"Baz": map[string]interface{}{
+			"One": []int{},
+			"Two": map[string]string{},
+		},
+	}
+	expected, err := json.MarshalIndent(v, ">", "\t")
+	if err != nil {
+		t.Fatalf("json.MarshalIndent: %v", err)
+	}
+
+	t.Run("Marshal", func(t *testing.T) {
+		t.Parallel()
+		b, err := Indent(">", "\t").Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if !bytes.Equal(b, expected) {
+			diff(t, b, expected)
+		}
+	})
+
+	t.Run("encoder", func(t *testing.T) {
+		t.Parallel()
+		var buff bytes.Buffer
+		encoder := Indent(">", "\t").NewEncoder(&buff)
+		err := encoder.Encode(v)
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		b := append(expected[:len(expected):len(expected)], '\n')
+		if !bytes.Equal(buff.Bytes(), b) {
+			diff(t, buff.Bytes(), b)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		b, err := Indent(">", "\t").Indent("", "").Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		compact, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("json.Marshal: %v", err)
+		}
+		if !bytes.Equal(b, compact) {
+			diff(t, b, compact)
+		}
+	})
+}
+
+func TestJSONMarshalIndent(t *testing.T) {
+	v := Keys{
+		Foo: "foo",
+		Bar: 42,
+		Baz: map[string]string{
+			"One": "one",
+			"two": "two",
+		},
+	}
+
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		b, err := MarshalIndent(v, "", "  ")
+		if err != nil {
+			t.Fatalf("MarshalIndent: %v", err)
+		}
+		expected, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			t.Fatalf("json.MarshalIndent: %v", err)
+		}
+		if !bytes.Equal(b, expected) {
+			diff(t, b, expected)
+		}
+	})
+
+	t.Run("with key encode function", func(t *testing.T) {
+		t.Parallel()
+		json := New(KeyEncodeFn(strings.ToLower))
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			t.Fatalf("MarshalIndent: %v", err)
+		}
+		expected := []byte(`{
+  "foo": "foo",
+  "bar": 42,
+  "baz": {
+    "One": "one",
+    "two": "two"
+  }
+}`)
+		if !bytes.Equal(b, expected) {
+			diff(t, b, expected)
+		}
+	})
+
+	t.Run("with omit empty", func(t *testing.T) {
+		t.Parallel()
+		b, err := OmitEmpty().MarshalIndent(Keys{Foo: "foo"}, "", "  ")
+		if err != nil {
+			t.Fatalf("MarshalIndent: %v", err)
+		}
+		expected := []byte("{\n  \"Foo\": \"foo\"\n}")
+		if !bytes.Equal(b, expected) {
+			diff(t, b, expected)
+		}
+	})
+}
+
+func TestJSONCompact(t *testing.T) {
+	src := []byte(" {\n\t\"a b\" : [ 1, \"<x> & \\\"y\\\" \" ],\n\t\"c\": { }\n} ")
+	escaped := `{"a b":[1,"\u003cx\u003e \u0026 \"y\" "],"c":{}}`
+	unescaped := `{"a b":[1,"<x> & \"y\" "],"c":{}}`
+
+	t.Run("true", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		if err := Compact(&buf, src); err != nil {
+			t.Fatalf("Compact: %v", err)
+		}
+		if buf.String() != escaped {
+			t.Fatalf("have: %v, want: %v", buf.String(), escaped)
+		}
+	})
+
+	t.Run("false", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		if err := defaultJSON.EscapeHTML(false).Compact(&buf, src); err != nil {
+			t.Fatalf("Compact: %v", err)
+		}
+		if buf.String() != unescaped {
+			t.Fatalf("have: %v, want: %v", buf.String(), unescaped)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		buf := bytes.NewBufferString("x")
+		err := Compact(buf, []byte(`{"a":}`))
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Fatalf("have: %v, want: SyntaxError", err)
+		}
+		if buf.String() != "x" {
+			t.Fatalf("dst modified on error: %q", buf.String())
+		}
+	})
+}
+
+func TestJSONHTMLEscape(t *testing.T) {
+	src := []byte("{\"M\":\"<html>foo &\u2028 \u2029</html>\"}")
+	escaped := `{"M":"\u003chtml\u003efoo \u0026\u2028 \u2029\u003c/html\u003e"}`
+	unescaped := `{"M":"<html>foo &\u2028 \u2029</html>"}`
+
+	t.Run("true", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		HTMLEscape(&buf, src)
+		if buf.String() != escaped {
+			t.Fatalf("have: %v, want: %v", buf.String(), escaped)
+		}
+	})
+
+	t.Run("false", func(t *testing.T) {
+		t.Parallel()
+		var buf bytes.Buffer
+		defaultJSON.EscapeHTML(false).HTMLEscape(&buf, src)
+		if buf.String() != unescaped {
+			t.Fatalf("have: %v, want: %v", buf.String(), unescaped)
+		}
+	})
+
+	t.Run("matches encoder", func(t *testing.T) {
+		t.Parallel()
+		b, err := Marshal(map[string]string{"M": "<html>foo &\u2028 \u2029</html>"})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if string(b) != escaped {
+			t.Fatalf("have: %v, want: %v", string(b), escaped)
+		}
+	})
+}
+
+func TestJSONEscapeSet(t *testing.T) {
+	v := map[string]string{"a/b": "</x>é\U0001F600"}
+
+	tests := []struct {
+		name     string
+		json     *JSON
+		expected string
+	}{
+		{"none", defaultJSON, `{"a/b":"\u003c/x\u003e` + "é\U0001F600" + `"}`},
+		{"ascii", EscapeSet('/'), `{"a\u002fb":"\u003c\u002fx\u003e` + "é\U0001F600" + `"}`},
+		{"non-ascii", EscapeSet('é', '\U0001F600'), `{"a/b":"\u003c/x\u003e\u00e9\ud83d\ude00"}`},
+		{"without html", defaultJSON.EscapeHTML(false).EscapeSet('/', 'é'), `{"a\u002fb":"<\u002fx>\u00e9` + "\U0001F600" + `"}`},
+		{"reset", EscapeSet('/').EscapeSet(), `{"a/b":"\u003c/x\u003e` + "é\U0001F600" + `"}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := tt.json.Marshal(v)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.expected {
+				t.Fatalf("have: %v, want: %v", string(b), tt.expected)
+			}
+		})
+	}
+
+	t.Run("struct field name", func(t *testing.T) {
+		t.Parallel()
+		type T struct {
+			A int `json:"a/b"`
+		}
+		b, err := EscapeSet('/').Marshal(T{1})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		expected := `{"a\u002fb":1}`
+		if string(b) != expected {
+			t.Fatalf("have: %v, want: %v", string(b), expected)
+		}
+	})
+
+	t.Run("invalid runes", func(t *testing.T) {
+		t.Parallel()
+		b, err := New().EscapeSet('a', -1, 0xD800, utf8.MaxRune+1).Marshal("ab")
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		expected := `"\u0061b"`
+		if string(b) != expected {
+			t.Fatalf("have: %v, want: %v", string(b), expected)
+		}
+	})
+}
+
+func TestJSONFloatFormat(t *testing.T) {
+	tests := []struct {
+		in              float64
+		defaultExpected string
+		integerExpected string
+	}{
+		{1000000, `1000000`, `1000000`},
+		{0.5, `0.5`, `0.5`},
+		{-2, `-2`, `-2`},
+		{1e21, `1e+21`, `1000000000000000000000`},
+		{-1e22, `-1e+22`, `-10000000000000000000000`},
+		{1 << 53, `9007199254740992`, `9007199254740992`},
+		{1.5e300, `1.5e+300`, `15` + strings.Repeat("0", 299)},
+		{1e-7, `1e-7`, `1e-7`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprint(tt.in), func(t *testing.T) {
+			t.Parallel()
+			b, err := Marshal(tt.in)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.defaultExpected {
+				t.Errorf("default: have: %v, want: %v", string(b), tt.defaultExpected)
+			}
+			b, err = FloatFormat(FloatModeInteger).Marshal([]interface{}{tt.in})
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if expected := "[" + tt.integerExpected + "]"; string(b) != expected {
+				t.Errorf("integer: have: %v, want: %v", string(b), expected)
+			}
+			var f float64
+			if err := Unmarshal([]byte(tt.integerExpected), &f); err != nil || f != tt.in {
+				t.Errorf("round trip: have: %v, %v, want: %v", f, err, tt.in)
+			}
+		})
+	}
+}
+
+func TestJSONAllowSpecialFloats(t *testing.T) {
+	tests := []struct {
+		in             interface{}
+		quotedExpected string
+		bareExpected   string
+	}{
+		{math.NaN(), `"NaN"`, `NaN`},
+		{math.Inf(1), `"Infinity"`, `Infinity`},
+		{math.Inf(-1), `"-Infinity"`, `-Infinity`},
+		{float32(math.Inf(-1)), `"-Infinity"`, `-Infinity`},
+		{1.5, `1.5`, `1.5`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprint(tt.in), func(t *testing.T) {
+			t.Parallel()
+			_, err := Marshal(tt.in)
+			if _, ok := err.(*json.UnsupportedValueError); !ok && tt.in != 1.5 {
+				t.Errorf("default: have: %v, want UnsupportedValueError", err)
+			}
+			b, err := AllowSpecialFloats(SpecialFloatsQuoted).Marshal(tt.in)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.quotedExpected {
+				t.Errorf("quoted: have: %v, want: %v", string(b), tt.quotedExpected)
+			}
+			b, err = AllowSpecialFloats(SpecialFloatsBare).Marshal([]interface{}{tt.in})
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if expected := "[" + tt.bareExpected + "]"; string(b) != expected {
+				t.Errorf("bare: have: %v, want: %v", string(b), expected)
+			}
+		})
+	}
+
+	t.Run("string tag", func(t *testing.T) {
+		v := struct {
+			F float64 `json:",string"`
+		}{math.Inf(1)}
+		b, err := AllowSpecialFloats(SpecialFloatsBare).Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `{"F":"Infinity"}`; string(b) != expected {
+			t.Errorf("have: %v, want: %v", string(b), expected)
+		}
+	})
+}
+
+func TestJSONRejectInvalidUTF8(t *testing.T) {
+	// 0x80 is a lone continuation byte.
+	invalid := string([]byte{'a', 'b', 0x80, 'c'})
+	tests := []struct {
+		name string
+		in   interface{}
+		s    string
+		off  int
+	}{
+		{"string", invalid, invalid, 2},
+		{"map key", map[string]int{invalid: 1}, invalid, 2},
+		{"string tag", struct {
+			S string `json:",string"`
+		}{invalid}, invalid, 2},
+		{"after multibyte", "\u00e9" + invalid, "\u00e9" + invalid, 4},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := Marshal(tt.in)
+			if err != nil || !bytes.Contains(b, []byte(`\ufffd`)) {
+				t.Errorf("default: have: %s, %v, want replacement character", b, err)
+			}
+			_, err = RejectInvalidUTF8().Marshal(tt.in)
+			uerr, ok := err.(*InvalidUTF8Error)
+			if !ok {
+				t.Fatalf("have: %v, want InvalidUTF8Error", err)
+			}
+			if uerr.S != tt.s || uerr.Offset != tt.off {
+				t.Errorf("have: %q at %d, want: %q at %d", uerr.S, uerr.Offset, tt.s, tt.off)
+			}
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		b, err := RejectInvalidUTF8().Marshal("h\u00e9llo")
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := "\"h\u00e9llo\""; string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+	})
+}
+
+func TestJSONLenientNumbers(t *testing.T) {
+	type T struct {
+		N json.Number
+	}
+
+	t.Run("Marshal", func(t *testing.T) {
+		tests := []struct {
+			in       json.Number
+			expected string
+		}{
+			{"12", `{"N":12}`},
+			{"1.2.3", `{"N":"1.2.3"}`},
+			{"", `{"N":0}`},
+			{"abc", `{"N":"abc"}`},
+		}
+		for _, tt := range tests {
+			b, err := LenientNumbers().Marshal(T{tt.in})
+			if err != nil {
+				t.Errorf("Marshal(%q): %v", tt.in, err)
+				continue
+			}
+			if string(b) != tt.expected {
+				t.Errorf("Marshal(%q): have: %v, want: %v", tt.in, string(b), tt.expected)
+			}
+		}
+		if _, err := Marshal(T{"1.2.3"}); err == nil {
+			t.Errorf("Marshal without LenientNumbers: expected error")
+		}
+	})
+
+	t.Run("Unmarshal", func(t *testing.T) {
+		data := []byte(`{"N":"1.2.3"}`)
+		var v T
+		if err := LenientNumbers().UseNumber().Unmarshal(data, &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if v.N != "1.2.3" {
+			t.Errorf("have: %q, want: %q", v.N, "1.2.3")
+		}
+		if err := UseNumber().Unmarshal(data, &v); err == nil {
+			t.Errorf("Unmarshal without LenientNumbers: expected error")
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		json := LenientNumbers().UseNumber()
+		b, err := json.Marshal(T{"1.2.3"})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		var v T
+		if err := json.Unmarshal(b, &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if v.N != "1.2.3" {
+			t.Errorf("have: %q, want: %q", v.N, "1.2.3")
+		}
+	})
+}
+
+func TestJSONDisallowDuplicateKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		ptr    interface{}
+		key    string
+		offset int64
+	}{
+		{"struct", `{"Foo":"a","Bar":1,"Foo":"b"}`, new(Keys), "Foo", 19},
+		{"nested struct", `{"Foo":"a","Baz":{"x":"1","x":"2"}}`, new(Keys), "x", 26},
+		{"interface", `{"a":1,"a":2}`, new(interface{}), "a", 7},
+		{"nested interface", `[{"a":{"b":1,"b":2}}]`, new(interface{}), "b", 13},
+		{"map", `{"a":1,"a":2}`, new(map[string]interface{}), "a", 7},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := DisallowDuplicateKeys().Unmarshal([]byte(tt.data), tt.ptr)
+			dkErr, ok := err.(*DuplicateKeyError)
+			if !ok {
+				t.Fatalf("have: %v, want: DuplicateKeyError", err)
+			}
+			if dkErr.Key != tt.key || dkErr.Offset != tt.offset {
+				t.Errorf("have: %q at %d, want: %q at %d", dkErr.Key, dkErr.Offset, tt.key, tt.offset)
+			}
+			if err := Unmarshal([]byte(tt.data), tt.ptr); err != nil {
+				t.Errorf("Unmarshal without DisallowDuplicateKeys: %v", err)
+			}
+		})
+	}
+
+	t.Run("decoder", func(t *testing.T) {
+		t.Parallel()
+		dec := DisallowDuplicateKeys().NewDecoder(strings.NewReader(`{"a":1} {"a":1,"a":2}`))
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		err := dec.Decode(&v)
+		if _, ok := err.(*DuplicateKeyError); !ok {
+			t.Fatalf("have: %v, want: DuplicateKeyError", err)
+		}
+	})
+
+	t.Run("distinct objects", func(t *testing.T) {
+		t.Parallel()
+		var v interface{}
+		err := DisallowDuplicateKeys().Unmarshal([]byte(`[{"a":1},{"a":2,"b":{"a":3}}]`), &v)
+		if err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+	})
+}
+
+func TestErrorOffset(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		ptr    interface{}
+		offset int64
+	}{
+		{"syntax", `{"Foo": "foo", "Bar": [1, 2, x]}`, new(interface{}), 30},
+		{"type", `{"Foo": "foo", "Bar": "42"}`, new(Keys), 26},
+		{"nested type", `{"Baz": {"a": "b", "c": 1}}`, new(Keys), 25},
+		{"duplicate key", `{"Foo": "foo", "Foo": "bar"}`, DisallowDuplicateKeys(), 15},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			json := defaultJSON
+			ptr := tt.ptr
+			if j, ok := ptr.(*JSON); ok {
+				json = j
+				ptr = new(Keys)
+			}
+			err := json.Unmarshal([]byte(tt.data), ptr)
+			if err == nil {
+				t.Fatalf("Unmarshal: expected error")
+			}
+			offset, ok := ErrorOffset(err)
+			if !ok {
+				t.Fatalf("ErrorOffset(%v): no offset", err)
+			}
+			if offset != tt.offset {
+				t.Errorf("ErrorOffset(%v): have: %d, want: %d", err, offset, tt.offset)
+			}
+		})
+	}
+
+	t.Run("wrapped", func(t *testing.T) {
+		t.Parallel()
+		err := &MarshalerError{Type: reflect.TypeOf(0), Err: &SyntaxError{"msg", 3}}
+		if offset, ok := ErrorOffset(err); !ok || offset != 3 {
+			t.Errorf("have: %d, %v, want: 3, true", offset, ok)
+		}
+	})
+
+	t.Run("no offset", func(t *testing.T) {
+		t.Parallel()
+		if _, ok := ErrorOffset(fmt.Errorf("json: unknown field")); ok {
+			t.Errorf("have: true, want: false")
+		}
+	})
+}
+
+func TestJSONDecoderToken(t *testing.T) {
+	data := `[{"Foo": "a", "Bar": 1}, {"Foo": "b", "Bar": 2.5}]`
+
+	t.Run("tokens", func(t *testing.T) {
+		t.Parallel()
+		dec := UseNumber().NewDecoder(strings.NewReader(data))
+		var tokens []json.Token
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Token: %v", err)
+			}
+			tokens = append(tokens, tok)
+		}
+		expected := []json.Token{
+			json.Delim('['),
+			json.Delim('{'), "Foo", "a", "Bar", json.Number("1"), json.Delim('}'),
+			json.Delim('{'), "Foo", "b", "Bar", json.Number("2.5"), json.Delim('}'),
+			json.Delim(']'),
+		}
+		if !reflect.DeepEqual(tokens, expected) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", tokens, expected)
+		}
+	})
+
+	t.Run("stream array", func(t *testing.T) {
+		t.Parallel()
+		dec := New(KeyEncodeFn(strings.ToLower)).NewDecoder(strings.NewReader(`[{"foo": "a"}, {"foo": "b"}]`))
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			t.Fatalf("Token: have: %v, %v, want: [", tok, err)
+		}
+		var values []string
+		for dec.More() {
+			var v Keys
+			if err := dec.Decode(&v); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			values = append(values, v.Foo)
+		}
+		if tok, err := dec.Token(); err != nil || tok != json.Delim(']') {
+			t.Fatalf("Token: have: %v, %v, want: ]", tok, err)
+		}
+		expected := []string{"a", "b"}
+		if !reflect.DeepEqual(values, expected) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", values, expected)
+		}
+	})
+}
+
+func TestJSONEscapeHTMLRawMessage(t *testing.T) {
+	type T struct {
+		M json.RawMessage
+	}
+	v := T{M: json.RawMessage(`{ "html": "<script>alert(1)</script>" }`)}
+	escaped := `{"M":{"html":"\u003cscript\u003ealert(1)\u003c/script\u003e"}}`
+	unescaped := `{"M":{"html":"<script>alert(1)</script>"}}`
+
+	t.Run("true", func(t *testing.T) {
+		t.Parallel()
+		b, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if string(b) != escaped {
+			t.Fatalf("have: %v, want: %v", string(b), escaped)
+		}
+	})
+
+	t.Run("false", func(t *testing.T) {
+		t.Parallel()
+		b, err := defaultJSON.EscapeHTML(false).Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if string(b) != unescaped {
+			t.Fatalf("have: %v, want: %v", string(b), unescaped)
+		}
+	})
+
+	t.Run("false with encoder", func(t *testing.T) {
+		t.Parallel()
+		var buff bytes.Buffer
+		encoder := defaultJSON.EscapeHTML(false).NewEncoder(&buff)
+		if err := encoder.Encode(v); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		b := strings.TrimSpace(buff.String())
+		if b != unescaped {
+			t.Fatalf("have: %v, want: %v", b, unescaped)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		_, err := Marshal(T{M: json.RawMessage(`{"html": <script>}`)})
+		if _, ok := err.(*MarshalerError); !ok {
+			t.Fatalf("have: %v, want: MarshalerError", err)
+		}
+	})
+}
+
+func TestMarshalAppend(t *testing.T) {
+	v := Keys{
+		Foo: "foo",
+		Bar: 42,
+		Baz: map[string]string{"One": "one"},
+	}
+	for _, json := range []*JSON{defaultJSON, OmitEmpty(), Indent("", "\t")} {
+		expected, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		prefix := []byte("prefix ")
+		b, err := json.MarshalAppend(prefix, v)
+		if err != nil {
+			t.Fatalf("MarshalAppend: %v", err)
+		}
+		if !bytes.Equal(b, append(prefix, expected...)) {
+			diff(t, b, append(prefix, expected...))
+		}
+
+		// Appending into a buffer with enough capacity reuses it.
+		buf := make([]byte, 0, 1024)
+		b, err = json.MarshalAppend(buf, v)
+		if err != nil {
+			t.Fatalf("MarshalAppend: %v", err)
+		}
+		if !bytes.Equal(b, expected) {
+			diff(t, b, expected)
+		}
+		if &b[0] != &buf[:1][0] {
+			t.Errorf("MarshalAppend did not reuse buffer")
+		}
+	}
+
+	t.Run("error", func(t *testing.T) {
+		prefix := []byte("prefix")
+		b, err := MarshalAppend(prefix, make(chan int))
+		if err == nil {
+			t.Fatalf("MarshalAppend: expected error")
+		}
+		if string(b) != "prefix" {
+			t.Errorf("have: %q, want: %q", b, "prefix")
+		}
+	})
+}
+
+func TestJSONMapKeyOrder(t *testing.T) {
+	v := map[string]int{"a10": 10, "a2": 2, "a1": 1, "B": 0}
+
+	// numericCompare compares strings by their non-numeric prefix,
+	// then by the value of the number that follows it.
+	numericCompare := func(a, b string) int {
+		ai := strings.IndexAny(a, "0123456789")
+		bi := strings.IndexAny(b, "0123456789")
+		if ai < 0 || bi < 0 || a[:ai] != b[:bi] {
+			return strings.Compare(a, b)
+		}
+		an, _ := strconv.Atoi(a[ai:])
+		bn, _ := strconv.Atoi(b[bi:])
+		return an - bn
+	}
+
+	tests := []struct {
+		name     string
+		json     *JSON
+		expected string
+	}{
+		{"default", defaultJSON, `{"B":0,"a1":1,"a10":10,"a2":2}`},
+		{"numeric", MapKeyOrder(numericCompare), `{"B":0,"a1":1,"a2":2,"a10":10}`},
+		{"case insensitive", MapKeyOrder(func(a, b string) int {
+			return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+		}), `{"a1":1,"a10":10,"a2":2,"B":0}`},
+		{"reset", MapKeyOrder(numericCompare).MapKeyOrder(nil), `{"B":0,"a1":1,"a10":10,"a2":2}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := tt.json.Marshal(v)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.expected {
+				t.Fatalf("have: %v, want: %v", string(b), tt.expected)
+			}
+		})
+	}
+}
+
+type EmptyKeys struct {
+	Nil    []int
+	Empty  []int
+	Full   []int
+	NilM   map[string]int
+	EmptyM map[string]int
+	Bytes  []byte
+}
+
+func TestJSONEmptyAsNull(t *testing.T) {
+	v := EmptyKeys{
+		Empty:  []int{},
+		Full:   []int{1},
+		EmptyM: map[string]int{},
+		Bytes:  []byte{},
+	}
+
+	tests := []struct {
+		name     string
+		json     *JSON
+		expected string
+	}{
+		{"default", defaultJSON, `{"Nil":null,"Empty":[],"Full":[1],"NilM":null,"EmptyM":{},"Bytes":""}`},
+		{"EmptyAsNull", EmptyAsNull(), `{"Nil":null,"Empty":null,"Full":[1],"NilM":null,"EmptyM":null,"Bytes":null}`},
+		{"OmitEmpty", OmitEmpty(), `{"Full":[1]}`},
+		{"both", EmptyAsNull().OmitEmpty(), `{"Full":[1]}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := tt.json.Marshal(v)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.expected {
+				t.Fatalf("have: %v, want: %v", string(b), tt.expected)
+			}
+		})
+	}
+}
+
+func TestJSONNilSliceAsEmpty(t *testing.T) {
+	v := EmptyKeys{
+		Empty:  []int{},
+		Full:   []int{1},
+		EmptyM: map[string]int{},
+	}
+
+	tests := []struct {
+		name     string
+		json     *JSON
+		expected string
+	}{
+		{"default", defaultJSON, `{"Nil":null,"Empty":[],"Full":[1],"NilM":null,"EmptyM":{},"Bytes":null}`},
+		{"NilSliceAsEmpty", NilSliceAsEmpty(), `{"Nil":[],"Empty":[],"Full":[1],"NilM":{},"EmptyM":{},"Bytes":""}`},
+		{"EmptyAsNull", NilSliceAsEmpty().EmptyAsNull(), `{"Nil":null,"Empty":null,"Full":[1],"NilM":null,"EmptyM":null,"Bytes":null}`},
+		{"OmitEmpty", NilSliceAsEmpty().OmitEmpty(), `{"Full":[1]}`},
+		{"BytesAsArray", NilSliceAsEmpty().BytesAsArray(), `{"Nil":[],"Empty":[],"Full":[1],"NilM":{},"EmptyM":{},"Bytes":[]}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := tt.json.Marshal(v)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.expected {
+				t.Fatalf("have: %v, want: %v", string(b), tt.expected)
+			}
+		})
+	}
+
+	t.Run("top level", func(t *testing.T) {
+		t.Parallel()
+		b, err := NilSliceAsEmpty().Marshal([]string(nil))
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if string(b) != `[]` {
+			t.Fatalf("have: %v, want: %v", string(b), `[]`)
+		}
+	})
+}
+
+func TestJSONBytesAsArray(t *testing.T) {
+	type T struct {
+		B   []byte
+		Arr [2]byte
+	}
+	v := T{B: []byte{1, 2, 3}, Arr: [2]byte{4, 5}}
+
+	tests := []struct {
+		name     string
+		json     *JSON
+		expected string
+	}{
+		{"base64", defaultJSON, `{"B":"AQID","Arr":[4,5]}`},
+		{"array", BytesAsArray(), `{"B":[1,2,3],"Arr":[4,5]}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := tt.json.Marshal(v)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.expected {
+				t.Fatalf("have: %s, want: %s", b, tt.expected)
+			}
+			// Both forms decode with either option.
+			for _, j := range []*JSON{defaultJSON, BytesAsArray()} {
+				var v2 T
+				if err := j.Unmarshal(b, &v2); err != nil {
+					t.Fatalf("Unmarshal: %v", err)
+				}
+				if !reflect.DeepEqual(v2, v) {
+					t.Errorf("have: %+v, want: %+v", v2, v)
+				}
+			}
+		})
+	}
+
+	b, err := BytesAsArray().Marshal([]byte{})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != `[]` {
+		t.Errorf("have: %s, want: []", b)
+	}
+}
+
+func TestJSONBytesAsHex(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	for _, in := range [][]byte{{}, {0}, {0xde, 0xad, 0xbe, 0xef}, all} {
+		b, err := BytesAsHex().Marshal(in)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `"` + fmt.Sprintf("%x", in) + `"`; string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+		var out []byte
+		if err := BytesAsHex().Unmarshal(b, &out); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if !bytes.Equal(out, in) {
+			t.Errorf("have: %x, want: %x", out, in)
+		}
+	}
+
+	var out []byte
+	if err := BytesAsHex().Unmarshal([]byte(`"DEADbeef"`), &out); err != nil || !bytes.Equal(out, []byte{0xde, 0xad, 0xbe, 0xef}) {
+		t.Errorf("upper case: have: %x, %v", out, err)
+	}
+	if err := BytesAsHex().Unmarshal([]byte(`[1,2]`), &out); err != nil || !bytes.Equal(out, []byte{1, 2}) {
+		t.Errorf("array: have: %x, %v", out, err)
+	}
+	for _, in := range []string{`"abc"`, `"zz"`} {
+		if err := BytesAsHex().Unmarshal([]byte(in), &out); err == nil {
+			t.Errorf("Unmarshal(%s): expected error", in)
+		}
+	}
+
+	// The last option wins.
+	for _, tt := range []struct {
+		json     *JSON
+		expected string
+	}{
+		{BytesAsArray().BytesAsHex(), `"0102"`},
+		{BytesAsHex().BytesAsArray(), `[1,2]`},
+	} {
+		b, err := tt.json.Marshal([]byte{1, 2})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if string(b) != tt.expected {
+			t.Errorf("have: %s, want: %s", b, tt.expected)
+		}
+	}
+}
+
+func TestJSONBase64Encoding(t *testing.T) {
+	in := []byte{0xfb, 0xff, 0xbf, 0x01}
+	tests := []struct {
+		name     string
+		json     *JSON
+		expected string
+	}{
+		{"std", defaultJSON, `"+/+/AQ=="`},
+		{"url", Base64Encoding(base64.URLEncoding), `"-_-_AQ=="`},
+		{"raw url", Base64Encoding(base64.RawURLEncoding), `"-_-_AQ"`},
+		{"reset", Base64Encoding(base64.RawURLEncoding).Base64Encoding(nil), `"+/+/AQ=="`},
+		{"after hex", BytesAsHex().Base64Encoding(base64.RawStdEncoding), `"+/+/AQ"`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b, err := tt.json.Marshal(in)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.expected {
+				t.Fatalf("have: %s, want: %s", b, tt.expected)
+			}
+			var out []byte
+			if err := tt.json.Unmarshal(b, &out); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if !bytes.Equal(out, in) {
+				t.Errorf("have: %x, want: %x", out, in)
+			}
+		})
+	}
+
+	// Padded input is accepted by encodings without padding.
+	var out []byte
+	if err := Base64Encoding(base64.RawURLEncoding).Unmarshal([]byte(`"-_-_AQ=="`), &out); err != nil || !bytes.Equal(out, in) {
+		t.Errorf("padded: have: %x, %v", out, err)
+	}
+	// But not the other way around.
+	if err := Base64Encoding(base64.URLEncoding).Unmarshal([]byte(`"-_-_AQ"`), &out); err == nil {
+		t.Errorf("unpadded: expected error")
+	}
+	// And the alphabets are not mixed.
+	if err := Base64Encoding(base64.RawURLEncoding).Unmarshal([]byte(`"+/+/AQ"`), &out); err == nil {
+		t.Errorf("std alphabet: expected error")
+	}
+}
+
+func TestRegisterTypeEncoder(t *testing.T) {
+	type T struct {
+		D  time.Duration
+		DP *time.Duration
+		DS []time.Duration
+		I  int64
+	}
+	d := 90 * time.Minute
+	v := T{D: d, DP: &d, DS: []time.Duration{time.Second}, I: 5}
+
+	json := New()
+	// Populate the cache before registering the encoder.
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"D":5400000000000,"DP":5400000000000,"DS":[1000000000],"I":5}`; string(b) != expected {
+		t.Fatalf("have: %v, want: %v", string(b), expected)
+	}
+
+	json.RegisterTypeEncoder(reflect.TypeOf(time.Duration(0)), func(v interface{}) ([]byte, error) {
+		s := v.(time.Duration).String()
+		if strings.HasSuffix(s, "m0s") {
+			s = strings.TrimSuffix(s, "0s")
+		}
+		return []byte(strconv.Quote(s)), nil
+	})
+	b, err = json.OmitEmpty().Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"D":"1h30m","DP":"1h30m","DS":["1s"],"I":5}`; string(b) != expected {
+		t.Fatalf("have: %v, want: %v", string(b), expected)
+	}
+
+	t.Run("default unaffected", func(t *testing.T) {
+		b, err := Marshal(d)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `5400000000000`; string(b) != expected {
+			t.Fatalf("have: %v, want: %v", string(b), expected)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		json := New()
+		json.RegisterTypeEncoder(reflect.TypeOf(time.Duration(0)), func(v interface{}) ([]byte, error) {
+			return []byte(`{`), nil
+		})
+		_, err := json.Marshal(d)
+		if _, ok := err.(*MarshalerError); !ok {
+			t.Fatalf("have: %v, want: MarshalerError", err)
+		}
+	})
+}
+
+func TestRegisterTypeDecoder(t *testing.T) {
+	type T struct {
+		D  time.Duration
+		DP *time.Duration
+		DS []time.Duration
+		N  interface{}
+	}
+
+	j := New()
+	j.RegisterTypeDecoder(reflect.TypeOf(time.Duration(0)), func(data []byte, v interface{}) error {
+		d := v.(*time.Duration)
+		if string(data) == "null" {
+			return nil
+		}
+		var s string
+		if err := Unmarshal(data, &s); err != nil {
+			// Not a string, decode nanoseconds.
+			return Unmarshal(data, (*int64)(d))
+		}
+		var err error
+		*d, err = time.ParseDuration(s)
+		return err
+	})
+
+	data := []byte(`{"D":"1h30m","DP":"2s","DS":["1m",5],"N":1.5}`)
+	expectedDP := 2 * time.Second
+	expected := T{
+		D:  90 * time.Minute,
+		DP: &expectedDP,
+		DS: []time.Duration{time.Minute, 5},
+		N:  json.Number("1.5"),
+	}
+	var v T
+	if err := j.UseNumber().Unmarshal(data, &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v, expected)
+	}
+
+	t.Run("top level", func(t *testing.T) {
+		var d time.Duration
+		if err := j.Unmarshal([]byte(`"1h30m"`), &d); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if d != 90*time.Minute {
+			t.Errorf("have: %v, want: %v", d, 90*time.Minute)
+		}
+	})
+
+	t.Run("null pointer", func(t *testing.T) {
+		v := T{DP: &expectedDP}
+		if err := j.Unmarshal([]byte(`{"DP":null}`), &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if v.DP != nil {
+			t.Errorf("have: %v, want: nil", v.DP)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var d time.Duration
+		if err := j.Unmarshal([]byte(`"1x"`), &d); err == nil {
+			t.Fatalf("Unmarshal: expected error")
+		}
+	})
+
+	t.Run("default unaffected", func(t *testing.T) {
+		var d time.Duration
+		err := Unmarshal([]byte(`"1h30m"`), &d)
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			t.Fatalf("have: %v, want: UnmarshalTypeError", err)
+		}
+	})
+}
+
+type discriminatorCat struct {
+	Type  string
+	Name  string
+	Lives int
+}
+
+type discriminatorDog struct {
+	Type string
+	Name string
+	Good bool
+}
+
+func TestRegisterDiscriminator(t *testing.T) {
+	j := New()
+	j.RegisterDiscriminator("type", map[string]reflect.Type{
+		"cat": reflect.TypeOf(discriminatorCat{}),
+		"dog": reflect.TypeOf(&discriminatorDog{}),
+	})
+
+	data := []byte(`[
+		{"type": "cat", "name": "Tom", "lives": 9},
+		{"name": "Rex", "good": true, "type": "dog"},
+		{"type": "fish", "name": "Nemo"},
+		{"name": "Nobody"},
+		{"type": 1},
+		"cat"
+	]`)
+	expected := []interface{}{
+		discriminatorCat{Type: "cat", Name: "Tom", Lives: 9},
+		&discriminatorDog{Type: "dog", Name: "Rex", Good: true},
+		map[string]interface{}{"type": "fish", "name": "Nemo"},
+		map[string]interface{}{"name": "Nobody"},
+		map[string]interface{}{"type": 1.0},
+		"cat",
+	}
+
+	t.Run("slice", func(t *testing.T) {
+		var v []interface{}
+		if err := j.Unmarshal(data, &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v, expected)
+		}
+	})
+
+	t.Run("interface", func(t *testing.T) {
+		var v interface{}
+		if err := j.Unmarshal(data, &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v, expected)
+		}
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		var v map[string]interface{}
+		if err := j.Unmarshal([]byte(`{"pet":{"type":"cat","name":"Tom"},"other":{"pets":[{"type":"dog"}]}}`), &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		expected := map[string]interface{}{
+			"pet":   discriminatorCat{Type: "cat", Name: "Tom"},
+			"other": map[string]interface{}{"pets": []interface{}{&discriminatorDog{Type: "dog"}}},
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v, expected)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var v []interface{}
+		err := j.Unmarshal([]byte(`[{"type":"cat","lives":"nine"}]`), &v)
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			t.Fatalf("have: %v, want: UnmarshalTypeError", err)
+		}
+	})
+
+	t.Run("default unaffected", func(t *testing.T) {
+		var v interface{}
+		if err := Unmarshal([]byte(`{"type":"cat"}`), &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if _, ok := v.(map[string]interface{}); !ok {
+			t.Errorf("have: %T, want: map[string]interface{}", v)
+		}
+	})
+
+	t.Run("trees unaffected", func(t *testing.T) {
+		// Register on a copy of the default encoder/decoder, which shares
+		// its registry, using a field name no other test uses.
+		UseNumber().RegisterDiscriminator("treeKind", map[string]reflect.Type{
+			"cat": reflect.TypeOf(discriminatorCat{}),
+		})
+		doc := []byte(`{"pet":{"treeKind":"cat","extra":1}}`)
+
+		b, err := New().MergePatch(doc, []byte(`{"pet":{"lives":9}}`))
+		if err != nil {
+			t.Fatalf("MergePatch: %v", err)
+		}
+		if expected := `{"pet":{"treeKind":"cat","extra":1,"lives":9}}`; string(b) != expected {
+			t.Errorf("MergePatch have: %s, want: %s", b, expected)
+		}
+
+		b, err = New().ApplyPatch(doc, []byte(`[{"op":"add","path":"/pet/z","value":true}]`))
+		if err != nil {
+			t.Fatalf("ApplyPatch: %v", err)
+		}
+		if expected := `{"pet":{"treeKind":"cat","extra":1,"z":true}}`; string(b) != expected {
+			t.Errorf("ApplyPatch have: %s, want: %s", b, expected)
+		}
+
+		b, err = New().Diff(doc, []byte(`{"pet":{"treeKind":"cat","extra":2}}`))
+		if err != nil {
+			t.Fatalf("Diff: %v", err)
+		}
+		if expected := `[{"op":"replace","path":"/pet/extra","value":2}]`; string(b) != expected {
+			t.Errorf("Diff have: %s, want: %s", b, expected)
+		}
+
+		b, err = New().FlattenKeys(".").Marshal(map[string]interface{}{
+			"pet": json.RawMessage(`{"treeKind":"cat","extra":1}`),
+		})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `{"pet.treeKind":"cat","pet.extra":1}`; string(b) != expected {
+			t.Errorf("FlattenKeys have: %s, want: %s", b, expected)
+		}
+	})
+}
+
+type discriminatorShape interface {
+	Area() float64
+}
+
+type discriminatorCircle struct {
+	R float64
+}
+
+func (c discriminatorCircle) Area() float64 { return 3 * c.R * c.R }
+
+type discriminatorRect struct {
+	W, H float64
+}
+
+func (r *discriminatorRect) Area() float64 { return r.W * r.H }
+
+func TestInjectDiscriminators(t *testing.T) {
+	j := New(KeyEncodeFn(strings.ToLower))
+	j.RegisterDiscriminator("kind", map[string]reflect.Type{
+		"circle": reflect.TypeOf(discriminatorCircle{}),
+		"rect":   reflect.TypeOf(&discriminatorRect{}),
+	})
+	shapes := []discriminatorShape{
+		discriminatorCircle{R: 1},
+		&discriminatorRect{W: 2, H: 3},
+	}
+
+	b, err := j.InjectDiscriminators().Marshal(shapes)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `[{"kind":"circle","r":1},{"kind":"rect","w":2,"h":3}]`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	var have []discriminatorShape
+	if err := j.Unmarshal(b, &have); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(have, shapes) {
+		t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", have, shapes)
+	}
+
+	t.Run("not injected by default", func(t *testing.T) {
+		b, err := j.Marshal(shapes)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `[{"r":1},{"w":2,"h":3}]`; string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+	})
+
+	t.Run("existing field", func(t *testing.T) {
+		j := New()
+		j.RegisterDiscriminator("Type", map[string]reflect.Type{"cat": reflect.TypeOf(discriminatorCat{})})
+		b, err := j.InjectDiscriminators().Marshal(discriminatorCat{Type: "cat", Name: "Tom"})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `{"Type":"cat","Name":"Tom","Lives":0}`; string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+	})
+
+	t.Run("empty struct", func(t *testing.T) {
+		type E struct{}
+		j := New()
+		j.RegisterDiscriminator("type", map[string]reflect.Type{"e": reflect.TypeOf(E{})})
+		b, err := j.InjectDiscriminators().Marshal(E{})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `{"type":"e"}`; string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		j := j.Clone()
+		j.RegisterDiscriminator("kind", map[string]reflect.Type{"cat": reflect.TypeOf(discriminatorCat{})})
+		var have []discriminatorShape
+		err := j.Unmarshal([]byte(`[{"kind":"cat"}]`), &have)
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			t.Fatalf("have: %v, want: UnmarshalTypeError", err)
+		}
+	})
+}
+
+func TestJSONTimeFormat(t *testing.T) {
+	type T struct {
+		T  time.Time
+		TP *time.Time
+		TS []time.Time
+	}
+
+	const layout = "2006-01-02"
+	// 05:00 on January 1st at UTC+14 is still December 31st in UTC.
+	kiritimati := time.FixedZone("LINT", 14*60*60)
+	date := time.Date(2020, 1, 1, 5, 0, 0, 0, kiritimati)
+	utcDate := time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	t.Run("marshal", func(t *testing.T) {
+		v := T{
+			T:  date,
+			TP: &date,
+			TS: []time.Time{date, date.UTC()},
+		}
+		b, err := TimeFormat(layout).Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		expected := `{"T":"2020-01-01","TP":"2020-01-01","TS":["2020-01-01","2019-12-31"]}`
+		if string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+	})
+
+	t.Run("marshal default", func(t *testing.T) {
+		b, err := TimeFormat(layout).TimeFormat("").Marshal(date)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		expected := `"2020-01-01T05:00:00+14:00"`
+		if string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+	})
+
+	t.Run("unmarshal", func(t *testing.T) {
+		var v T
+		data := []byte(`{"T":"2019-12-31","TP":"2019-12-31","TS":["2019-12-31"]}`)
+		if err := TimeFormat(layout).Unmarshal(data, &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		expected := T{
+			T:  utcDate,
+			TP: &utcDate,
+			TS: []time.Time{utcDate},
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v, expected)
+		}
+	})
+
+	t.Run("unmarshal with offset", func(t *testing.T) {
+		var tm time.Time
+		if err := TimeFormat("2006-01-02 15:04 -0700").Unmarshal([]byte(`"2020-01-01 05:00 +1400"`), &tm); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if !tm.Equal(date) {
+			t.Errorf("have: %v, want: %v", tm, date)
+		}
+		if _, offset := tm.Zone(); offset != 14*60*60 {
+			t.Errorf("have offset: %d, want: %d", offset, 14*60*60)
+		}
+	})
+
+	t.Run("unmarshal null", func(t *testing.T) {
+		v := T{TP: &date}
+		if err := TimeFormat(layout).Unmarshal([]byte(`{"TP":null}`), &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if v.TP != nil {
+			t.Errorf("have: %v, want: nil", v.TP)
+		}
+	})
+
+	t.Run("unmarshal error", func(t *testing.T) {
+		var tm time.Time
+		err := TimeFormat(layout).Unmarshal([]byte(`"2020-01-01T05:00:00Z"`), &tm)
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			t.Errorf("have: %T %[1]v, want: *json.UnmarshalTypeError", err)
+		}
+		var st struct {
+			At time.Time `json:"at"`
+		}
+		err = TimeFormat(layout).Unmarshal([]byte(`{"at": "soon"}`), &st)
+		ute, ok := err.(*json.UnmarshalTypeError)
+		if !ok || ute.Value != `string "soon"` || ute.Field != "at" || ute.Offset != 13 {
+			t.Errorf("have: %#v, want UnmarshalTypeError for field at", err)
+		}
+	})
+}
+
+func TestJSONDurationAsString(t *testing.T) {
+	type T struct {
+		D  time.Duration
+		DP *time.Duration
+		DS []time.Duration
+		M  map[string]time.Duration
+	}
+	d := 90 * time.Minute
+	v := T{
+		D:  d,
+		DP: &d,
+		DS: []time.Duration{1500 * time.Millisecond, 250 * time.Microsecond, 42, -2 * time.Second, 0},
+		M:  map[string]time.Duration{"timeout": 30 * time.Second},
+	}
+
+	b, err := DurationAsString().Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected := `{"D":"1h30m0s","DP":"1h30m0s","DS":["1.5s","250µs","42ns","-2s","0s"],"M":{"timeout":"30s"}}`
+	if string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+	var v2 T
+	if err := DurationAsString().Unmarshal(b, &v2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v2, v) {
+		t.Errorf("have: %+v, want: %+v", v2, v)
+	}
+
+	// Without the option, durations are numbers of nanoseconds.
+	b, err = Marshal(v.DS)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `[1500000000,250000,42,-2000000000,0]`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	// Numbers are still accepted.
+	var ds []time.Duration
+	if err := DurationAsString().Unmarshal([]byte(`[1000, "1ms", "1h2m3.5s"]`), &ds); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if expected := []time.Duration{time.Microsecond, time.Millisecond, time.Hour + 2*time.Minute + 3500*time.Millisecond}; !reflect.DeepEqual(ds, expected) {
+		t.Errorf("have: %v, want: %v", ds, expected)
+	}
+
+	var dur time.Duration
+	if err := DurationAsString().Unmarshal([]byte(`"1 hour"`), &dur); err == nil {
+		t.Error("expected error for invalid duration")
+	}
+	var st struct {
+		Timeout time.Duration `json:"timeout"`
+	}
+	err = DurationAsString().Unmarshal([]byte(`{"timeout": "soon"}`), &st)
+	ute, ok := err.(*json.UnmarshalTypeError)
+	if !ok || ute.Value != `string "soon"` || ute.Field != "timeout" || ute.Offset != 18 {
+		t.Errorf("have: %#v, want UnmarshalTypeError for field timeout", err)
+	}
+	if err := Unmarshal([]byte(`"1h"`), &dur); err == nil {
+		t.Error("without DurationAsString: expected error")
+	}
+
+	t.Run("string option", func(t *testing.T) {
+		type S struct {
+			D time.Duration `json:",string"`
+		}
+		v := S{D: 90 * time.Second}
+		b, err := DurationAsString().Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `{"D":"\"1m30s\""}`; string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+		var v2 S
+		if err := DurationAsString().Unmarshal(b, &v2); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if v2 != v {
+			t.Errorf("have: %+v, want: %+v", v2, v)
+		}
+	})
+}
+
+// marshalingError is an error that also implements json.Marshaler.
+type marshalingError struct{ code int }
+
+func (e *marshalingError) Error() string { return fmt.Sprintf("error %d", e.code) }
+
+func (e *marshalingError) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Itoa(e.code)), nil
+}
+
+func TestJSONErrorsAsString(t *testing.T) {
+	type T struct {
+		Err   error       `json:"err"`
+		Nil   error       `json:"nil"`
+		Any   interface{} `json:"any"`
+		List  []error     `json:"list"`
+		Typed error       `json:"typed"`
+	}
+	v := T{
+		Err:   errors.New("boom"),
+		Any:   io.EOF,
+		List:  []error{io.ErrUnexpectedEOF, &marshalingError{42}},
+		Typed: (*marshalingError)(nil),
+	}
+
+	b, err := ErrorsAsString().Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected := `{"err":"boom","nil":null,"any":"EOF","list":["unexpected EOF","error 42"],"typed":null}`
+	if string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	b, err = ErrorsAsString().Marshal(struct {
+		Err error `json:"err"`
+	}{errors.New("boom")})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"err":"boom"}`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	// Without the option, errors are encoded as their dynamic values.
+	b, err = Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected = `{"err":{},"nil":null,"any":{},"list":[{},42],"typed":null}`
+	if string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	t.Run("concrete types", func(t *testing.T) {
+		b, err := ErrorsAsString().Marshal(errors.New("boom"))
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `"boom"`; string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+
+		type C struct {
+			Ptr   *marshalingError `json:"ptr"`
+			Nil   *marshalingError `json:"nil"`
+			Value valueError       `json:"value"`
+			Addr  addrError        `json:"addr"`
+		}
+		c := C{Ptr: &marshalingError{1}, Value: valueError{2}, Addr: addrError{3}}
+		b, err = ErrorsAsString().Marshal(&c)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `{"ptr":"error 1","nil":null,"value":"value 2","addr":"addr 3"}`; string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+		// The pointer receiver of addrError can't be used if c isn't addressable.
+		b, err = ErrorsAsString().Marshal(c)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `{"ptr":"error 1","nil":null,"value":"value 2","addr":{"Code":3}}`; string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+		b, err = Marshal(&c)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `{"ptr":1,"nil":null,"value":{"Code":2},"addr":{"Code":3}}`; string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+	})
+}
+
+type valueError struct{ Code int }
+
+func (e valueError) Error() string { return fmt.Sprintf("value %d", e.Code) }
+
+type addrError struct{ Code int }
+
+func (e *addrError) Error() string { return fmt.Sprintf("addr %d", e.Code) }
+
+// cancelOnMarshal cancels a context when it is marshaled or unmarshaled.
+type cancelOnMarshal struct {
+	cancel context.CancelFunc
+}
+
+func (c cancelOnMarshal) MarshalJSON() ([]byte, error) {
+	c.cancel()
+	return []byte(`1`), nil
+}
+
+func (c *cancelOnMarshal) UnmarshalJSON([]byte) error {
+	c.cancel()
+	return nil
+}
+
+func TestMarshalConcurrent(t *testing.T) {
+	values := []interface{}{
+		Keys{Foo: "foo", Bar: 42, Baz: map[string]string{"One": "one"}},
+		[]int{1, 2, 3},
+		strings.Repeat("x", 5000),
+		map[string]interface{}{"a": []interface{}{1.5, "b", nil}},
+	}
+	expected := make([][]byte, len(values))
+	for i, v := range values {
+		b, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		expected[i] = b
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				n := (g + i) % len(values)
+				b, err := Marshal(values[n])
+				if err != nil {
+					t.Errorf("Marshal: %v", err)
+					return
+				}
+				if !bytes.Equal(b, expected[n]) {
+					t.Errorf("have: %.50q, want: %.50q", b, expected[n])
+					return
+				}
+				// Failed encodings return their state to the pool too.
+				if _, err := Marshal([]interface{}{1, make(chan int)}); err == nil {
+					t.Errorf("expected error")
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestMarshalContext(t *testing.T) {
+	t.Run("not cancelled", func(t *testing.T) {
+		b, err := MarshalContext(context.Background(), []int{1, 2, 3})
+		if err != nil {
+			t.Fatalf("MarshalContext: %v", err)
+		}
+		if string(b) != `[1,2,3]` {
+			t.Errorf("have: %s, want: %s", b, `[1,2,3]`)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := MarshalContext(ctx, 1)
+		if err != context.Canceled {
+			t.Errorf("have: %v, want: %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("cancelled while encoding", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		v := map[string]interface{}{
+			"a": cancelOnMarshal{cancel},
+			"b": []int{1},
+		}
+		_, err := Indent("", "  ").MarshalContext(ctx, v)
+		if err != context.Canceled {
+			t.Errorf("have: %v, want: %v", err, context.Canceled)
+		}
+	})
+}
+
+// chunkWriter records the size of each write.
+type chunkWriter struct {
+	bytes.Buffer
+	writes []int
+	err    error
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.writes = append(w.writes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func TestMarshalToWriter(t *testing.T) {
+	type Item struct {
+		ID   int
+		Name string
+		Tags []string
+	}
+	items := make([]Item, 1000)
+	for i := range items {
+		items[i] = Item{ID: i, Name: fmt.Sprintf("item %d", i), Tags: []string{"a", "<b>"}}
+	}
+
+	for _, c := range []*JSON{defaultJSON, OmitEmpty(), Indent("", "  ")} {
+		b, err := c.Marshal(items)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		h := sha256.New()
+		if err := c.MarshalToWriter(h, items); err != nil {
+			t.Fatalf("MarshalToWriter: %v", err)
+		}
+		if sum := sha256.Sum256(b); !bytes.Equal(h.Sum(nil), sum[:]) {
+			t.Errorf("have digest: %x, want: %x", h.Sum(nil), sum)
+		}
+	}
+
+	// The output is written in chunks while encoding.
+	var w chunkWriter
+	if err := MarshalToWriter(&w, items); err != nil {
+		t.Fatalf("MarshalToWriter: %v", err)
+	}
+	if len(w.writes) < 2 {
+		t.Errorf("have %d writes, want more", len(w.writes))
+	}
+	for _, n := range w.writes {
+		if n > 2*streamFlushSize {
+			t.Errorf("write of %d bytes", n)
+		}
+	}
+	b, _ := Marshal(items)
+	if !bytes.Equal(w.Bytes(), b) {
+		t.Errorf("have: %s, want: %s", w.Bytes(), b)
+	}
+
+	// Small values are written at once, without a newline.
+	w = chunkWriter{}
+	if err := MarshalToWriter(&w, map[string]int{"a": 1}); err != nil {
+		t.Fatalf("MarshalToWriter: %v", err)
+	}
+	if w.String() != `{"a":1}` || len(w.writes) != 1 {
+		t.Errorf("have: %q in %d writes", w.String(), len(w.writes))
+	}
+
+	errWrite := errors.New("write error")
+	w = chunkWriter{err: errWrite}
+	if err := MarshalToWriter(&w, items); err != errWrite {
+		t.Errorf("have: %v, want: %v", err, errWrite)
+	}
+	if err := MarshalToWriter(&w, math.NaN()); err == nil {
+		t.Error("expected unsupported value error")
+	}
+}
+
+func TestUnmarshalContext(t *testing.T) {
+	t.Run("not cancelled", func(t *testing.T) {
+		var v []int
+		if err := UnmarshalContext(context.Background(), []byte(`[1,2,3]`), &v); err != nil {
+			t.Fatalf("UnmarshalContext: %v", err)
+		}
+		if !reflect.DeepEqual(v, []int{1, 2, 3}) {
+			t.Errorf("have: %v, want: %v", v, []int{1, 2, 3})
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var v int
+		err := UnmarshalContext(ctx, []byte(`1`), &v)
+		if err != context.Canceled {
+			t.Errorf("have: %v, want: %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("cancelled while decoding", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var v struct {
+			A cancelOnMarshal
+			B []int
+		}
+		v.A.cancel = cancel
+		err := UnmarshalContext(ctx, []byte(`{"A":1,"B":[1,2]}`), &v)
+		if err != context.Canceled {
+			t.Errorf("have: %v, want: %v", err, context.Canceled)
+		}
+		if v.B != nil {
+			t.Errorf("have: %v, want: nil", v.B)
+		}
+	})
+}
+
+func TestJSONMergeDecode(t *testing.T) {
+	type Address struct {
+		Street string
+		City   string
+	}
+	type Person struct {
+		Name     string
+		Age      int
+		Home     Address
+		Work     *Address
+		Contacts map[string]Address
+		Extra    map[string]interface{}
+	}
+	populated := func() Person {
+		return Person{
+			Name: "John",
+			Age:  42,
+			Home: Address{Street: "Main St", City: "Springfield"},
+			Work: &Address{Street: "Office Rd", City: "Shelbyville"},
+			Contacts: map[string]Address{
+				"mom": {Street: "Elm St", City: "Springfield"},
+				"dad": {Street: "Oak St", City: "Capital City"},
+			},
+			Extra: map[string]interface{}{
+				"tags": "a",
+				"meta": map[string]interface{}{"x": 1.0, "y": 2.0},
+			},
+		}
+	}
+	patch := []byte(`{
+		"Age": 43,
+		"Home": {"Street": "Evergreen Terrace"},
+		"Work": {"City": "Ogdenville"},
+		"Contacts": {"mom": {"City": "North Haverbrook"}, "sis": {"Street": "Pine St"}},
+		"Extra": {"meta": {"y": 3, "z": 4}}
+	}`)
+
+	t.Run("merge", func(t *testing.T) {
+		v := populated()
+		if err := MergeDecode().Unmarshal(patch, &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		expected := Person{
+			Name: "John",
+			Age:  43,
+			Home: Address{Street: "Evergreen Terrace", City: "Springfield"},
+			Work: &Address{Street: "Office Rd", City: "Ogdenville"},
+			Contacts: map[string]Address{
+				"mom": {Street: "Elm St", City: "North Haverbrook"},
+				"dad": {Street: "Oak St", City: "Capital City"},
+				"sis": {Street: "Pine St"},
+			},
+			Extra: map[string]interface{}{
+				"tags": "a",
+				"meta": map[string]interface{}{"x": 1.0, "y": 3.0, "z": 4.0},
+			},
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v, expected)
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		v := populated()
+		if err := Unmarshal(patch, &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		// Map entries are replaced.
+		if mom := v.Contacts["mom"]; mom.Street != "" {
+			t.Errorf("have: %#+v, want empty Street", mom)
+		}
+		if meta := v.Extra["meta"].(map[string]interface{}); meta["x"] != nil {
+			t.Errorf("have: %#+v, want no x", meta)
+		}
+	})
+
+	t.Run("decoder", func(t *testing.T) {
+		v := populated()
+		if err := MergeDecode().NewDecoder(bytes.NewReader(patch)).Decode(&v); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if mom := v.Contacts["mom"]; mom.Street != "Elm St" {
+			t.Errorf("have: %#+v, want Street Elm St", mom)
+		}
+	})
+}
+
+func TestJSONReplaceDecode(t *testing.T) {
+	type Item struct {
+		A, B int
+	}
+	type T struct {
+		S  []int
+		SI []Item
+		AI [2]Item
+		M  map[string]int
+	}
+	populated := func() T {
+		return T{
+			S:  []int{1, 2, 3},
+			SI: []Item{{1, 2}, {3, 4}},
+			AI: [2]Item{{1, 2}, {3, 4}},
+			M:  map[string]int{"a": 1, "b": 2},
+		}
+	}
+	data := []byte(`{"S":[9],"SI":[{"A":5}],"AI":[{"B":6}],"M":{"c":3}}`)
+
+	t.Run("replace", func(t *testing.T) {
+		v := populated()
+		s := v.S
+		if err := ReplaceDecode().Unmarshal(data, &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		expected := T{
+			S:  []int{9},
+			SI: []Item{{A: 5}},
+			AI: [2]Item{{B: 6}},
+			M:  map[string]int{"c": 3},
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v, expected)
+		}
+		if &s[0] != &v.S[0] {
+			t.Errorf("backing array was not reused")
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		v := populated()
+		if err := Unmarshal(data, &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		expected := T{
+			S:  []int{9},
+			SI: []Item{{A: 5, B: 2}},
+			AI: [2]Item{{A: 1, B: 6}},
+			M:  map[string]int{"a": 1, "b": 2, "c": 3},
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v, expected)
+		}
+	})
+
+	t.Run("last option wins", func(t *testing.T) {
+		v := populated()
+		if err := ReplaceDecode().MergeDecode().Unmarshal(data, &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if len(v.M) != 3 {
+			t.Errorf("have: %v, want merged map", v.M)
+		}
+		v = populated()
+		if err := MergeDecode().ReplaceDecode().NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if len(v.M) != 1 {
+			t.Errorf("have: %v, want replaced map", v.M)
+		}
+	})
+}
+
+type Celsius float64
+
+type Level int8
+
+type Enabled bool
+
+func TestStringTagNamedTypes(t *testing.T) {
+	type T struct {
+		Temp  Celsius  `json:",string"`
+		TempP *Celsius `json:",string"`
+		Level Level    `json:",string"`
+		On    Enabled  `json:",string"`
+	}
+	temp := Celsius(-3.5)
+	v := T{Temp: 21.5, TempP: &temp, Level: -2, On: true}
+	expected := `{"Temp":"21.5","TempP":"-3.5","Level":"-2","On":"true"}`
+
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	var v2 T
+	if err := Unmarshal(b, &v2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v2, v) {
+		t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v2, v)
+	}
+
+	err = Unmarshal([]byte(`{"Temp":"hot"}`), &v2)
+	if err == nil {
+		t.Errorf("expected error for invalid quoted number")
+	}
+}
+
+func TestJSONStrictStringTag(t *testing.T) {
+	num := 0
+	tests := []interface{}{
+		&struct {
+			T time.Time `json:",string"`
+		}{},
+		&struct {
+			M map[string]string `json:",string"`
+		}{M: make(map[string]string)},
+		&struct {
+			S []string `json:",string"`
+		}{S: make([]string, 0)},
+		&struct {
+			A [1]string `json:",string"`
+		}{},
+		&struct {
+			I interface{} `json:",string"`
+		}{I: num},
+	}
+	j := StrictStringTag()
+	for _, v := range tests {
+		data, err := Marshal(v)
+		if err != nil {
+			t.Errorf("Marshal(%T) without StrictStringTag: %v", v, err)
+		}
+		if err := Unmarshal(data, v); err != nil {
+			t.Errorf("Unmarshal(%T) without StrictStringTag: %v", v, err)
+		}
+
+		_, err = j.Marshal(v)
+		if err, ok := err.(*InvalidStringTagError); !ok || err.Option != "string" {
+			t.Errorf("Marshal(%T): have: %v, want InvalidStringTagError", v, err)
+		}
+		err = j.Unmarshal(data, v)
+		if err, ok := err.(*InvalidStringTagError); !ok || err.Option != "string" {
+			t.Errorf("Unmarshal(%T): have: %v, want InvalidStringTagError", v, err)
+		}
+	}
+
+	// The option still applies to the types it supports.
+	item := struct {
+		P *int `json:",string"`
+	}{P: &num}
+	data, err := j.Marshal(item)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"P":"0"}`; string(data) != expected {
+		t.Errorf("have: %s, want: %s", data, expected)
+	}
+	if err := j.Unmarshal(data, &item); err != nil {
+		t.Errorf("Unmarshal: %v", err)
+	}
+}
+
+func TestStringValuesTag(t *testing.T) {
+	type T struct {
+		M  map[string]int      `json:",stringvalues"`
+		F  map[string]*float64 `json:"f,stringvalues"`
+		MP *map[string]Celsius `json:",stringvalues"`
+		N  map[string]map[string]int
+	}
+	f := 1.5
+	mp := map[string]Celsius{"x": -2}
+	v := T{
+		M:  map[string]int{"k": 5},
+		F:  map[string]*float64{"a": &f, "b": nil},
+		MP: &mp,
+		N:  map[string]map[string]int{"n": {"k": 1}},
+	}
+	expected := `{"M":{"k":"5"},"f":{"a":"1.5","b":null},"MP":{"x":"-2"},"N":{"n":{"k":1}}}`
+
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	var v2 T
+	if err := Unmarshal(b, &v2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v2, v) {
+		t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v2, v)
+	}
+
+	t.Run("unquoted", func(t *testing.T) {
+		var v T
+		if err := Unmarshal([]byte(`{"M":{"a":"5","b":6}}`), &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if expected := map[string]int{"a": 5, "b": 6}; !reflect.DeepEqual(v.M, expected) {
+			t.Errorf("have: %v, want: %v", v.M, expected)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		var v T
+		if err := Unmarshal([]byte(`{"M":{"a":"five"}}`), &v); err == nil {
+			t.Errorf("expected error for invalid quoted number")
+		}
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		v := struct {
+			M map[string]string `json:",stringvalues"`
+		}{}
+		_, err := Marshal(v)
+		if err, ok := err.(*InvalidStringTagError); !ok || err.Option != "stringvalues" {
+			t.Errorf("have: %v, want InvalidStringTagError", err)
+		}
+	})
+}
+
+func TestTagKey(t *testing.T) {
+	type T struct {
+		ID       int    `api:"id" json:"json_id"`
+		Name     string `api:"name,omitempty"`
+		Email    string `json:"email"`
+		Password string `api:"-" json:"password"`
+		Age      int    `api:",string"`
+	}
+	v := T{ID: 1, Email: "jdoe@example.com", Password: "secret", Age: 42}
+
+	tests := []struct {
+		name     string
+		json     *JSON
+		expected string
+	}{
+		{"no fallback", New(TagKey("api", false)), `{"id":1,"Email":"jdoe@example.com","Age":"42"}`},
+		{"fallback", New(TagKey("api", true)), `{"id":1,"email":"jdoe@example.com","Age":"42"}`},
+		{"default", New(), `{"json_id":1,"Name":"","email":"jdoe@example.com","password":"secret","Age":42}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.json.Marshal(v)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.expected {
+				t.Errorf("have: %s, want: %s", b, tt.expected)
+			}
+
+			var v2 T
+			if err := tt.json.Unmarshal(b, &v2); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			expected := v
+			if !strings.Contains(tt.expected, "password") {
+				expected.Password = ""
+			}
+			if !reflect.DeepEqual(v2, expected) {
+				t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v2, expected)
+			}
+		})
+	}
+}
+
+func TestTagKeys(t *testing.T) {
+	type T struct {
+		JSONOnly string `json:"json_only"`
+		YAMLOnly string `yaml:"yaml_only"`
+		Both     string `json:"both_json" yaml:"both_yaml"`
+		EmptyTag string `json:"" yaml:"empty_yaml"`
+		Skipped  string `yaml:"-"`
+		None     string
+	}
+	v := T{"a", "b", "c", "d", "e", "f"}
+
+	tests := []struct {
+		keys     []string
+		expected string
+	}{
+		{[]string{"json", "yaml"}, `{"json_only":"a","yaml_only":"b","both_json":"c","EmptyTag":"d","None":"f"}`},
+		{[]string{"yaml", "json"}, `{"json_only":"a","yaml_only":"b","both_yaml":"c","empty_yaml":"d","None":"f"}`},
+		{[]string{"yaml"}, `{"JSONOnly":"a","yaml_only":"b","both_yaml":"c","empty_yaml":"d","None":"f"}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(strings.Join(tt.keys, ","), func(t *testing.T) {
+			j := New(TagKeys(tt.keys...))
+			b, err := j.Marshal(v)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.expected {
+				t.Errorf("have: %s, want: %s", b, tt.expected)
+			}
+
+			var v2 T
+			if err := j.Unmarshal(b, &v2); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			expected := v
+			expected.Skipped = ""
+			if !reflect.DeepEqual(v2, expected) {
+				t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v2, expected)
+			}
+		})
+	}
+}
+
+type NestedBase struct {
+	ID      int
+	Created string
+}
+
+type nestedHidden struct {
+	Secret string
+}
+
+func TestNestEmbedded(t *testing.T) {
+	type T struct {
+		NestedBase
+		*Keys
+		nestedHidden
+		Name string
+	}
+	v := T{
+		NestedBase:   NestedBase{ID: 1, Created: "today"},
+		Keys:         &Keys{Foo: "foo"},
+		nestedHidden: nestedHidden{Secret: "s"},
+		Name:         "n",
+	}
+
+	tests := []struct {
+		name     string
+		json     *JSON
+		expected string
+	}{
+		{"promoted", New(), `{"ID":1,"Created":"today","Foo":"foo","Bar":0,"Baz":null,"Secret":"s","Name":"n"}`},
+		{"nested", New(NestEmbedded()), `{"NestedBase":{"ID":1,"Created":"today"},"Keys":{"Foo":"foo","Bar":0,"Baz":null},"Name":"n"}`},
+		{"nested with key encoding", New(NestEmbedded(), KeyEncodeFn(strings.ToLower)), `{"nestedbase":{"id":1,"created":"today"},"keys":{"foo":"foo","bar":0,"baz":null},"name":"n"}`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.json.Marshal(v)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(b) != tt.expected {
+				t.Errorf("have: %s, want: %s", b, tt.expected)
+			}
+
+			var v2 T
+			if err := tt.json.Unmarshal(b, &v2); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			expected := v
+			if tt.name != "promoted" {
+				expected.nestedHidden = nestedHidden{}
+			}
+			if !reflect.DeepEqual(v2, expected) {
+				t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v2, expected)
+			}
+		})
+	}
+}
+
+func TestBigNumbers(t *testing.T) {
+	type T struct {
+		I  *big.Int
+		F  *big.Float
+		FV big.Float
+	}
+	const (
+		intLit   = "1234567890123456789012345678901234567890"
+		floatLit = "3.1415926535897932384626433832795028841971693993751"
+	)
+	data := []byte(`{"I":` + intLit + `,"F":` + floatLit + `,"FV":-0.000000000000000000000001}`)
+
+	var v T
+	if err := Unmarshal(data, &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if v.I.String() != intLit {
+		t.Errorf("have: %v, want: %v", v.I, intLit)
+	}
+	if s := v.F.Text('f', -1); s != floatLit {
+		t.Errorf("have: %v, want: %v", s, floatLit)
+	}
+
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != string(data) {
+		t.Errorf("have: %s, want: %s", b, data)
+	}
+
+	t.Run("string", func(t *testing.T) {
+		var f big.Float
+		if err := Unmarshal([]byte(`"2.5"`), &f); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if f.Text('f', -1) != "2.5" {
+			t.Errorf("have: %v, want: 2.5", f.Text('f', -1))
+		}
+	})
+
+	t.Run("null", func(t *testing.T) {
+		v := T{F: big.NewFloat(1)}
+		if err := Unmarshal([]byte(`{"F":null}`), &v); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if v.F != nil {
+			t.Errorf("have: %v, want: nil", v.F)
+		}
+		b, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if expected := `{"I":null,"F":null,"FV":0}`; string(b) != expected {
+			t.Errorf("have: %s, want: %s", b, expected)
+		}
+	})
+
+	t.Run("infinity", func(t *testing.T) {
+		_, err := Marshal(new(big.Float).SetInf(false))
+		if _, ok := err.(*json.UnsupportedValueError); !ok {
+			t.Errorf("have: %v, want UnsupportedValueError", err)
+		}
+	})
+}
+
+// testDecimal is a minimal decimal type for TestJSONDecimalMode.
+type testDecimal struct {
+	coef big.Int
+	exp  int
+}
+
+func (d *testDecimal) UnmarshalText(b []byte) error {
+	s := string(b)
+	d.exp = 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		d.exp = -(len(s) - i - 1)
+		s = s[:i] + s[i+1:]
+	}
+	if _, ok := d.coef.SetString(s, 10); !ok {
+		return fmt.Errorf("invalid decimal %q", b)
+	}
+	return nil
+}
+
+func TestJSONDecimalMode(t *testing.T) {
+	data := []byte(`{"a":0.1,"b":0.2,"sum":0.30000000000000004,"price":1.10,"big":12345678901234567890.123456789,"exp":1E+2,"list":[-0.0]}`)
+	var v map[string]interface{}
+	if err := DecimalMode().Unmarshal(data, &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	expected := map[string]interface{}{
+		"a":     json.Number("0.1"),
+		"b":     json.Number("0.2"),
+		"sum":   json.Number("0.30000000000000004"),
+		"price": json.Number("1.10"),
+		"big":   json.Number("12345678901234567890.123456789"),
+		"exp":   json.Number("1E+2"),
+		"list":  []interface{}{json.Number("-0.0")},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", v, expected)
+	}
+
+	var d testDecimal
+	if err := ToDecimal(v["price"].(json.Number), &d); err != nil {
+		t.Fatalf("ToDecimal: %v", err)
+	}
+	if d.coef.String() != "110" || d.exp != -2 {
+		t.Errorf("have: %ve%d, want: 110e-2", &d.coef, d.exp)
+	}
+
+	t.Run("exponent out of range", func(t *testing.T) {
+		for _, in := range []string{`1e9999999999`, `[1.5e-2147483648]`, `{"n":1e2147483648}`} {
+			var v interface{}
+			err := DecimalMode().Unmarshal([]byte(in), &v)
+			if _, ok := err.(*json.UnmarshalTypeError); !ok {
+				t.Errorf("%s: have: %v, want UnmarshalTypeError", in, err)
+			}
+			if err := UseNumber().Unmarshal([]byte(in), &v); err != nil {
+				t.Errorf("%s: UseNumber: %v", in, err)
+			}
+		}
+	})
+
+	t.Run("number field", func(t *testing.T) {
+		var v struct{ N json.Number }
+		err := DecimalMode().NewDecoder(strings.NewReader(`{"N":1e-9999999999}`)).Decode(&v)
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			t.Errorf("have: %v, want UnmarshalTypeError", err)
+		}
+	})
+}
+
+func TestJSONMaxDepth(t *testing.T) {
+	deep := strings.Repeat("[", 10000) + strings.Repeat("]", 10000)
+	var v interface{}
+	err := MaxDepth(100).Unmarshal([]byte(deep), &v)
+	le, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("have: %v, want LimitError", err)
+	}
+	if le.Limit != "depth" || le.Max != 100 || le.Offset != 101 {
+		t.Errorf("have: %+v, want depth limit of 100 at offset 101", le)
+	}
+
+	err = MaxDepth(100).NewDecoder(strings.NewReader(deep)).Decode(&v)
+	if _, ok := err.(*LimitError); !ok {
+		t.Errorf("Decoder: have: %v, want LimitError", err)
+	}
+
+	for _, in := range []string{`[[1],{"a":2}]`, `{"a":{"b":2}}`, `"x"`} {
+		if err := MaxDepth(2).Unmarshal([]byte(in), &v); err != nil {
+			t.Errorf("%s: %v", in, err)
+		}
+	}
+	if err := MaxDepth(2).Unmarshal([]byte(`{"a":[[]]}`), &v); err == nil {
+		t.Error("expected error for depth 3")
+	}
+	if err := Unmarshal([]byte(deep), &v); err != nil {
+		t.Errorf("no limit: %v", err)
+	}
+}
+
+func TestJSONMaxStringLen(t *testing.T) {
+	giant := `["` + strings.Repeat("x", 1<<20) + `"]`
+	var v interface{}
+	err := MaxStringLen(1024).Unmarshal([]byte(giant), &v)
+	le, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("have: %v, want LimitError", err)
+	}
+	if le.Limit != "string length" || le.Max != 1024 {
+		t.Errorf("have: %+v, want string length limit of 1024", le)
+	}
+	if off, ok := ErrorOffset(err); !ok || off != 1027 {
+		t.Errorf("offset: have %d, want 1027", off)
+	}
+
+	err = MaxStringLen(1024).NewDecoder(strings.NewReader(giant)).Decode(&v)
+	if _, ok := err.(*LimitError); !ok {
+		t.Errorf("Decoder: have: %v, want LimitError", err)
+	}
+
+	for _, in := range []string{`"abc"`, `{"abc":"d\"e"}`, `[""]`} {
+		if err := MaxStringLen(4).Unmarshal([]byte(in), &v); err != nil {
+			t.Errorf("%s: %v", in, err)
+		}
+	}
+	for _, in := range []string{`"abcde"`, `{"abcde":1}`} {
+		if _, ok := MaxStringLen(4).Unmarshal([]byte(in), &v).(*LimitError); !ok {
+			t.Errorf("%s: expected LimitError", in)
+		}
+	}
+}
+
+func TestJSONAllowTrailingCommas(t *testing.T) {
+	var a []int
+	if err := AllowTrailingCommas().Unmarshal([]byte(`[1,2,]`), &a); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(a, []int{1, 2}) {
+		t.Errorf("have: %v, want: [1 2]", a)
+	}
+
+	var m map[string]int
+	if err := AllowTrailingCommas().Unmarshal([]byte(`{"a":1,}`), &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(m, map[string]int{"a": 1}) {
+		t.Errorf("have: %v, want: map[a:1]", m)
+	}
+
+	const nested = `{"a": [1, {"b": true,} ,], "c": {"d": [],},
+	}`
+	expected := map[string]interface{}{
+		"a": []interface{}{1.0, map[string]interface{}{"b": true}},
+		"c": map[string]interface{}{"d": []interface{}{}},
+	}
+	var v interface{}
+	if err := AllowTrailingCommas().Unmarshal([]byte(nested), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("have: %v, want: %v", v, expected)
+	}
+	v = nil
+	if err := AllowTrailingCommas().NewDecoder(strings.NewReader(nested)).Decode(&v); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("Decoder: have: %v, want: %v", v, expected)
+	}
+
+	// Tokens and DecodeArray.
+	var tokens []json.Token
+	dec := AllowTrailingCommas().NewDecoder(strings.NewReader(`[1,{"a":2,},] [3,]`))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Token: %v", err)
+		}
+		tokens = append(tokens, tok)
+	}
+	expectedTokens := []json.Token{
+		json.Delim('['), 1.0, json.Delim('{'), "a", 2.0, json.Delim('}'), json.Delim(']'),
+		json.Delim('['), 3.0, json.Delim(']'),
+	}
+	if !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Errorf("have: %v, want: %v", tokens, expectedTokens)
+	}
+	var elems []int
+	dec = AllowTrailingCommas().NewDecoder(strings.NewReader(`[1, 2, ]`))
+	err := dec.DecodeArray(func(decode func(interface{}) error) error {
+		var n int
+		err := decode(&n)
+		elems = append(elems, n)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("DecodeArray: %v", err)
+	}
+	if !reflect.DeepEqual(elems, []int{1, 2}) {
+		t.Errorf("have: %v, want: [1 2]", elems)
+	}
+
+	for _, in := range []string{`[,]`, `{,}`, `[1,,]`, `{"a":1,,}`, `[1,]]`, `,`} {
+		var v interface{}
+		if err := AllowTrailingCommas().Unmarshal([]byte(in), &v); err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+	}
+	for _, in := range []string{`[1,2,]`, `{"a":1,}`} {
+		var v interface{}
+		if _, ok := Unmarshal([]byte(in), &v).(*SyntaxError); !ok {
+			t.Errorf("%s: without AllowTrailingCommas: expected SyntaxError", in)
+		}
+	}
+
+	// Discriminated objects are decoded by a separate scanner.
+	j := New().AllowTrailingCommas()
+	j.RegisterDiscriminator("type", map[string]reflect.Type{"cat": reflect.TypeOf(discriminatorCat{})})
+	var have []interface{}
+	if err := j.Unmarshal([]byte(`[{"name":"Tom","type":"cat",},]`), &have); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if expected := []interface{}{discriminatorCat{Type: "cat", Name: "Tom"}}; !reflect.DeepEqual(have, expected) {
+		t.Errorf("have: %#v, want: %#v", have, expected)
+	}
+}
+
+func TestJSONAllowComments(t *testing.T) {
+	const in = `// leading comment
+	{
+		/* before key */ "name": "a // not a comment", // after value
+		"list": [1, /* inside array */ 2 // before end
+		],
+		"n"/**/:/***/3/* no space */,
+		"empty": {/* nothing */}, "slash": "/* not a comment */"
+	} // after the final value
+	/* and a block
+	   comment */`
+	type T struct {
+		Name  string
+		List  []int
+		N     int
+		Empty map[string]int
+		Slash string
+	}
+	expected := T{Name: "a // not a comment", List: []int{1, 2}, N: 3, Empty: map[string]int{}, Slash: "/* not a comment */"}
+
+	var v T
+	if err := AllowComments().Unmarshal([]byte(in), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("have: %+v, want: %+v", v, expected)
+	}
+
+	var i interface{}
+	if err := AllowComments().Unmarshal([]byte(`[1,2]// end`), &i); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if err := AllowComments().Unmarshal([]byte(`1/*x*/`), &i); err != nil || i != 1.0 {
+		t.Fatalf("Unmarshal: have %v, %v", i, err)
+	}
+
+	// Decoder.
+	dec := AllowComments().NewDecoder(strings.NewReader(in + "\n" + in + "// the end"))
+	for n := 0; n < 2; n++ {
+		v = T{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("Decode: have: %+v, want: %+v", v, expected)
+		}
+	}
+	if err := dec.Decode(&v); err != io.EOF {
+		t.Errorf("have: %v, want EOF", err)
+	}
+
+	// Tokens.
+	var tokens []json.Token
+	dec = AllowComments().NewDecoder(strings.NewReader(`/* a */ [1, // b
+	{"k" /* c */ : 2}] // d`))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Token: %v", err)
+		}
+		tokens = append(tokens, tok)
+	}
+	expectedTokens := []json.Token{json.Delim('['), 1.0, json.Delim('{'), "k", 2.0, json.Delim('}'), json.Delim(']')}
+	if !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Errorf("have: %v, want: %v", tokens, expectedTokens)
+	}
+
+	for _, in := range []string{`1 /* unterminated`, `[1 // no end`, `/ 1`, `[1 /x]`, `1 /`, `"a" / "b"`} {
+		if err := AllowComments().Unmarshal([]byte(in), &i); err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+		dec := AllowComments().NewDecoder(strings.NewReader(in))
+		var err error
+		for err == nil {
+			err = dec.Decode(&i)
+		}
+		if err == io.EOF {
+			t.Errorf("Decoder: %s: expected error", in)
+		}
+	}
+	if _, ok := Unmarshal([]byte(`1 // comment`), &i).(*SyntaxError); !ok {
+		t.Errorf("without AllowComments: expected SyntaxError")
+	}
+
+	// Discriminated objects are decoded by a separate scanner.
+	j := New().AllowComments()
+	j.RegisterDiscriminator("type", map[string]reflect.Type{"cat": reflect.TypeOf(discriminatorCat{})})
+	for _, in := range []string{
+		`[{"type":"cat", /* c */ "name":"Tom"}]`,
+		`[{/* c */ "type" /* c */ : /* c */ "cat", "name":"Tom" // c
+		}]`,
+	} {
+		var have []interface{}
+		if err := j.Unmarshal([]byte(in), &have); err != nil {
+			t.Fatalf("%s: Unmarshal: %v", in, err)
+		}
+		if expected := []interface{}{discriminatorCat{Type: "cat", Name: "Tom"}}; !reflect.DeepEqual(have, expected) {
+			t.Errorf("%s: have: %#v, want: %#v", in, have, expected)
+		}
+	}
+}
+
+func TestJSONAllowSingleQuotes(t *testing.T) {
+	type T struct {
+		Name  string
+		Quote string
+		Mixed string
+		Tags  []string
+		Raw   json.RawMessage
+	}
+	const in = `{'Name': 'it\'s', "Quote": 'say "hi"', 'Mixed': "it\'s \"ok\"\u0021",
+		'Tags': ['a', "b", '', '\\'], "Raw": {'k': ['v']}}`
+	expected := T{
+		Name:  "it's",
+		Quote: `say "hi"`,
+		Mixed: `it's "ok"!`,
+		Tags:  []string{"a", "b", "", `\`},
+		Raw:   json.RawMessage(`{"k": ["v"]}`),
+	}
+
+	var v T
+	if err := AllowSingleQuotes().Unmarshal([]byte(in), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("have: %+v, want: %+v", v, expected)
+	}
+
+	var m map[string]interface{}
+	if err := AllowSingleQuotes().AllowComments().Unmarshal([]byte(`{'a': /* 'b' */ 'c' // it's
+	}`), &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(m, map[string]interface{}{"a": "c"}) {
+		t.Errorf("have: %v", m)
+	}
+
+	// Decoder and tokens.
+	v = T{}
+	dec := AllowSingleQuotes().NewDecoder(strings.NewReader(in + in))
+	for n := 0; n < 2; n++ {
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("Decode: have: %+v, want: %+v", v, expected)
+		}
+	}
+	var tokens []json.Token
+	dec = AllowSingleQuotes().NewDecoder(strings.NewReader(`{'a': ['b\'']}`))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Token: %v", err)
+		}
+		tokens = append(tokens, tok)
+	}
+	expectedTokens := []json.Token{json.Delim('{'), "a", json.Delim('['), "b'", json.Delim(']'), json.Delim('}')}
+	if !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Errorf("have: %v, want: %v", tokens, expectedTokens)
+	}
+
+	var i interface{}
+	for _, in := range []string{`'abc`, `'a"`, `"a'`, `'\x'`} {
+		if err := AllowSingleQuotes().Unmarshal([]byte(in), &i); err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+	}
+	for _, in := range []string{`'a'`, `"it\'s"`, `{'a':1}`} {
+		if _, ok := Unmarshal([]byte(in), &i).(*SyntaxError); !ok {
+			t.Errorf("%s: without AllowSingleQuotes: expected SyntaxError", in)
+		}
+	}
+}
+
+func TestJSONAllowUnquotedKeys(t *testing.T) {
+	type T struct {
+		Foo int `json:"foo"`
+		Bar int `json:"bar"`
+	}
+	var v T
+	if err := AllowUnquotedKeys().Unmarshal([]byte(`{foo: 1, bar: 2}`), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if expected := (T{Foo: 1, Bar: 2}); v != expected {
+		t.Errorf("have: %+v, want: %+v", v, expected)
+	}
+
+	var m map[string]interface{}
+	if err := AllowUnquotedKeys().Unmarshal([]byte(`{foo: 1, bar: 2}`), &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if expected := map[string]interface{}{"foo": 1.0, "bar": 2.0}; !reflect.DeepEqual(m, expected) {
+		t.Errorf("have: %v, want: %v", m, expected)
+	}
+
+	m = nil
+	const in = `{_a1: true, "b": {$c /* key */ : [1e5, null]}, true: "x:", d//
+	: 'e'}`
+	if err := AllowUnquotedKeys().AllowComments().AllowSingleQuotes().Unmarshal([]byte(in), &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	expected := map[string]interface{}{
+		"_a1":  true,
+		"b":    map[string]interface{}{"$c": []interface{}{1e5, nil}},
+		"true": "x:",
+		"d":    "e",
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("have: %v, want: %v", m, expected)
+	}
+
+	// Decoder and tokens.
+	dec := AllowUnquotedKeys().NewDecoder(strings.NewReader(`{foo: 1, bar: 2} {foo: 3}`))
+	for _, expected := range []T{{Foo: 1, Bar: 2}, {Foo: 3}} {
+		v = T{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if v != expected {
+			t.Errorf("Decode: have: %+v, want: %+v", v, expected)
+		}
+	}
+	var tokens []json.Token
+	dec = AllowUnquotedKeys().NewDecoder(strings.NewReader(`{foo: [1], "bar" :{baz:null}}`))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Token: %v", err)
+		}
+		tokens = append(tokens, tok)
+	}
+	expectedTokens := []json.Token{json.Delim('{'), "foo", json.Delim('['), 1.0, json.Delim(']'),
+		"bar", json.Delim('{'), "baz", nil, json.Delim('}'), json.Delim('}')}
+	if !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Errorf("have: %v, want: %v", tokens, expectedTokens)
+	}
+
+	var i interface{}
+	for _, in := range []string{`{1a: 1}`, `{a-b: 1}`, `{a: b}`, `[a]`, `a`, `{a}`} {
+		if err := AllowUnquotedKeys().Unmarshal([]byte(in), &i); err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+	}
+	if _, ok := Unmarshal([]byte(`{foo: 1}`), &i).(*SyntaxError); !ok {
+		t.Errorf("without AllowUnquotedKeys: expected SyntaxError")
+	}
+}
+
+func TestJSONAllowExtendedNumbers(t *testing.T) {
+	tests := []struct {
+		in     string
+		f      float64
+		number json.Number
+	}{
+		{in: `0x1F`, f: 31, number: "31"},
+		{in: `-0X1f`, f: -31, number: "-31"},
+		{in: `0xffffffffffffffffff`, f: 0xffffffffffffffffff, number: "4722366482869645213695"},
+		{in: `+5`, f: 5, number: "5"},
+		{in: `+0.5e1`, f: 5, number: "0.5e1"},
+		{in: `.5`, f: 0.5, number: "0.5"},
+		{in: `-.5`, f: -0.5, number: "-0.5"},
+		{in: `+.5E-1`, f: 0.05, number: "0.5E-1"},
+		{in: `5.`, f: 5, number: "5"},
+		{in: `-5.e2`, f: -500, number: "-5e2"},
+		{in: `10`, f: 10, number: "10"},
+	}
+	for _, tt := range tests {
+		var f float64
+		if err := AllowExtendedNumbers().Unmarshal([]byte(tt.in), &f); err != nil {
+			t.Errorf("%s: Unmarshal: %v", tt.in, err)
+		} else if f != tt.f {
+			t.Errorf("%s: have: %v, want: %v", tt.in, f, tt.f)
+		}
+		var n json.Number
+		if err := AllowExtendedNumbers().Unmarshal([]byte(tt.in), &n); err != nil {
+			t.Errorf("%s: Unmarshal: %v", tt.in, err)
+		} else if n != tt.number {
+			t.Errorf("%s: have: %q, want: %q", tt.in, n, tt.number)
+		}
+		if _, ok := Unmarshal([]byte(tt.in), &f).(*SyntaxError); !ok && tt.in != `10` {
+			t.Errorf("%s: without AllowExtendedNumbers: expected SyntaxError", tt.in)
+		}
+	}
+
+	type T struct {
+		Hex   int
+		Plus  uint8
+		Lead  float32
+		Trail int64
+		Num   json.Number
+		Any   interface{}
+	}
+	const in = `{"Hex": 0xff, "Plus": +7, "Lead": .25, "Trail": 3., "Num": -0x10, "Any": [.5, 0x0]}`
+	expected := T{Hex: 255, Plus: 7, Lead: 0.25, Trail: 3, Num: "-16", Any: []interface{}{0.5, 0.0}}
+	var v T
+	if err := AllowExtendedNumbers().Unmarshal([]byte(in), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("have: %+v, want: %+v", v, expected)
+	}
+
+	// Decoder and tokens.
+	v = T{}
+	dec := AllowExtendedNumbers().NewDecoder(strings.NewReader(in + in))
+	for n := 0; n < 2; n++ {
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("Decode: have: %+v, want: %+v", v, expected)
+		}
+	}
+	var tokens []json.Token
+	dec = AllowExtendedNumbers().NewDecoder(strings.NewReader(`[0x1F, +1, .5, 5.]`))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Token: %v", err)
+		}
+		tokens = append(tokens, tok)
+	}
+	expectedTokens := []json.Token{json.Delim('['), 31.0, 1.0, 0.5, 5.0, json.Delim(']')}
+	if !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Errorf("have: %v, want: %v", tokens, expectedTokens)
+	}
+
+	var i interface{}
+	for _, in := range []string{`.`, `+`, `-.`, `+-1`, `0x`, `0xg`, `1x1`, `0.x1`, `++1`, `.e1`, `0x1.5`, `01`} {
+		if err := AllowExtendedNumbers().Unmarshal([]byte(in), &i); err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+	}
+}
+
+func TestJSONMaxObjectKeys(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `"k%d":%d`, i, i)
+	}
+	sb.WriteByte('}')
+	flat := sb.String()
+
+	var v map[string]interface{}
+	err := MaxObjectKeys(100).Unmarshal([]byte(flat), &v)
+	le, ok := err.(*LimitError)
+	if !ok {
+		t.Fatalf("have: %v, want LimitError", err)
+	}
+	if le.Limit != "number of object keys" || le.Max != 100 {
+		t.Errorf("have: %+v, want object key limit of 100", le)
+	}
+	if v != nil {
+		t.Errorf("map was filled before the limit was detected: %d keys", len(v))
+	}
+
+	err = MaxObjectKeys(100).NewDecoder(strings.NewReader(flat)).Decode(&v)
+	if _, ok := err.(*LimitError); !ok {
+		t.Errorf("Decoder: have: %v, want LimitError", err)
+	}
+	if err := MaxObjectKeys(1000).Unmarshal([]byte(flat), &v); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+
+	t.Run("nested", func(t *testing.T) {
+		for _, in := range []string{
+			`{"a":{"x":1,"y":2},"b":{"x":1,"y":2}}`,
+			`{"a":1,"b":[{"x":1,"y":2},{"x":1,"y":2}]}`,
+			`[{"a":1,"b":2},{"c":3,"d":4}]`,
+			`{}`,
+		} {
+			var v interface{}
+			if err := MaxObjectKeys(2).Unmarshal([]byte(in), &v); err != nil {
+				t.Errorf("%s: %v", in, err)
+			}
+		}
+		for _, in := range []string{
+			`{"a":{"x":1,"y":2},"b":2,"c":3}`,
+			`{"a":{"x":1,"y":2,"z":3}}`,
+		} {
+			var v interface{}
+			if _, ok := MaxObjectKeys(2).Unmarshal([]byte(in), &v).(*LimitError); !ok {
+				t.Errorf("%s: expected LimitError", in)
+			}
+		}
+	})
+}
+
+func TestJSONMaxInterfaceDepth(t *testing.T) {
+	type T struct {
+		Any    interface{}            `json:"any"`
+		Nested map[string]interface{} `json:"nested"`
+		Deep   [][][]int              `json:"deep"`
+	}
+	j := MaxInterfaceDepth(2)
+	for _, in := range []string{
+		`{"any":[1,{"a":"b"}],"nested":{"a":[1,2],"b":{}}}`,
+		`{"any":{"a":[]},"deep":[[[1]]]}`,
+		`{"any":"x","nested":{"a":{"b":[]},"c":[{}]}}`,
+	} {
+		var v T
+		if err := j.Unmarshal([]byte(in), &v); err != nil {
+			t.Errorf("%s: %v", in, err)
+		}
+	}
+	for _, in := range []string{
+		`{"any":[[[1]]]}`,
+		`{"any":{"a":{"b":{}}}}`,
+		`{"nested":{"a":{"b":{"c":{}}}}}`,
+		`{"nested":{"a":[[{"b":1}]]}}`,
+	} {
+		var v T
+		err := j.Unmarshal([]byte(in), &v)
+		le, ok := err.(*LimitError)
+		if !ok {
+			t.Errorf("%s: have: %v, want LimitError", in, err)
+			continue
+		}
+		if le.Limit != "interface depth" || le.Max != 2 {
+			t.Errorf("%s: have: %+v, want interface depth limit of 2", in, le)
+		}
+	}
+
+	var v interface{}
+	err := j.NewDecoder(strings.NewReader(`[[[]]]`)).Decode(&v)
+	if _, ok := err.(*LimitError); !ok {
+		t.Errorf("Decoder: have: %v, want LimitError", err)
+	}
+	var om OrderedMap
+	if _, ok := j.Unmarshal([]byte(`{"a":{"b":{}}}`), &om).(*LimitError); !ok {
+		t.Errorf("OrderedMap: expected LimitError")
+	}
+}
+
+func TestJSONRegisteredTypesOnly(t *testing.T) {
+	j := New().RegisteredTypesOnly()
+	j.RegisterDiscriminator("type", map[string]reflect.Type{
+		"cat": reflect.TypeOf(discriminatorCat{}),
+	})
+
+	var v []interface{}
+	if err := j.Unmarshal([]byte(`[{"type":"cat","name":"Tom"},[1,"a",null],true]`), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	expected := []interface{}{
+		discriminatorCat{Type: "cat", Name: "Tom"},
+		[]interface{}{float64(1), "a", nil},
+		true,
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("have: %#v, want: %#v", v, expected)
+	}
+
+	for _, in := range []string{
+		`[{"type":"dog","name":"Rex"}]`,
+		`[{"name":"Nobody"}]`,
+		`[[{}]]`,
+		`{}`,
+	} {
+		var v interface{}
+		err := j.Unmarshal([]byte(in), &v)
+		if ute, ok := err.(*json.UnmarshalTypeError); !ok || ute.Value != "object" {
+			t.Errorf("%s: have: %v, want UnmarshalTypeError", in, err)
+		}
+	}
+
+	// Typed maps and structs are not affected.
+	var m map[string]map[string]int
+	if err := j.Unmarshal([]byte(`{"a":{"b":1}}`), &m); err != nil {
+		t.Errorf("Unmarshal: %v", err)
+	}
+}
+
+func TestUnmarshalNext(t *testing.T) {
+	type T struct {
+		A int    `json:"a"`
+		B string `json:"b"`
+	}
+	rest := []byte(`{"a":1,"b":"x"} {"a":2}` + "\n" + `{"b":"z","a":3}` + "\n")
+	var have []T
+	for {
+		var v T
+		var err error
+		rest, err = UnmarshalNext(rest, &v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("UnmarshalNext: %v", err)
+		}
+		have = append(have, v)
+	}
+	expected := []T{{A: 1, B: "x"}, {A: 2}, {A: 3, B: "z"}}
+	if !reflect.DeepEqual(have, expected) {
+		t.Errorf("have: %+v, want: %+v", have, expected)
+	}
+	if string(rest) != "\n" {
+		t.Errorf("have rest: %q, want: %q", rest, "\n")
+	}
+
+	// Literals, arrays and values without separating white space.
+	rest = []byte(`1 "a"[true]{}null`)
+	var values []interface{}
+	for {
+		var v interface{}
+		var err error
+		rest, err = UnmarshalNext(rest, &v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("UnmarshalNext: %v", err)
+		}
+		values = append(values, v)
+	}
+	if expected := []interface{}{float64(1), "a", []interface{}{true}, map[string]interface{}{}, nil}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("have: %#v, want: %#v", values, expected)
+	}
+
+	// A type error consumes the value.
+	var v T
+	rest, err := UnmarshalNext([]byte(`{"a":"x"} {"a":1}`), &v)
+	if _, ok := err.(*json.UnmarshalTypeError); !ok {
+		t.Errorf("have: %v, want UnmarshalTypeError", err)
+	}
+	if string(rest) != ` {"a":1}` {
+		t.Errorf("have rest: %q", rest)
+	}
+
+	// A syntax error doesn't.
+	data := []byte(`{"a":1,} {}`)
+	rest, err = UnmarshalNext(data, &v)
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Errorf("have: %v, want SyntaxError", err)
+	}
+	if !bytes.Equal(rest, data) {
+		t.Errorf("have rest: %q, want: %q", rest, data)
+	}
+	if _, err := UnmarshalNext([]byte(`{"a":1`), &v); err == nil || err == io.EOF {
+		t.Errorf("have: %v, want unexpected end of JSON input", err)
+	}
+	if _, err := AllowComments().UnmarshalNext([]byte(" /* done */ "), &v); err != io.EOF {
+		t.Errorf("have: %v, want io.EOF", err)
+	}
+}
+
+func TestUnmarshalRawMessageSlice(t *testing.T) {
+	data := []byte(`[ {"a" : [1, 2]} ,[ ],"x\"y", null,-1.5e3 ,true]`)
+	expected := []string{`{"a" : [1, 2]}`, `[ ]`, `"x\"y"`, `null`, `-1.5e3`, `true`}
+
+	// Pre-filled elements must be overwritten, not appended to.
+	raw := []json.RawMessage{json.RawMessage("old value")}
+	if err := Unmarshal(data, &raw); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(raw) != len(expected) {
+		t.Fatalf("have %d elements, want %d", len(raw), len(expected))
+	}
+	for i, r := range raw {
+		if string(r) != expected[i] {
+			t.Errorf("#%d: have: %s, want: %s", i, r, expected[i])
+		}
+	}
+
+	// The result must not alias the input.
+	data[4] = 'b'
+	if string(raw[0]) != expected[0] {
+		t.Errorf("RawMessage aliases the input: %s", raw[0])
+	}
+
+	t.Run("registered decoder", func(t *testing.T) {
+		j := New()
+		j.RegisterTypeDecoder(reflect.TypeOf(json.RawMessage(nil)), func(data []byte, v interface{}) error {
+			*v.(*json.RawMessage) = json.RawMessage("registered")
+			return nil
+		})
+		var raw []json.RawMessage
+		if err := j.Unmarshal([]byte(`[1,{}]`), &raw); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if len(raw) != 2 || string(raw[0]) != "registered" || string(raw[1]) != "registered" {
+			t.Errorf("have: %s, want registered decoder output", raw)
+		}
+	})
+}
+
+func TestJSONDecodeFieldHook(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+	}
+	type person struct {
+		Name    string   `json:"name"`
+		Tags    []string `json:"tags"`
+		Count   int      `json:"count,string"`
+		Address address  `json:"address"`
+		Notes   map[string]string
+	}
+	var seen []string
+	upper := func(field FieldInfo, raw []byte) ([]byte, error) {
+		seen = append(seen, field.Name+"="+string(raw))
+		if raw[0] != '"' {
+			return raw, nil
+		}
+		var s string
+		if err := Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return Marshal(strings.ToUpper(s))
+	}
+	data := `{"name":"José","tags":["a","b"],"count":"5","address":{"city":"paris"},"Notes":{"x":"y"},"unknown":"z"}`
+	var p person
+	if err := DecodeFieldHook(upper).Unmarshal([]byte(data), &p); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	expected := person{
+		Name:    "JOSÉ",
+		Tags:    []string{"a", "b"},
+		Count:   5,
+		Address: address{City: "PARIS"},
+		Notes:   map[string]string{"x": "y"},
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("have: %+v, want: %+v", p, expected)
+	}
+	expectedSeen := []string{
+		`name="José"`,
+		`tags=["a","b"]`,
+		`count="5"`,
+		`address={"city":"paris"}`,
+		`city="paris"`,
+		`Notes={"x":"y"}`,
+	}
+	if !reflect.DeepEqual(seen, expectedSeen) {
+		t.Errorf("hook calls:\nhave: %q\nwant: %q", seen, expectedSeen)
+	}
+
+	t.Run("error", func(t *testing.T) {
+		hookErr := errors.New("rejected")
+		var p person
+		err := DecodeFieldHook(func(field FieldInfo, raw []byte) ([]byte, error) {
+			if field.GoName == "Count" {
+				return nil, hookErr
+			}
+			return raw, nil
+		}).Unmarshal([]byte(data), &p)
+		if err != hookErr {
+			t.Errorf("have: %v, want: %v", err, hookErr)
+		}
+	})
+
+	t.Run("invalid replacement", func(t *testing.T) {
+		var p person
+		err := DecodeFieldHook(func(field FieldInfo, raw []byte) ([]byte, error) {
+			return []byte(`{`), nil
+		}).Unmarshal([]byte(data), &p)
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("have: %v, want SyntaxError", err)
+		}
+	})
+
+	t.Run("type error", func(t *testing.T) {
+		var p person
+		err := DecodeFieldHook(func(field FieldInfo, raw []byte) ([]byte, error) {
+			if field.Name == "city" {
+				return []byte(`42`), nil
+			}
+			return raw, nil
+		}).Unmarshal([]byte(data), &p)
+		ute, ok := err.(*json.UnmarshalTypeError)
+		if !ok {
+			t.Fatalf("have: %v, want UnmarshalTypeError", err)
+		}
+		if ute.Field != "address.city" {
+			t.Errorf("have field %q, want address.city", ute.Field)
+		}
+		if p.Name != "José" {
+			t.Errorf("decoding did not continue after the type error")
+		}
+	})
+}
+
+func TestJSONEncodeValueHook(t *testing.T) {
+	type user struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+		Age      int    `json:"age,omitempty"`
+	}
+	type account struct {
+		Owner    user                   `json:"owner"`
+		Users    []user                 `json:"users"`
+		Extra    map[string]interface{} `json:"extra"`
+		Password *string                `json:"password"`
+	}
+	pw := "hunter2"
+	v := account{
+		Owner: user{"root", "secret", 40},
+		Users: []user{{Name: "alice", Password: "a"}, {Name: "bob", Password: "b"}},
+		Extra: map[string]interface{}{
+			"password": 1234,
+			"nested":   map[string]string{"password": "x", "other": "y"},
+		},
+		Password: &pw,
+	}
+	var paths []string
+	redact := func(path string, v reflect.Value) (interface{}, bool) {
+		paths = append(paths, path)
+		if path == "password" || strings.HasSuffix(path, ".password") {
+			return "***", true
+		}
+		return nil, false
+	}
+	b, err := EncodeValueHook(redact).Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected := `{"owner":{"name":"root","password":"***","age":40},` +
+		`"users":[{"name":"alice","password":"***"},{"name":"bob","password":"***"}],` +
+		`"extra":{"nested":{"other":"y","password":"***"},"password":"***"},` +
+		`"password":"***"}`
+	if string(b) != expected {
+		t.Errorf("have: %s\nwant: %s", b, expected)
+	}
+	expectedPaths := []string{
+		"",
+		"owner", "owner.name", "owner.password", "owner.age",
+		"users", "users.0", "users.0.name", "users.0.password", "users.1", "users.1.name", "users.1.password",
+		"extra", "extra.nested", "extra.nested.other", "extra.nested.password", "extra.password",
+		"password",
+	}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("paths:\nhave: %q\nwant: %q", paths, expectedPaths)
+	}
+
+	t.Run("replacement is not hooked", func(t *testing.T) {
+		b, err := EncodeValueHook(func(path string, v reflect.Value) (interface{}, bool) {
+			if path == "owner" {
+				return user{Name: "x", Password: "visible"}, true
+			}
+			return nil, false
+		}).Marshal(struct {
+			Owner user `json:"owner"`
+		}{})
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		if string(b) != `{"owner":{"name":"x","password":"visible"}}` {
+			t.Errorf("have: %s", b)
+		}
+	})
+
+	t.Run("encoder", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := EncodeValueHook(redact).NewEncoder(&buf).Encode(v.Owner); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		if buf.String() != `{"name":"root","password":"***","age":40}`+"\n" {
+			t.Errorf("have: %s", buf.String())
+		}
+	})
+}
+
+func TestJSONRedact(t *testing.T) {
+	type person struct {
+		Name  string            `json:"name"`
+		SSN   string            `json:"ssn,redact"`
+		PIN   int               `json:",redact,string"`
+		Token *string           `json:"token,redact,omitempty"`
+		Keys  map[string]string `json:"keys,redact"`
+	}
+	p := person{Name: "John", SSN: "123-45-6789", PIN: 1234, Keys: map[string]string{"a": "b"}}
+
+	b, err := Marshal(p)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected := `{"name":"John","ssn":"[REDACTED]","PIN":"[REDACTED]","keys":"[REDACTED]"}`
+	if string(b) != expected {
+		t.Errorf("redacted:\nhave: %s\nwant: %s", b, expected)
+	}
+
+	b, err = ShowRedacted(true).Marshal(p)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected = `{"name":"John","ssn":"123-45-6789","PIN":"1234","keys":{"a":"b"}}`
+	if string(b) != expected {
+		t.Errorf("shown:\nhave: %s\nwant: %s", b, expected)
+	}
+
+	// Decoding ignores the redact option.
+	var p2 person
+	if err := Unmarshal(b, &p2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(p, p2) {
+		t.Errorf("have: %+v, want: %+v", p2, p)
+	}
+
+	fields, err := Fields(reflect.TypeOf(p))
+	if err != nil {
+		t.Fatalf("Fields: %v", err)
+	}
+	for _, f := range fields {
+		if f.Redacted != (f.GoName != "Name") {
+			t.Errorf("%s: have Redacted %v", f.GoName, f.Redacted)
+		}
+	}
+}
+
+func TestJSONRequired(t *testing.T) {
+	type Inner struct {
+		ID int `json:"id,required"`
+	}
+	type T struct {
+		Name  string  `json:"name,required"`
+		Email string  `json:"email,omitempty,required"`
+		Age   int     `json:"age"`
+		Inner *Inner  `json:"inner"`
+		List  []Inner `json:"list"`
+	}
+	tests := []struct {
+		in      string
+		missing string
+	}{
+		{in: `{"name":"a","email":"b"}`},
+		{in: `{"email":"b","name":null,"age":1}`},
+		{in: `{"Name":"a","EMAIL":"b","inner":{"id":1}}`},
+		{in: `{"email":"b","age":1}`, missing: "name"},
+		{in: `{"name":"a"}`, missing: "email"},
+		{in: `{}`, missing: "name"},
+		{in: `{"name":"a","email":"b","inner":{}}`, missing: "id"},
+		{in: `{"name":"a","email":"b","list":[{"id":1},{"ID":2},{"x":3}]}`, missing: "id"},
+	}
+	for _, tt := range tests {
+		var v T
+		err := Unmarshal([]byte(tt.in), &v)
+		if tt.missing == "" {
+			if err != nil {
+				t.Errorf("%s: Unmarshal: %v", tt.in, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("missing required field %q", tt.missing)) {
+			t.Errorf("%s: have: %v, want missing field %q", tt.in, err, tt.missing)
+		}
+	}
+
+	// The other fields are still decoded.
+	var v T
+	err := Unmarshal([]byte(`{"email":"b","age":3}`), &v)
+	if expected := `json: missing required field "name" in jsonx.T`; err == nil || err.Error() != expected {
+		t.Errorf("have: %v, want: %s", err, expected)
+	}
+	if v.Email != "b" || v.Age != 3 {
+		t.Errorf("have: %+v", v)
+	}
+
+	// A null struct is not checked, and encoding ignores the option.
+	b, err := Marshal(T{})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"name":"","age":0,"inner":null,"list":null}`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+	if err := Unmarshal([]byte(`{"name":"a","email":"b","inner":null}`), &v); err != nil {
+		t.Errorf("Unmarshal: %v", err)
+	}
+
+	fields, err := Fields(reflect.TypeOf(v))
+	if err != nil {
+		t.Fatalf("Fields: %v", err)
+	}
+	for _, f := range fields {
+		if f.Required != (f.GoName == "Name" || f.GoName == "Email") {
+			t.Errorf("%s: have Required %v", f.GoName, f.Required)
+		}
+	}
+}
+
+func TestJSONDefault(t *testing.T) {
+	type Inner struct {
+		Level int `json:"level,default=3"`
+	}
+	type T struct {
+		Name    string        `json:"name,default=anonymous"`
+		Port    int           `json:"port,default=8080"`
+		Ratio   *float64      `json:"ratio,default=0.5"`
+		Enabled bool          `json:"enabled,default=true"`
+		Start   time.Time     `json:"start,default=2020-01-02T03:04:05Z"`
+		Timeout time.Duration `json:"timeout,default=1000"`
+		Inner   Inner         `json:"inner"`
+		Other   int           `json:"other"`
+	}
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	ratio := func(f float64) *float64 { return &f }
+	tests := []struct {
+		in   string
+		want T
+	}{
+		{
+			in:   `{}`,
+			want: T{Name: "anonymous", Port: 8080, Ratio: ratio(0.5), Enabled: true, Start: start, Timeout: 1000},
+		},
+		{
+			in:   `{"name":"x","port":1,"ratio":null,"enabled":false,"timeout":5,"inner":{},"other":2}`,
+			want: T{Name: "x", Port: 1, Start: start, Timeout: 5, Inner: Inner{Level: 3}, Other: 2},
+		},
+		{
+			in:   `{"NAME":"","inner":{"level":0}}`,
+			want: T{Port: 8080, Ratio: ratio(0.5), Enabled: true, Start: start, Timeout: 1000},
+		},
+	}
+	for _, tt := range tests {
+		var v T
+		if err := Unmarshal([]byte(tt.in), &v); err != nil {
+			t.Errorf("%s: Unmarshal: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.want) {
+			t.Errorf("%s:\nhave: %+v\nwant: %+v", tt.in, v, tt.want)
+		}
+	}
+
+	// A default that is not a JSON literal is an error.
+	var bad struct {
+		A int `json:"a,default=x"`
+	}
+	err := Unmarshal([]byte(`{}`), &bad)
+	if derr, ok := err.(*InvalidDefaultTagError); !ok || derr.Field != "A" || derr.Default != "x" {
+		t.Errorf("have: %v, want: InvalidDefaultTagError", err)
+	} else if expected := `json: invalid ,default value "x" in struct tag on field`; !strings.HasPrefix(err.Error(), expected) {
+		t.Errorf("have: %v, want: %s", err, expected)
+	}
+	// It is a decoding option, so encoding is not affected.
+	if b, err := Marshal(bad); err != nil || string(b) != `{"a":0}` {
+		t.Errorf("Marshal: have: %s, %v", b, err)
+	}
+	var mismatch struct {
+		A []int `json:"a,default=1"`
+	}
+	err = Unmarshal([]byte(`{}`), &mismatch)
+	if ute, ok := err.(*json.UnmarshalTypeError); !ok || ute.Field != "a" {
+		t.Errorf("have: %v, want: UnmarshalTypeError for field a", err)
+	}
+}
+
+func TestJSONCaseSensitive(t *testing.T) {
+	type T struct {
+		Foo int
+		Bar int `json:"bar"`
+	}
+	lower := New(KeyEncodeFn(func(s string) string {
+		return strings.ToLower(s)
+	}))
+	tests := []struct {
+		json     *JSON
+		in       string
+		expected T
+	}{
+		{CaseSensitive(), `{"Foo":1,"bar":2}`, T{1, 2}},
+		{CaseSensitive(), `{"foo":1,"Bar":2}`, T{}},
+		{lower.CaseSensitive(), `{"foo":1,"bar":2}`, T{1, 2}},
+		{lower.CaseSensitive(), `{"Foo":1,"BAR":2}`, T{}},
+		{lower, `{"Foo":1,"BAR":2}`, T{1, 2}},
+	}
+	for i, tt := range tests {
+		var v T
+		if err := tt.json.Unmarshal([]byte(tt.in), &v); err != nil {
+			t.Errorf("#%d: Unmarshal: %v", i, err)
+			continue
+		}
+		if v != tt.expected {
+			t.Errorf("#%d: %s: have: %+v, want: %+v", i, tt.in, v, tt.expected)
+		}
+	}
+
+	var v T
+	err := CaseSensitive().DisallowUnknownFields().NewDecoder(strings.NewReader(`{"foo":1}`)).Decode(&v)
+	if err == nil || err.Error() != `json: unknown field "foo"` {
+		t.Errorf("have: %v, want unknown field error", err)
+	}
+}
+
+func TestJSONScalarOrArray(t *testing.T) {
+	type item struct{ A int }
+	type T struct {
+		Items []item
+		Tags  []string
+		Data  []byte
+		Ptrs  *[]*int
+		Raw   json.RawMessage
+	}
+	one := 1
+	tests := []struct {
+		in       string
+		expected T
+	}{
+		{`{"Items":{"a":1}}`, T{Items: []item{{1}}}},
+		{`{"Items":[{"a":1}]}`, T{Items: []item{{1}}}},
+		{`{"Tags":"x"}`, T{Tags: []string{"x"}}},
+		{`{"Tags":["x","y"]}`, T{Tags: []string{"x", "y"}}},
+		{`{"Tags":null}`, T{}},
+		{`{"Data":"AQI="}`, T{Data: []byte{1, 2}}},
+		{`{"Ptrs":1}`, T{Ptrs: &[]*int{&one}}},
+		{`{"Raw":{"a":1}}`, T{Raw: json.RawMessage(`{"a":1}`)}},
+	}
+	for _, tt := range tests {
+		var v T
+		if err := ScalarOrArray().Unmarshal([]byte(tt.in), &v); err != nil {
+			t.Errorf("%s: Unmarshal: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.expected) {
+			t.Errorf("%s:\nhave: %+v\nwant: %+v", tt.in, v, tt.expected)
+		}
+	}
+
+	// The slice is truncated to the single element.
+	v := T{Tags: []string{"a", "b", "c"}}
+	if err := ScalarOrArray().NewDecoder(strings.NewReader(`{"Tags":"x"}`)).Decode(&v); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(v.Tags, []string{"x"}) {
+		t.Errorf("have: %q, want: [x]", v.Tags)
+	}
+
+	var v2 T
+	err := Unmarshal([]byte(`{"Items":{"a":1}}`), &v2)
+	if _, ok := err.(*json.UnmarshalTypeError); !ok {
+		t.Errorf("without ScalarOrArray: have: %v, want UnmarshalTypeError", err)
+	}
+}
+
+func TestJSONCoerceScalars(t *testing.T) {
+	type T struct {
+		N int     `json:"n"`
+		U uint8   `json:"u"`
+		F float64 `json:"f"`
+		B bool    `json:"b"`
+		S string  `json:"s"`
+		P *int    `json:"p"`
+	}
+	var v T
+	in := `{"n":"42","u":"7","f":"-1.5e2","b":"true","s":12.5,"p":"3"}`
+	if err := CoerceScalars().Unmarshal([]byte(in), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	three := 3
+	expected := T{N: 42, U: 7, F: -150, B: true, S: "12.5", P: &three}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("have: %+v, want: %+v", v, expected)
+	}
+
+	// Values of the right type are unaffected.
+	v = T{}
+	if err := CoerceScalars().Unmarshal([]byte(`{"n":1,"b":false,"s":"x"}`), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if v.N != 1 || v.B || v.S != "x" {
+		t.Errorf("have: %+v", v)
+	}
+
+	for _, in := range []string{
+		`{"n":"abc"}`,
+		`{"n":" 42"}`,
+		`{"n":"1.5"}`,
+		`{"u":"300"}`,
+		`{"b":"yes"}`,
+		`{"b":"1"}`,
+		`{"s":true}`,
+	} {
+		var v T
+		err := CoerceScalars().NewDecoder(strings.NewReader(in)).Decode(&v)
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			t.Errorf("%s: have: %v, want UnmarshalTypeError", in, err)
+		}
+	}
+
+	if _, ok := Unmarshal([]byte(`{"n":"42"}`), &v).(*json.UnmarshalTypeError); !ok {
+		t.Errorf("without CoerceScalars: expected UnmarshalTypeError")
+	}
+}
+
+func TestJSONAutoUnquoteNumbers(t *testing.T) {
+	type T struct {
+		N int     `json:"n"`
+		U uint16  `json:"u"`
+		F float64 `json:"f"`
+		P *int    `json:"p"`
+		B bool    `json:"b"`
+		S string  `json:"s"`
+	}
+	var v T
+	in := `{"n":"-42","u":7,"f":"1.5e2","p":"3","b":true,"s":"12"}`
+	if err := AutoUnquoteNumbers().Unmarshal([]byte(in), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	three := 3
+	expected := T{N: -42, U: 7, F: 150, P: &three, B: true, S: "12"}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("have: %+v, want: %+v", v, expected)
+	}
+
+	for _, in := range []string{
+		`{"n":"abc"}`,
+		`{"n":"1.5"}`,
+		`{"n":""}`,
+		`{"f":"1e"}`,
+		`{"u":"-1"}`,
+		// Other scalars are not coerced.
+		`{"b":"true"}`,
+		`{"s":12}`,
+	} {
+		var v T
+		err := AutoUnquoteNumbers().Unmarshal([]byte(in), &v)
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			t.Errorf("%s: have: %v, want UnmarshalTypeError", in, err)
+		}
+	}
+}
+
+func TestJSONClone(t *testing.T) {
+	type T struct{ FooBar int }
+	j := New(KeyEncodeFn(strings.ToLower)).OmitEmpty()
+	if _, err := j.Marshal(T{1}); err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	c := j.Clone()
+	if c.fieldCache == j.fieldCache || c.encoderCache == j.encoderCache || c.types == j.types {
+		t.Fatal("clone shares caches with the original")
+	}
+	if _, ok := c.fieldCache.Load(reflect.TypeOf(T{})); ok {
+		t.Error("clone's cache is not empty")
+	}
+
+	// Options are kept.
+	b, err := c.Marshal(T{})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != `{}` {
+		t.Errorf("have: %s, want: {}", b)
+	}
+	if b, _ = c.Marshal(T{1}); string(b) != `{"foobar":1}` {
+		t.Errorf("have: %s, want: %s", b, `{"foobar":1}`)
+	}
+
+	// Registrations are independent.
+	c.RegisterTypeEncoder(reflect.TypeOf(T{}), func(v interface{}) ([]byte, error) {
+		return []byte(`"T"`), nil
+	})
+	if b, _ = c.Marshal(T{1}); string(b) != `"T"` {
+		t.Errorf("clone: have: %s, want: %s", b, `"T"`)
+	}
+	if b, _ = j.Marshal(T{1}); string(b) != `{"foobar":1}` {
+		t.Errorf("original: have: %s, want: %s", b, `{"foobar":1}`)
+	}
+}
+
+func TestJSONWithKeyEncodeFn(t *testing.T) {
+	type T struct{ FooBar int }
+	j := New(KeyEncodeFn(strings.ToLower))
+	if b, _ := j.Marshal(T{1}); string(b) != `{"foobar":1}` {
+		t.Fatalf("have: %s", b)
+	}
+
+	upper := j.WithKeyEncodeFn(strings.ToUpper)
+	if b, _ := upper.Marshal(T{1}); string(b) != `{"FOOBAR":1}` {
+		t.Errorf("new function: have: %s, want: %s", b, `{"FOOBAR":1}`)
+	}
+	var v T
+	if err := upper.CaseSensitive().Unmarshal([]byte(`{"FOOBAR":2}`), &v); err != nil || v.FooBar != 2 {
+		t.Errorf("new function: decoded %+v, %v", v, err)
+	}
+
+	if b, _ := j.Marshal(T{1}); string(b) != `{"foobar":1}` {
+		t.Errorf("original: have: %s, want: %s", b, `{"foobar":1}`)
+	}
+	if b, _ := WithKeyEncodeFn(strings.ToUpper).Marshal(T{1}); string(b) != `{"FOOBAR":1}` {
+		t.Errorf("default: have: %s, want: %s", b, `{"FOOBAR":1}`)
+	}
+	if b, _ := Marshal(T{1}); string(b) != `{"FooBar":1}` {
+		t.Errorf("default original: have: %s, want: %s", b, `{"FooBar":1}`)
+	}
+}
+
+type ctxKeyInner struct {
+	City string
+}
+
+type ctxKeyOuter struct {
+	Name  string
+	Short string `abbr:"s"`
+	Named string `json:"explicit"`
+	ctxKeyInner
+}
+
+func TestKeyEncodeFnContext(t *testing.T) {
+	j := New(KeyEncodeFnContext(func(name string, parentType reflect.Type, tag reflect.StructTag) string {
+		if abbr, ok := tag.Lookup("abbr"); ok {
+			name = abbr
+		}
+		return parentType.Name() + "." + name
+	}), KeyEncodeFn(strings.ToUpper))
+
+	v := ctxKeyOuter{Name: "a", Short: "b", Named: "c", ctxKeyInner: ctxKeyInner{City: "d"}}
+	b, err := j.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected := `{"ctxKeyOuter.Name":"a","ctxKeyOuter.s":"b","explicit":"c","ctxKeyInner.City":"d"}`
+	if string(b) != expected {
+		t.Errorf("have: %s\nwant: %s", b, expected)
+	}
+
+	var v2 ctxKeyOuter
+	if err := j.Unmarshal(b, &v2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if v2 != v {
+		t.Errorf("have: %+v, want: %+v", v2, v)
+	}
+
+	// WithKeyEncodeFn replaces the context function.
+	if b, _ = j.WithKeyEncodeFn(strings.ToLower).Marshal(ctxKeyInner{"x"}); string(b) != `{"city":"x"}` {
+		t.Errorf("WithKeyEncodeFn: have: %s", b)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// KeyNamers for the built-in naming conventions. An object key matches
+// a field name if both are the same after converting them to snake_case,
+// so for example "user_id", "userId" and "USER-ID" all match UserID.
+var (
+	CamelCaseKeys  KeyNamer = caseNamer(CamelCase)
+	PascalCaseKeys KeyNamer = caseNamer(PascalCase)
+	SnakeCaseKeys  KeyNamer = caseNamer(SnakeCase)
+	KebabCaseKeys  KeyNamer = caseNamer(KebabCase)
+)
+
+// caseNamer is a KeyNamer for a naming convention.
+type caseNamer func(string) string
+
+func (n caseNamer) Encode(fieldName string) string {
+	return n(fieldName)
+}
+
+func (n caseNamer) Match(jsonKey, fieldName string) bool {
+	return SnakeCase(jsonKey) == SnakeCase(fieldName)
+}
+
+// CamelCase converts a Go field name to camelCase, e.g. "UserID" to "userID".
+// A leading acronym is lowercased entirely, so "URLPath" becomes "urlPath".
+// It can be used as a key encoding function.
+func CamelCase(s string) string {
+	words := splitWords(s)
+	for i, w := range words {
+		if i == 0 {
+			words[i] = strings.ToLower(w)
+		} else {
+			words[i] = upperFirst(w)
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// PascalCase converts a name to PascalCase, e.g. "user_id" to "UserId"
+// and "userID" to "UserID".
+// It can be used as a key encoding function.
+func PascalCase(s string) string {
+	words := splitWords(s)
+	for i, w := range words {
+		words[i] = upperFirst(w)
+	}
+	return strings.Join(words, "")
+}
+
+// SnakeCase converts a Go field name to snake_case, e.g. "UserID" to "user_id".
+// It can be used as a key encoding function.
+func SnakeCase(s string) string {
+	return joinLower(splitWords(s), "_")
+}
+
+// KebabCase converts a Go field name to kebab-case, e.g. "UserID" to "user-id".
+// It can be used as a key encoding function.
+func KebabCase(s string) string {
+	return joinLower(splitWords(s), "-")
+}
+
+func joinLower(words []string, sep string) string {
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+	return strings.Join(words, sep)
+}
+
+func upperFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+// splitWords splits a name into words. Words are separated by underscores,
+// hyphens and spaces, and by changes in case: a word starts at an upper case
+// letter that follows a lower case letter or a digit, and at the last letter of
+// a run of upper case letters if it is followed by a lower case letter,
+// so that "HTTPServer" is split into "HTTP" and "Server".
+// A lower case s following an acronym, as in "IDs", is kept as a plural suffix.
+// Digits belong to the preceding word.
+func splitWords(s string) []string {
+	var words []string
+	rs := []rune(s)
+	start := 0
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		if r == '_' || r == '-' || r == ' ' {
+			if i > start {
+				words = append(words, string(rs[start:i]))
+			}
+			start = i + 1
+			continue
+		}
+		if i == start || !unicode.IsUpper(r) {
+			continue
+		}
+		prev := rs[i-1]
+		if unicode.IsLower(prev) || unicode.IsDigit(prev) {
+			words = append(words, string(rs[start:i]))
+			start = i
+		} else if unicode.IsUpper(prev) && i+1 < len(rs) && unicode.IsLower(rs[i+1]) && !isPluralSuffix(rs, i+1) {
+			words = append(words, string(rs[start:i]))
+			start = i
+		}
+	}
+	if start < len(rs) {
+		words = append(words, string(rs[start:]))
+	}
+	return words
+}
+
+// isPluralSuffix reports whether rs[i] is an s ending a word.
+func isPluralSuffix(rs []rune, i int) bool {
+	return rs[i] == 's' && (i+1 == len(rs) || !unicode.IsLower(rs[i+1]))
+}
@@ -0,0 +1,122 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"testing"
+)
+
+func TestKeyCase(t *testing.T) {
+	tests := []struct {
+		in, camel, pascal, snake, kebab string
+	}{
+		{"UserID", "userID", "UserID", "user_id", "user-id"},
+		{"FirstName", "firstName", "FirstName", "first_name", "first-name"},
+		{"ID", "id", "ID", "id", "id"},
+		{"URLPath", "urlPath", "URLPath", "url_path", "url-path"},
+		{"HTTPServerURL", "httpServerURL", "HTTPServerURL", "http_server_url", "http-server-url"},
+		{"UserIDs", "userIDs", "UserIDs", "user_ids", "user-ids"},
+		{"IDsByName", "idsByName", "IDsByName", "ids_by_name", "ids-by-name"},
+		{"Address2Line", "address2Line", "Address2Line", "address2_line", "address2-line"},
+		{"Name", "name", "Name", "name", "name"},
+		{"user_id", "userId", "UserId", "user_id", "user-id"},
+		{"already-kebab-case", "alreadyKebabCase", "AlreadyKebabCase", "already_kebab_case", "already-kebab-case"},
+		{"camelCase", "camelCase", "CamelCase", "camel_case", "camel-case"},
+		{"ÉtéÀParis", "étéÀParis", "ÉtéÀParis", "été_à_paris", "été-à-paris"},
+		{"", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		if have := CamelCase(tt.in); have != tt.camel {
+			t.Errorf("CamelCase(%q) = %q, want %q", tt.in, have, tt.camel)
+		}
+		if have := PascalCase(tt.in); have != tt.pascal {
+			t.Errorf("PascalCase(%q) = %q, want %q", tt.in, have, tt.pascal)
+		}
+		if have := SnakeCase(tt.in); have != tt.snake {
+			t.Errorf("SnakeCase(%q) = %q, want %q", tt.in, have, tt.snake)
+		}
+		if have := KebabCase(tt.in); have != tt.kebab {
+			t.Errorf("KebabCase(%q) = %q, want %q", tt.in, have, tt.kebab)
+		}
+	}
+}
+
+func TestKeyCaseEncodeFn(t *testing.T) {
+	type T struct {
+		UserID    int
+		FirstName string
+	}
+	b, err := New(KeyEncodeFn(SnakeCase)).Marshal(T{1, "John"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != `{"user_id":1,"first_name":"John"}` {
+		t.Errorf("have: %s", b)
+	}
+}
+
+func TestKeyNamer(t *testing.T) {
+	type T struct {
+		UserID    int
+		FirstName string
+		URLPath   string
+		Nick      string `json:"nickname"`
+	}
+	j := New(KeyNaming(SnakeCaseKeys))
+	v := T{1, "John", "/a", "jd"}
+	b, err := j.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != `{"user_id":1,"first_name":"John","url_path":"/a","nickname":"jd"}` {
+		t.Errorf("have: %s", b)
+	}
+	var v2 T
+	if err := j.Unmarshal(b, &v2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if v2 != v {
+		t.Errorf("have: %+v, want: %+v", v2, v)
+	}
+
+	// Other spellings of the same words match too.
+	v2 = T{}
+	if err := j.Unmarshal([]byte(`{"userId":2,"FIRST-NAME":"Jane","urlPath":"/b","NickName":"x"}`), &v2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if expected := (T{2, "Jane", "/b", "x"}); v2 != expected {
+		t.Errorf("have: %+v, want: %+v", v2, expected)
+	}
+
+	// Unrelated keys don't.
+	v2 = T{}
+	if err := j.DisallowUnknownFields().Unmarshal([]byte(`{"userid_x":3}`), &v2); err == nil {
+		t.Errorf("expected unknown field error, have: %+v", v2)
+	}
+
+	b, err = New(KeyNaming(CamelCaseKeys)).Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != `{"userID":1,"firstName":"John","urlPath":"/a","nickname":"jd"}` {
+		t.Errorf("have: %s", b)
+	}
+
+	// Other KeyNamers are asked to match each field.
+	v2 = T{}
+	if err := New(KeyNaming(prefixNamer{})).Unmarshal([]byte(`{"x_UserID":4,"nickname":"y"}`), &v2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if expected := (T{UserID: 4, Nick: "y"}); v2 != expected {
+		t.Errorf("have: %+v, want: %+v", v2, expected)
+	}
+}
+
+// prefixNamer is a KeyNamer that prefixes field names with "x_".
+type prefixNamer struct{}
+
+func (prefixNamer) Encode(fieldName string) string { return "x_" + fieldName }
+
+func (prefixNamer) Match(jsonKey, fieldName string) bool { return jsonKey == "x_"+fieldName }
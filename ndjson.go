@@ -0,0 +1,102 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"bufio"
+	"io"
+)
+
+// A LineDelimitedEncoder writes newline-delimited JSON (NDJSON) to an output stream.
+// Each value is written on a single line, followed by a newline character.
+type LineDelimitedEncoder struct {
+	enc *Encoder
+}
+
+// NewLineDelimitedEncoder returns a new newline-delimited JSON encoder
+// that writes to w using the default JSON encoder/decoder.
+func NewLineDelimitedEncoder(w io.Writer) *LineDelimitedEncoder {
+	return defaultJSON.NewLineDelimitedEncoder(w)
+}
+
+// NewLineDelimitedEncoder returns a new newline-delimited JSON encoder that writes to w.
+// Indentation configured on c is ignored, so that each value fits on one line.
+func (c *JSON) NewLineDelimitedEncoder(w io.Writer) *LineDelimitedEncoder {
+	enc := c.Indent("", "").NewEncoder(w)
+	enc.FlushEvery(1)
+	return &LineDelimitedEncoder{enc: enc}
+}
+
+// Encode writes the JSON encoding of v to the stream,
+// followed by a newline character.
+// The underlying writer is flushed after each value, see Encoder.Flush.
+//
+// Newlines inside strings are always escaped, so the encoding
+// of v never spans multiple lines.
+func (enc *LineDelimitedEncoder) Encode(v interface{}) error {
+	return enc.enc.Encode(v)
+}
+
+// SetEscapeHTML specifies whether problematic HTML characters
+// should be escaped inside JSON quoted strings.
+// See Encoder.SetEscapeHTML.
+func (enc *LineDelimitedEncoder) SetEscapeHTML(on bool) {
+	enc.enc.SetEscapeHTML(on)
+}
+
+// A LineDelimitedDecoder reads newline-delimited JSON (NDJSON) from an input stream.
+// Each line must contain exactly one JSON value. Blank lines are skipped.
+type LineDelimitedDecoder struct {
+	r         *bufio.Reader
+	converter *JSON
+	line      int
+}
+
+// NewLineDelimitedDecoder returns a new newline-delimited JSON decoder
+// that reads from r using the default JSON encoder/decoder.
+func NewLineDelimitedDecoder(r io.Reader) *LineDelimitedDecoder {
+	return defaultJSON.NewLineDelimitedDecoder(r)
+}
+
+// NewLineDelimitedDecoder returns a new newline-delimited JSON decoder that reads from r.
+//
+// The decoder introduces its own buffering and may
+// read data from r beyond the JSON values requested.
+func (c *JSON) NewLineDelimitedDecoder(r io.Reader) *LineDelimitedDecoder {
+	return &LineDelimitedDecoder{
+		r:         bufio.NewReader(r),
+		converter: c,
+	}
+}
+
+// Decode reads the next line from its input and stores the JSON value
+// it contains in the value pointed to by v.
+// It returns io.EOF when there are no more values.
+//
+// See the documentation for Unmarshal for details about
+// the conversion of JSON into a Go value.
+func (dec *LineDelimitedDecoder) Decode(v interface{}) error {
+	for {
+		line, err := dec.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) > 0 {
+			dec.line++
+		}
+		if nonSpace(line) {
+			return dec.converter.Unmarshal(line, v)
+		}
+		if err == io.EOF {
+			return err
+		}
+	}
+}
+
+// Line returns the number of the line containing the most recently decoded value.
+// Lines are numbered starting at 1.
+func (dec *LineDelimitedDecoder) Line() int {
+	return dec.line
+}
@@ -0,0 +1,119 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLineDelimitedRoundTrip(t *testing.T) {
+	values := []interface{}{
+		1.5,
+		"multi\nline string",
+		nil,
+		true,
+		[]interface{}{"a", 2.0, map[string]interface{}{"b": "c"}},
+		map[string]interface{}{"x": []interface{}{1.0, 2.0}, "y": "\r\n"},
+	}
+
+	var buf bytes.Buffer
+	enc := Indent("", "  ").NewLineDelimitedEncoder(&buf)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("Encode(%#v): %v", v, err)
+		}
+	}
+	expected := `1.5
+"multi\nline string"
+null
+true
+["a",2,{"b":"c"}]
+{"x":[1,2],"y":"\r\n"}
+`
+	if buf.String() != expected {
+		t.Fatalf("have:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+
+	dec := NewLineDelimitedDecoder(&buf)
+	for i, want := range values {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode #%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(v, want) {
+			t.Errorf("#%d: have: %#v, want: %#v", i, v, want)
+		}
+		if dec.Line() != i+1 {
+			t.Errorf("#%d: have line: %d, want: %d", i, dec.Line(), i+1)
+		}
+	}
+	var v interface{}
+	if err := dec.Decode(&v); err != io.EOF {
+		t.Errorf("have: %v, want: %v", err, io.EOF)
+	}
+}
+
+func TestLineDelimitedEncoderFlush(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	enc := NewLineDelimitedEncoder(w)
+	if err := enc.Encode(map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if buf.String() != "{\"a\":1}\n" {
+		t.Errorf("have: %q, want: %q", buf.String(), "{\"a\":1}\n")
+	}
+}
+
+func TestLineDelimitedDecoder(t *testing.T) {
+	t.Run("blank lines and no trailing newline", func(t *testing.T) {
+		dec := NewLineDelimitedDecoder(strings.NewReader("\n{\"A\":1}\r\n  \n{\"A\":2}"))
+		type T struct{ A int }
+		var out []T
+		for {
+			var v T
+			err := dec.Decode(&v)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			out = append(out, v)
+		}
+		expected := []T{{1}, {2}}
+		if !reflect.DeepEqual(out, expected) {
+			t.Errorf("have: %v, want: %v", out, expected)
+		}
+		if dec.Line() != 4 {
+			t.Errorf("have line: %d, want: 4", dec.Line())
+		}
+	})
+
+	t.Run("value spanning lines", func(t *testing.T) {
+		dec := NewLineDelimitedDecoder(strings.NewReader("{\n\"A\":1}\n"))
+		var v interface{}
+		if _, ok := dec.Decode(&v).(*SyntaxError); !ok {
+			t.Errorf("expected syntax error")
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		dec := UseNumber().NewLineDelimitedDecoder(strings.NewReader("1\n"))
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if _, ok := v.(json.Number); !ok {
+			t.Errorf("have: %T, want: json.Number", v)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package jsonx
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// The net/netip types implement encoding.TextMarshaler and
+// encoding.TextUnmarshaler, so they are encoded as their canonical strings
+// without any special handling.
+func TestNetIP(t *testing.T) {
+	type T struct {
+		Addr     netip.Addr
+		AddrPort netip.AddrPort
+		Prefix   netip.Prefix
+		Ptr      *netip.Addr
+		List     []netip.Addr
+		Keys     map[netip.Addr]int
+		Zero     netip.Addr
+	}
+	tests := []struct {
+		name     string
+		in       T
+		expected string
+	}{
+		{
+			name: "IPv4",
+			in: T{
+				Addr:     netip.MustParseAddr("192.0.2.1"),
+				AddrPort: netip.MustParseAddrPort("192.0.2.1:8080"),
+				Prefix:   netip.MustParsePrefix("192.0.2.0/24"),
+				Ptr:      addrPtr(netip.MustParseAddr("10.0.0.1")),
+				List:     []netip.Addr{netip.MustParseAddr("127.0.0.1")},
+				Keys:     map[netip.Addr]int{netip.MustParseAddr("10.0.0.2"): 2, netip.MustParseAddr("10.0.0.1"): 1},
+			},
+			expected: `{"Addr":"192.0.2.1","AddrPort":"192.0.2.1:8080","Prefix":"192.0.2.0/24","Ptr":"10.0.0.1",` +
+				`"List":["127.0.0.1"],"Keys":{"10.0.0.1":1,"10.0.0.2":2},"Zero":""}`,
+		},
+		{
+			name: "IPv6",
+			in: T{
+				Addr:     netip.MustParseAddr("2001:0db8:0000:0000:0000:0000:0000:0001"),
+				AddrPort: netip.MustParseAddrPort("[2001:db8::1]:443"),
+				Prefix:   netip.MustParsePrefix("2001:db8::/32"),
+				List:     []netip.Addr{netip.MustParseAddr("::ffff:192.0.2.1")},
+			},
+			expected: `{"Addr":"2001:db8::1","AddrPort":"[2001:db8::1]:443","Prefix":"2001:db8::/32","Ptr":null,` +
+				`"List":["::ffff:192.0.2.1"],"Keys":null,"Zero":""}`,
+		},
+		{
+			name: "zoned",
+			in: T{
+				Addr:     netip.MustParseAddr("fe80::1%eth0"),
+				AddrPort: netip.MustParseAddrPort("[fe80::1%eth0]:53"),
+			},
+			expected: `{"Addr":"fe80::1%eth0","AddrPort":"[fe80::1%eth0]:53","Prefix":"","Ptr":null,` +
+				`"List":null,"Keys":null,"Zero":""}`,
+		},
+	}
+	for _, tt := range tests {
+		b, err := Marshal(tt.in)
+		if err != nil {
+			t.Errorf("%s: Marshal: %v", tt.name, err)
+			continue
+		}
+		if string(b) != tt.expected {
+			t.Errorf("%s: have: %s, want: %s", tt.name, b, tt.expected)
+		}
+		var v T
+		if err := Unmarshal(b, &v); err != nil {
+			t.Errorf("%s: Unmarshal: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tt.in) {
+			t.Errorf("%s: have: %+v, want: %+v", tt.name, v, tt.in)
+		}
+	}
+
+	var v T
+	for _, in := range []string{`{"Addr":"192.0.2.256"}`, `{"AddrPort":"192.0.2.1"}`, `{"Prefix":"10.0.0.0/33"}`, `{"Addr":1}`} {
+		if err := Unmarshal([]byte(in), &v); err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+	}
+}
+
+func addrPtr(a netip.Addr) *netip.Addr {
+	return &a
+}
@@ -0,0 +1,138 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+// A Number represents a JSON number literal, like json.Number,
+// with helpers to convert it to Go number types.
+// It is encoded and decoded like json.Number, and NumberType causes
+// numbers decoded into an interface{} to be Numbers.
+type Number string
+
+var jsonxNumberType = reflect.TypeOf(Number(""))
+
+// isNumberType reports whether t is json.Number or Number.
+func isNumberType(t reflect.Type) bool {
+	return t == numberType || t == jsonxNumberType
+}
+
+// String returns the literal text of the number.
+func (n Number) String() string { return string(n) }
+
+// Int64 returns the number as an int64.
+// It fails if the number is not an integer literal or doesn't fit an int64.
+func (n Number) Int64() (int64, error) {
+	return strconv.ParseInt(string(n), 10, 64)
+}
+
+// Float64 returns the number as a float64.
+func (n Number) Float64() (float64, error) {
+	return strconv.ParseFloat(string(n), 64)
+}
+
+// maxBigIntBits limits the size of the integers BigInt creates from
+// numbers with an exponent, so that a short input such as 1e600000000
+// cannot make it allocate a huge integer.
+const maxBigIntBits = 1 << 20
+
+// BigInt returns the number as a *big.Int, and reports whether
+// it is an integer. Numbers with a fraction or an exponent, such as 1.0e3,
+// are accepted if their value is an integer. Because a short exponent can
+// describe an enormous integer, numbers with an exponent whose absolute value
+// needs more than 2^20 bits are rejected; numbers without one are limited
+// only by their length.
+func (n Number) BigInt() (*big.Int, bool) {
+	if i, ok := new(big.Int).SetString(string(n), 10); ok {
+		return i, true
+	}
+	f, ok := n.BigFloat()
+	if !ok || !f.IsInt() || f.MantExp(nil) > maxBigIntBits {
+		return nil, false
+	}
+	i, _ := f.Int(nil)
+	return i, true
+}
+
+// BigFloat returns the number as a *big.Float with enough precision
+// to hold all of its digits, and reports whether it is a valid number.
+func (n Number) BigFloat() (*big.Float, bool) {
+	// Like when decoding into a big.Float, keep all the digits of the literal.
+	prec := uint(len(n)) * 4
+	if prec < 64 {
+		prec = 64
+	}
+	f, ok := new(big.Float).SetPrec(prec).SetString(string(n))
+	if !ok || f.IsInf() {
+		return nil, false
+	}
+	return f, true
+}
+
+// IsInt reports whether the value of the number is an integer.
+// This includes numbers like 1.0 and 1e3.
+func (n Number) IsInt() bool {
+	f, ok := n.BigFloat()
+	return ok && f.IsInt()
+}
+
+// NumberType causes the decoder to unmarshal a number into an interface{}
+// as a Number instead of as a float64 or, with UseNumber, a json.Number.
+// It can be combined with DecimalMode to validate the exponent.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) NumberType() *JSON {
+	j2 := *j
+	j2.numberType = true
+	return &j2
+}
+
+// NumberType causes the decoder to unmarshal a number into an interface{}
+// as a Number.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func NumberType() *JSON {
+	return defaultJSON.NumberType()
+}
+
+// StrictFloat32 causes the decoder to return an error when a number
+// decoded into a float32 cannot be represented exactly by it, such as 0.1,
+// instead of rounding it to the nearest float32 value.
+// Numbers decoded into a float64 or an interface{} are not affected.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) StrictFloat32() *JSON {
+	j2 := *j
+	j2.strictFloat32 = true
+	return &j2
+}
+
+// StrictFloat32 causes the decoder to return an error when a number
+// decoded into a float32 cannot be represented exactly by it.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func StrictFloat32() *JSON {
+	return defaultJSON.StrictFloat32()
+}
+
+// isExactFloat32 reports whether f, the float32 value parsed from
+// the number literal s, is exactly equal to the value of s.
+func isExactFloat32(s string, f float64) bool {
+	if f == 0 {
+		// Avoid computing huge powers of ten for literals such as 1e-999999999,
+		// which underflow.
+		for i := 0; i < len(s) && s[i] != 'e' && s[i] != 'E'; i++ {
+			if '1' <= s[i] && s[i] <= '9' {
+				return false
+			}
+		}
+		return true
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return false
+	}
+	return r.Cmp(new(big.Rat).SetFloat64(f)) == 0
+}
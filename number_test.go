@@ -5,7 +5,9 @@
 package jsonx
 
 import (
+	"encoding/json"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -131,3 +133,141 @@ func BenchmarkNumberIsValidRegexp(b *testing.B) {
 		jsonNumberRegexp.MatchString(s)
 	}
 }
+
+func TestNumberType(t *testing.T) {
+	var v interface{}
+	err := NumberType().Unmarshal([]byte(`{"int":42,"float":1.5,"exp":1e3,"big":123456789012345678901234567890,"list":[-7]}`), &v)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	m := v.(map[string]interface{})
+	for key, n := range map[string]interface{}{"int": m["int"], "float": m["float"], "exp": m["exp"], "big": m["big"], "list": m["list"].([]interface{})[0]} {
+		if _, ok := n.(Number); !ok {
+			t.Errorf("%s: have %T, want Number", key, n)
+		}
+	}
+
+	n := m["int"].(Number)
+	if i, err := n.Int64(); err != nil || i != 42 {
+		t.Errorf("Int64: have %v, %v", i, err)
+	}
+	if f, err := n.Float64(); err != nil || f != 42 {
+		t.Errorf("Float64: have %v, %v", f, err)
+	}
+	if !n.IsInt() {
+		t.Errorf("IsInt: have false")
+	}
+
+	n = m["float"].(Number)
+	if _, err := n.Int64(); err == nil {
+		t.Errorf("Int64: expected error")
+	}
+	if f, err := n.Float64(); err != nil || f != 1.5 {
+		t.Errorf("Float64: have %v, %v", f, err)
+	}
+	if _, ok := n.BigInt(); ok || n.IsInt() {
+		t.Errorf("BigInt: expected failure")
+	}
+	if f, ok := n.BigFloat(); !ok || f.String() != "1.5" {
+		t.Errorf("BigFloat: have %v, %v", f, ok)
+	}
+
+	n = m["exp"].(Number)
+	if i, ok := n.BigInt(); !ok || i.String() != "1000" || !n.IsInt() {
+		t.Errorf("BigInt: have %v, %v", i, ok)
+	}
+
+	n = m["big"].(Number)
+	if _, err := n.Int64(); err == nil {
+		t.Errorf("Int64: expected error")
+	}
+	if i, ok := n.BigInt(); !ok || i.String() != "123456789012345678901234567890" {
+		t.Errorf("BigInt: have %v, %v", i, ok)
+	}
+	if f, ok := n.BigFloat(); !ok || f.Text('f', 0) != "123456789012345678901234567890" {
+		t.Errorf("BigFloat: have %v, %v", f, ok)
+	}
+
+	if i, err := m["list"].([]interface{})[0].(Number).Int64(); err != nil || i != -7 {
+		t.Errorf("Int64: have %v, %v", i, err)
+	}
+
+	// A huge exponent doesn't create a huge integer.
+	n = Number("1e600000000")
+	if !n.IsInt() {
+		t.Errorf("IsInt: have false")
+	}
+	if i, ok := n.BigInt(); ok {
+		t.Errorf("BigInt: have %d bits, expected failure", i.BitLen())
+	}
+	if i, ok := Number("1e300000").BigInt(); !ok || i.BitLen() != 996579 {
+		t.Errorf("BigInt: have %v, want 996579 bits", ok)
+	}
+
+	// Numbers are encoded as number literals.
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"big":123456789012345678901234567890,"exp":1e3,"float":1.5,"int":42,"list":[-7]}`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	// Number fields are decoded like json.Number fields.
+	var s struct {
+		N Number
+		P *Number
+	}
+	if err := Unmarshal([]byte(`{"N":0.25,"P":-1}`), &s); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if s.N != "0.25" || s.P == nil || *s.P != "-1" {
+		t.Errorf("have: %v, %v", s.N, s.P)
+	}
+	if err := Unmarshal([]byte(`{"N":"x"}`), &s); err == nil {
+		t.Errorf("expected error for invalid number")
+	}
+}
+
+func TestStrictFloat32(t *testing.T) {
+	type T struct {
+		F32 float32
+		F64 float64
+		Any interface{}
+		S   float32 `json:",string"`
+	}
+	exact := []string{"0.5", "0", "-0.0", "0e-999999999", "1.25e2", "16777216", "-0.375", "0.000030517578125"}
+	for _, s := range exact {
+		var v T
+		in := `{"F32":` + s + `,"F64":0.1,"Any":0.1,"S":"` + s + `"}`
+		if err := StrictFloat32().Unmarshal([]byte(in), &v); err != nil {
+			t.Errorf("%s: Unmarshal: %v", s, err)
+		}
+	}
+
+	inexact := []string{"0.1", "16777217", "1e-50", "3.4e38"}
+	for _, s := range inexact {
+		var v T
+		err := StrictFloat32().Unmarshal([]byte(`{"F32":`+s+`}`), &v)
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			t.Errorf("%s: have: %v, want UnmarshalTypeError", s, err)
+		}
+		err = StrictFloat32().Unmarshal([]byte(`{"S":"`+s+`"}`), &v)
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			t.Errorf("%s: string: have: %v, want UnmarshalTypeError", s, err)
+		}
+		// Without StrictFloat32, the value is rounded.
+		if err := Unmarshal([]byte(`{"F32":`+s+`}`), &v); err != nil {
+			t.Errorf("%s: Unmarshal: %v", s, err)
+		}
+	}
+
+	var f float32
+	dec := StrictFloat32().NewDecoder(strings.NewReader(`0.5 0.1`))
+	if err := dec.Decode(&f); err != nil || f != 0.5 {
+		t.Errorf("Decode: have: %v, %v", f, err)
+	}
+	if err := dec.Decode(&f); err == nil {
+		t.Errorf("Decode: expected error")
+	}
+}
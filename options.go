@@ -0,0 +1,151 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// DecodeOptions is a read-only view of the decoding options
+// passed to OptionsUnmarshaler.
+type DecodeOptions struct {
+	UseNumber             bool
+	NumberType            bool
+	DecimalMode           bool
+	DisallowUnknownFields bool
+	CaseSensitive         bool
+	ScalarOrArray         bool
+	CoerceScalars         bool
+	AutoUnquoteNumbers    bool
+	LenientNumbers        bool
+	StrictFloat32         bool
+	DisallowDuplicateKeys bool
+	MergeDecode           bool
+	ReplaceDecode         bool
+}
+
+// OptionsUnmarshaler is implemented by types that can unmarshal
+// a JSON description of themselves, taking the decoding options into account.
+// If a type implements both OptionsUnmarshaler and json.Unmarshaler,
+// the decoder calls UnmarshalJSONx.
+// The same rules apply to UnmarshalJSONx as to UnmarshalJSON.
+type OptionsUnmarshaler interface {
+	UnmarshalJSONx(data []byte, opts DecodeOptions) error
+}
+
+// optionsUnmarshaler adapts an OptionsUnmarshaler to json.Unmarshaler,
+// so that indirect can return it. The decoder calls UnmarshalJSONx
+// with its options instead of UnmarshalJSON, which uses the default options.
+type optionsUnmarshaler struct {
+	u OptionsUnmarshaler
+}
+
+func (u optionsUnmarshaler) UnmarshalJSON(data []byte) error {
+	return u.u.UnmarshalJSONx(data, DecodeOptions{})
+}
+
+// decodeOptions returns the options of the decoder.
+func (d *decodeState) decodeOptions() DecodeOptions {
+	return DecodeOptions{
+		UseNumber:             d.useNumber,
+		NumberType:            d.numberType,
+		DecimalMode:           d.decimalMode,
+		DisallowUnknownFields: d.disallowUnknownFields,
+		CaseSensitive:         d.caseSensitive,
+		ScalarOrArray:         d.scalarOrArray,
+		CoerceScalars:         d.coerceScalars,
+		AutoUnquoteNumbers:    d.autoUnquoteNumbers,
+		LenientNumbers:        d.lenientNumbers,
+		StrictFloat32:         d.strictFloat32,
+		DisallowDuplicateKeys: d.disallowDuplicateKeys,
+		MergeDecode:           d.mergeDecode,
+		ReplaceDecode:         d.replaceDecode,
+	}
+}
+
+// callUnmarshaler calls the unmarshaler u returned by indirect with data.
+func (d *decodeState) callUnmarshaler(u json.Unmarshaler, data []byte) error {
+	if ou, ok := u.(optionsUnmarshaler); ok {
+		return ou.u.UnmarshalJSONx(data, d.decodeOptions())
+	}
+	return u.UnmarshalJSON(data)
+}
+
+// EncodeOptions is a read-only view of the encoding options
+// passed to OptionsMarshaler.
+type EncodeOptions struct {
+	EscapeHTML       bool
+	Prefix           string // indentation prefix, see Indent
+	Indent           string // indentation string, see Indent
+	OmitEmpty        bool
+	EmptyAsNull      bool
+	NilAsEmpty       bool
+	EnumAsString     bool
+	TimeFormat       string
+	DurationAsString bool
+}
+
+// OptionsMarshaler is implemented by types that can marshal themselves
+// into valid JSON, taking the encoding options into account.
+// If a type implements both OptionsMarshaler and json.Marshaler,
+// the encoder calls MarshalJSONx.
+// Like the output of MarshalJSON, the output of MarshalJSONx is compacted,
+// and then indented along with the rest of the output,
+// so it doesn't need to be indented itself.
+type OptionsMarshaler interface {
+	MarshalJSONx(opts EncodeOptions) ([]byte, error)
+}
+
+var optionsMarshalerType = reflect.TypeOf((*OptionsMarshaler)(nil)).Elem()
+
+// encodeOptions returns the options passed to OptionsMarshaler.
+func (opts encOpts) encodeOptions() EncodeOptions {
+	return EncodeOptions{
+		EscapeHTML:       opts.escapeHTML,
+		Prefix:           opts.indentPrefix,
+		Indent:           opts.indentValue,
+		OmitEmpty:        opts.omitEmpty,
+		EmptyAsNull:      opts.emptyAsNull,
+		NilAsEmpty:       opts.nilAsEmpty,
+		EnumAsString:     opts.enumAsString,
+		TimeFormat:       opts.timeFormat,
+		DurationAsString: opts.durationAsString,
+	}
+}
+
+func optionsMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		e.WriteString("null")
+		return
+	}
+	m, ok := v.Interface().(OptionsMarshaler)
+	if !ok {
+		e.WriteString("null")
+		return
+	}
+	e.optionsMarshaler(m, v.Type(), opts)
+}
+
+func addrOptionsMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
+	va := v.Addr()
+	if va.IsNil() {
+		e.WriteString("null")
+		return
+	}
+	e.optionsMarshaler(va.Interface().(OptionsMarshaler), v.Type(), opts)
+}
+
+// optionsMarshaler writes the output of m, the value of type t, to e.
+func (e *encodeState) optionsMarshaler(m OptionsMarshaler, t reflect.Type, opts encOpts) {
+	b, err := m.MarshalJSONx(opts.encodeOptions())
+	if err == nil {
+		// copy JSON into buffer, checking validity.
+		err = compact(&e.Buffer, b, opts.escapeHTML)
+	}
+	if err != nil {
+		e.error(&MarshalerError{Type: t, Err: err, sourceFunc: "MarshalJSONx"})
+	}
+}
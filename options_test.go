@@ -0,0 +1,174 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// optionsAmount decodes numbers as strings under UseNumber
+// and as float64 values otherwise.
+type optionsAmount struct {
+	value interface{}
+	opts  DecodeOptions
+}
+
+func (a *optionsAmount) UnmarshalJSONx(data []byte, opts DecodeOptions) error {
+	a.opts = opts
+	if opts.UseNumber {
+		a.value = string(data)
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	a.value = f
+	return nil
+}
+
+// UnmarshalJSON is not called, because UnmarshalJSONx takes precedence.
+func (a *optionsAmount) UnmarshalJSON(data []byte) error {
+	a.value = "UnmarshalJSON"
+	return nil
+}
+
+func TestOptionsUnmarshaler(t *testing.T) {
+	type T struct {
+		A  optionsAmount
+		P  *optionsAmount
+		S  []optionsAmount
+		M  map[string]optionsAmount
+		Nu *optionsAmount
+	}
+	const data = `{"A":1.50,"P":2,"S":[3],"M":{"k":4},"Nu":null}`
+
+	var v T
+	if err := Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	values := []interface{}{v.A.value, v.P.value, v.S[0].value, v.M["k"].value}
+	if expected := []interface{}{1.5, 2.0, 3.0, 4.0}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("have: %v, want: %v", values, expected)
+	}
+	if v.Nu != nil {
+		t.Errorf("have: %v, want: nil", v.Nu)
+	}
+
+	var v2 T
+	if err := UseNumber().CaseSensitive().Unmarshal([]byte(data), &v2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	values = []interface{}{v2.A.value, v2.P.value, v2.S[0].value, v2.M["k"].value}
+	if expected := []interface{}{"1.50", "2", "3", "4"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("have: %v, want: %v", values, expected)
+	}
+	if expected := (DecodeOptions{UseNumber: true, CaseSensitive: true}); v2.A.opts != expected {
+		t.Errorf("have: %+v, want: %+v", v2.A.opts, expected)
+	}
+
+	// The options set on a Decoder are passed too.
+	dec := NewDecoder(strings.NewReader(`1.50`))
+	dec.UseNumber()
+	var a optionsAmount
+	if err := dec.Decode(&a); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if a.value != "1.50" {
+		t.Errorf("have: %v, want: 1.50", a.value)
+	}
+}
+
+// optionsHTML writes a string with HTML tags,
+// removing them when EscapeHTML is set.
+type optionsHTML string
+
+func (h optionsHTML) MarshalJSONx(opts EncodeOptions) ([]byte, error) {
+	s := string(h)
+	if opts.EscapeHTML {
+		s = strings.NewReplacer("<", "", ">", "").Replace(s)
+	}
+	return []byte(`{"html": ` + strconv.Quote(s) + `, "indent": ` + strconv.Quote(opts.Indent) + `}`), nil
+}
+
+// MarshalJSON is not called, because MarshalJSONx takes precedence.
+func (h optionsHTML) MarshalJSON() ([]byte, error) {
+	return []byte(`"MarshalJSON"`), nil
+}
+
+type optionsPtrMarshaler struct {
+	n int
+}
+
+func (m *optionsPtrMarshaler) MarshalJSONx(opts EncodeOptions) ([]byte, error) {
+	if opts.OmitEmpty && m.n == 0 {
+		return []byte(`null`), nil
+	}
+	return []byte(strconv.Itoa(m.n)), nil
+}
+
+func TestOptionsMarshaler(t *testing.T) {
+	type T struct {
+		H optionsHTML
+		P *optionsHTML
+	}
+	h := optionsHTML("<b>")
+	v := T{H: h, P: &h}
+
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected := `{"H":{"html":"b","indent":""},"P":{"html":"b","indent":""}}`
+	if string(b) != expected {
+		t.Errorf("have: %s\nwant: %s", b, expected)
+	}
+
+	b, err = New().EscapeHTML(false).Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected = `{"H":{"html":"<b>","indent":""},"P":{"html":"<b>","indent":""}}`
+	if string(b) != expected {
+		t.Errorf("have: %s\nwant: %s", b, expected)
+	}
+
+	// The output is indented along with the rest.
+	b, err = New().EscapeHTML(false).MarshalIndent(v.H, "", "\t")
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected = "{\n\t\"html\": \"<b>\",\n\t\"indent\": \"\\t\"\n}"
+	if string(b) != expected {
+		t.Errorf("have: %s\nwant: %s", b, expected)
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v.H); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	expected = "{\n  \"html\": \"<b>\",\n  \"indent\": \"  \"\n}\n"
+	if buf.String() != expected {
+		t.Errorf("have: %s\nwant: %s", buf.String(), expected)
+	}
+
+	// A pointer receiver is called on addressable values.
+	ms := []optionsPtrMarshaler{{0}, {2}}
+	b, err = OmitEmpty().Marshal(ms)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `[null,2]`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+}
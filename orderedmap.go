@@ -0,0 +1,155 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"reflect"
+)
+
+// A KeyValue is a single entry of an OrderedMap.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// OrderedMap is a JSON object that preserves the order of its keys.
+//
+// An OrderedMap marshals as a JSON object with its entries in stored order.
+// When unmarshaling into an OrderedMap, the entries are stored in the order
+// they appear in the input. Values are decoded as if they were unmarshaled
+// into an interface{} value, except that nested objects are decoded
+// as OrderedMaps instead of map[string]interface{}.
+// Duplicate keys in the input are preserved, unless DisallowDuplicateKeys is set.
+//
+// A nil OrderedMap marshals as the null JSON value, unless NilSliceAsEmpty is set.
+type OrderedMap []KeyValue
+
+var orderedMapType = reflect.TypeOf(OrderedMap(nil))
+
+// Get returns the value of the first entry with the given key,
+// and whether such an entry exists.
+func (m OrderedMap) Get(key string) (interface{}, bool) {
+	for _, kv := range m {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set replaces the value of the first entry with the given key,
+// or appends a new entry if there is none.
+func (m *OrderedMap) Set(key string, value interface{}) {
+	for i := range *m {
+		if (*m)[i].Key == key {
+			(*m)[i].Value = value
+			return
+		}
+	}
+	*m = append(*m, KeyValue{Key: key, Value: value})
+}
+
+// Delete removes all entries with the given key.
+func (m *OrderedMap) Delete(key string) {
+	n := 0
+	for _, kv := range *m {
+		if kv.Key != key {
+			(*m)[n] = kv
+			n++
+		}
+	}
+	for i := n; i < len(*m); i++ {
+		(*m)[i] = KeyValue{}
+	}
+	*m = (*m)[:n]
+}
+
+func (c *JSON) orderedMapEncoder(e *encodeState, v reflect.Value, opts encOpts) {
+	if opts.emptyAsNull && v.Len() == 0 {
+		e.WriteString("null")
+		return
+	}
+	if v.IsNil() {
+		if opts.nilAsEmpty {
+			e.WriteString("{}")
+		} else {
+			e.WriteString("null")
+		}
+		return
+	}
+	e.WriteByte('{')
+	m := v.Interface().(OrderedMap)
+	for i, kv := range m {
+		if i > 0 {
+			e.WriteByte(',')
+		}
+		e.string(kv.Key, opts.escapeHTML)
+		e.WriteByte(':')
+		c.reflectValue(e, reflect.ValueOf(kv.Value), opts)
+	}
+	e.WriteByte('}')
+}
+
+// orderedMapInterface is like objectInterface but returns an OrderedMap.
+// Nested objects are also decoded as OrderedMaps.
+func (d *decodeState) orderedMapInterface() OrderedMap {
+	orderedObjects := d.orderedObjects
+	d.orderedObjects = true
+	d.interfaceDepth++
+	defer func() {
+		d.orderedObjects = orderedObjects
+		d.interfaceDepth--
+	}()
+
+	m := OrderedMap{}
+	var seenKeys map[string]struct{}
+	for {
+		// Read opening " of string key or closing }.
+		d.scanWhile(scanSkipSpace)
+		if d.opcode == scanEndObject {
+			// closing } - can only happen on first iteration.
+			break
+		}
+		if d.opcode != scanBeginLiteral {
+			panic(phasePanicMsg)
+		}
+
+		// Read string key.
+		start := d.readIndex()
+		d.rescanLiteral()
+		item := d.data[start:d.readIndex()]
+		key, ok := d.unquote(item)
+		if !ok {
+			panic(phasePanicMsg)
+		}
+		if d.disallowDuplicateKeys {
+			d.checkDuplicateKey(&seenKeys, key, start)
+		}
+
+		// Read : before value.
+		if d.opcode == scanSkipSpace {
+			d.scanWhile(scanSkipSpace)
+		}
+		if d.opcode != scanObjectKey {
+			panic(phasePanicMsg)
+		}
+		d.scanWhile(scanSkipSpace)
+
+		// Read value.
+		m = append(m, KeyValue{Key: key, Value: d.valueInterface()})
+
+		// Next token must be , or }.
+		if d.opcode == scanSkipSpace {
+			d.scanWhile(scanSkipSpace)
+		}
+		if d.opcode == scanEndObject {
+			break
+		}
+		if d.opcode != scanObjectValue {
+			panic(phasePanicMsg)
+		}
+	}
+	return m
+}
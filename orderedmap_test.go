@@ -0,0 +1,132 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrderedMapRoundTrip(t *testing.T) {
+	data := `{"z":1,"a":"two","m":[{"y":true,"b":null}],"c":{"x":1,"d":2}}`
+
+	var m OrderedMap
+	if err := Unmarshal([]byte(data), &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	expected := OrderedMap{
+		{"z", float64(1)},
+		{"a", "two"},
+		{"m", []interface{}{OrderedMap{{"y", true}, {"b", nil}}}},
+		{"c", OrderedMap{{"x", float64(1)}, {"d", float64(2)}}},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("mismatch\nhave: %#+v\nwant: %#+v", m, expected)
+	}
+
+	b, err := Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != data {
+		diff(t, b, []byte(data))
+	}
+}
+
+func TestOrderedMapInStruct(t *testing.T) {
+	type T struct {
+		Name  string
+		Attrs OrderedMap
+		Ptr   *OrderedMap
+	}
+	data := `{"Name":"n","Attrs":{"b":1,"a":2},"Ptr":{"k":"v"}}`
+
+	var v T
+	if err := UseNumber().Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	expected := T{
+		Name:  "n",
+		Attrs: OrderedMap{{"b", json.Number("1")}, {"a", json.Number("2")}},
+		Ptr:   &OrderedMap{{"k", "v"}},
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("mismatch\nhave: %#+v\nwant: %#+v", v, expected)
+	}
+
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != data {
+		diff(t, b, []byte(data))
+	}
+
+	b, err = Marshal(T{Name: "n"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"Name":"n","Attrs":null,"Ptr":null}`; string(b) != expected {
+		diff(t, b, []byte(expected))
+	}
+}
+
+func TestOrderedMapDuplicateKeys(t *testing.T) {
+	data := []byte(`{"a":1,"b":2,"a":3}`)
+
+	var m OrderedMap
+	if err := Unmarshal(data, &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(m) != 3 {
+		t.Errorf("have %d entries, want 3", len(m))
+	}
+
+	m = nil
+	err := DisallowDuplicateKeys().Unmarshal(data, &m)
+	if _, ok := err.(*DuplicateKeyError); !ok {
+		t.Errorf("have: %v, want: DuplicateKeyError", err)
+	}
+}
+
+func TestOrderedMapUnmarshalTypeError(t *testing.T) {
+	var m OrderedMap
+	err := Unmarshal([]byte(`[1,2]`), &m)
+	if _, ok := err.(*json.UnmarshalTypeError); !ok {
+		t.Errorf("have: %v, want: UnmarshalTypeError", err)
+	}
+}
+
+func TestOrderedMapGetSet(t *testing.T) {
+	var m OrderedMap
+	m.Set("b", 1)
+	m.Set("a", 2)
+	m.Set("b", 3)
+	if v, ok := m.Get("b"); !ok || v != 3 {
+		t.Errorf("Get(b): have: %v, %v, want: 3, true", v, ok)
+	}
+	if _, ok := m.Get("c"); ok {
+		t.Errorf("Get(c): have: true, want: false")
+	}
+	b, err := New(KeyEncodeFn(strings.ToUpper)).Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	// Keys of an OrderedMap are not struct field names, so they are not encoded.
+	if expected := `{"b":3,"a":2}`; string(b) != expected {
+		diff(t, b, []byte(expected))
+	}
+}
+
+func TestOrderedMapDelete(t *testing.T) {
+	m := OrderedMap{{"a", 1}, {"b", 2}, {"a", 3}, {"c", 4}}
+	m.Delete("a")
+	m.Delete("x")
+	if expected := (OrderedMap{{"b", 2}, {"c", 4}}); !reflect.DeepEqual(m, expected) {
+		t.Errorf("have: %v, want: %v", m, expected)
+	}
+}
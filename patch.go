@@ -0,0 +1,518 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MergePatch applies the RFC 7386 JSON Merge Patch patch to original:
+// the members of a patch object are merged into the original object
+// recursively, a null member removes the key, and any other value,
+// including an array, replaces the original value.
+// Object keys keep their original order; new keys are added at the end.
+// Numbers are copied exactly. The result is encoded with the encoder's
+// options, such as EscapeHTML.
+func (c *JSON) MergePatch(original, patch []byte) ([]byte, error) {
+	target, err := c.decodeTree(original)
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.decodeTree(patch)
+	if err != nil {
+		return nil, err
+	}
+	return c.Marshal(mergePatch(target, p))
+}
+
+// MergePatch applies the RFC 7386 JSON Merge Patch patch to original.
+func MergePatch(original, patch []byte) ([]byte, error) {
+	return defaultJSON.MergePatch(original, patch)
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(OrderedMap)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(OrderedMap)
+	if !ok {
+		t = OrderedMap{}
+	}
+	for _, kv := range p {
+		if kv.Value == nil {
+			t.Delete(kv.Key)
+			continue
+		}
+		v, _ := t.Get(kv.Key)
+		t.Set(kv.Key, mergePatch(v, kv.Value))
+	}
+	return t
+}
+
+// ErrPatchTestFailed is the error wrapped in a PatchError
+// when a JSON Patch test operation fails.
+var ErrPatchTestFailed = errors.New("test failed")
+
+// A PatchError is returned by ApplyPatch when an operation cannot be applied.
+type PatchError struct {
+	Index int    // index of the operation in the patch
+	Op    string // name of the operation
+	Err   error  // reason the operation failed
+}
+
+func (e *PatchError) Error() string {
+	return "json: patch operation " + strconv.Itoa(e.Index) + " (" + e.Op + "): " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// patchOperation is an operation of a JSON Patch.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+var patchJSON = New().CaseSensitive()
+
+// ApplyPatch applies the RFC 6902 JSON Patch patch to doc. The operations
+// add, remove, replace, move, copy and test are supported. They are applied
+// in order, and if one of them fails, a *PatchError is returned and no
+// result is produced. A failed test operation returns a PatchError wrapping
+// ErrPatchTestFailed.
+// Object keys keep their original order; new keys are added at the end.
+// Numbers are copied exactly. The result is encoded with the encoder's
+// options, such as EscapeHTML.
+func (c *JSON) ApplyPatch(doc, patch []byte) ([]byte, error) {
+	root, err := c.decodeTree(doc)
+	if err != nil {
+		return nil, err
+	}
+	var ops []patchOperation
+	if err := patchJSON.Unmarshal(patch, &ops); err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		root, err = c.applyOperation(root, op)
+		if err != nil {
+			return nil, &PatchError{Index: i, Op: op.Op, Err: err}
+		}
+	}
+	return c.Marshal(root)
+}
+
+// ApplyPatch applies the RFC 6902 JSON Patch patch to doc.
+func ApplyPatch(doc, patch []byte) ([]byte, error) {
+	return defaultJSON.ApplyPatch(doc, patch)
+}
+
+func (c *JSON) applyOperation(root interface{}, op patchOperation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, errors.New("missing path")
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var from []string
+	switch op.Op {
+	case "move", "copy":
+		if op.From == nil {
+			return nil, errors.New("missing from")
+		}
+		if from, err = parsePointer(*op.From); err != nil {
+			return nil, err
+		}
+	}
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("missing value")
+		}
+		if value, err = c.decodeTree(op.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return updateTree(root, path, *op.Path, func(parent interface{}, tok string) (interface{}, error) {
+			return addValue(parent, tok, *op.Path, value)
+		})
+	case "remove":
+		return updateTree(root, path, *op.Path, func(parent interface{}, tok string) (interface{}, error) {
+			parent, _, err := removeValue(parent, tok, *op.Path)
+			return parent, err
+		})
+	case "replace":
+		return updateTree(root, path, *op.Path, func(parent interface{}, tok string) (interface{}, error) {
+			return replaceValue(parent, tok, *op.Path, value)
+		})
+	case "move":
+		if len(from) < len(path) && isPrefix(from, path) {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		root, err = updateTree(root, from, *op.From, func(parent interface{}, tok string) (interface{}, error) {
+			parent, value, err = removeValue(parent, tok, *op.From)
+			return parent, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return updateTree(root, path, *op.Path, func(parent interface{}, tok string) (interface{}, error) {
+			return addValue(parent, tok, *op.Path, value)
+		})
+	case "copy":
+		if value, err = getTree(root, from, *op.From); err != nil {
+			return nil, err
+		}
+		value = copyTree(value)
+		return updateTree(root, path, *op.Path, func(parent interface{}, tok string) (interface{}, error) {
+			return addValue(parent, tok, *op.Path, value)
+		})
+	case "test":
+		v, err := getTree(root, path, *op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !equalTree(v, value) {
+			return nil, ErrPatchTestFailed
+		}
+		return root, nil
+	}
+	return nil, errors.New("unknown operation " + strconv.Quote(op.Op))
+}
+
+// Diff returns an RFC 6902 JSON Patch that transforms a into b when applied
+// with ApplyPatch. Objects are compared key by key and arrays element by
+// element, so the patch only consists of add, remove and replace operations,
+// and it is not necessarily the shortest one: for example, inserting an element
+// at the beginning of an array replaces all the following elements.
+// The patch is encoded with the encoder's options, such as EscapeHTML.
+func (c *JSON) Diff(a, b []byte) ([]byte, error) {
+	x, err := c.decodeTree(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := c.decodeTree(b)
+	if err != nil {
+		return nil, err
+	}
+	ops := []OrderedMap{}
+	diffTree(&ops, "", x, y)
+	return c.Marshal(ops)
+}
+
+// Diff returns an RFC 6902 JSON Patch that transforms a into b.
+func Diff(a, b []byte) ([]byte, error) {
+	return defaultJSON.Diff(a, b)
+}
+
+// diffTree appends the operations that transform a, found at path, into b to ops.
+func diffTree(ops *[]OrderedMap, path string, a, b interface{}) {
+	switch x := a.(type) {
+	case OrderedMap:
+		y, ok := b.(OrderedMap)
+		if !ok {
+			break
+		}
+		for _, kv := range x {
+			if _, ok := y.Get(kv.Key); !ok {
+				*ops = append(*ops, OrderedMap{{"op", "remove"}, {"path", path + "/" + escapePointerToken(kv.Key)}})
+			}
+		}
+		for _, kv := range y {
+			p := path + "/" + escapePointerToken(kv.Key)
+			if v, ok := x.Get(kv.Key); ok {
+				diffTree(ops, p, v, kv.Value)
+			} else {
+				*ops = append(*ops, OrderedMap{{"op", "add"}, {"path", p}, {"value", kv.Value}})
+			}
+		}
+		return
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(x) && i < len(y); i++ {
+			diffTree(ops, path+"/"+strconv.Itoa(i), x[i], y[i])
+		}
+		for i := len(x) - 1; i >= len(y); i-- {
+			*ops = append(*ops, OrderedMap{{"op", "remove"}, {"path", path + "/" + strconv.Itoa(i)}})
+		}
+		for i := len(x); i < len(y); i++ {
+			*ops = append(*ops, OrderedMap{{"op", "add"}, {"path", path + "/-"}, {"value", y[i]}})
+		}
+		return
+	}
+	if !equalTree(a, b) {
+		*ops = append(*ops, OrderedMap{{"op", "replace"}, {"path", path}, {"value", b}})
+	}
+}
+
+// escapePointerToken escapes a key for use as a JSON Pointer reference token.
+func escapePointerToken(key string) string {
+	return strings.Replace(strings.Replace(key, "~", "~0", -1), "/", "~1", -1)
+}
+
+// getTree returns the value referenced by the pointer tokens in a decoded tree.
+func getTree(node interface{}, tokens []string, pointer string) (interface{}, error) {
+	for _, tok := range tokens {
+		switch n := node.(type) {
+		case OrderedMap:
+			v, ok := n.Get(tok)
+			if !ok {
+				return nil, &PointerError{pointer, "value not found"}
+			}
+			node = v
+		case []interface{}:
+			i, err := elementIndex(n, tok, pointer, false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, &PointerError{pointer, "cannot reference " + strconv.Quote(tok) + " in a scalar value"}
+		}
+	}
+	return node, nil
+}
+
+// updateTree replaces the parent of the value referenced by the pointer tokens
+// with the result of fn, called with the parent and the last token.
+// If tokens is empty, fn is called with a nil parent.
+// It returns the updated tree.
+func updateTree(node interface{}, tokens []string, pointer string, fn func(parent interface{}, tok string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 0 {
+		return fn(nil, "")
+	}
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+	tok := tokens[0]
+	switch n := node.(type) {
+	case OrderedMap:
+		child, ok := n.Get(tok)
+		if !ok {
+			return nil, &PointerError{pointer, "value not found"}
+		}
+		child, err := updateTree(child, tokens[1:], pointer, fn)
+		if err != nil {
+			return nil, err
+		}
+		n.Set(tok, child)
+		return n, nil
+	case []interface{}:
+		i, err := elementIndex(n, tok, pointer, false)
+		if err != nil {
+			return nil, err
+		}
+		if n[i], err = updateTree(n[i], tokens[1:], pointer, fn); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	return nil, &PointerError{pointer, "cannot reference " + strconv.Quote(tok) + " in a scalar value"}
+}
+
+// addValue adds value to parent as described by the add operation.
+// A nil parent with an empty token means the whole document is replaced.
+func addValue(parent interface{}, tok, pointer string, value interface{}) (interface{}, error) {
+	if pointer == "" {
+		return value, nil
+	}
+	switch n := parent.(type) {
+	case OrderedMap:
+		n.Set(tok, value)
+		return n, nil
+	case []interface{}:
+		i, err := elementIndex(n, tok, pointer, true)
+		if err != nil {
+			return nil, err
+		}
+		n = append(n, nil)
+		copy(n[i+1:], n[i:])
+		n[i] = value
+		return n, nil
+	}
+	return nil, &PointerError{pointer, "cannot reference " + strconv.Quote(tok) + " in a scalar value"}
+}
+
+// replaceValue replaces the value referenced by tok in parent with value.
+// A nil parent with an empty token means the whole document is replaced.
+func replaceValue(parent interface{}, tok, pointer string, value interface{}) (interface{}, error) {
+	if pointer == "" {
+		return value, nil
+	}
+	switch n := parent.(type) {
+	case OrderedMap:
+		if _, ok := n.Get(tok); !ok {
+			return nil, &PointerError{pointer, "value not found"}
+		}
+		n.Set(tok, value)
+		return n, nil
+	case []interface{}:
+		i, err := elementIndex(n, tok, pointer, false)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = value
+		return n, nil
+	}
+	return nil, &PointerError{pointer, "cannot reference " + strconv.Quote(tok) + " in a scalar value"}
+}
+
+// removeValue removes the value referenced by tok from parent,
+// and returns the updated parent and the removed value.
+// A nil parent with an empty token means the whole document is removed.
+func removeValue(parent interface{}, tok, pointer string) (interface{}, interface{}, error) {
+	if pointer == "" {
+		return nil, parent, nil
+	}
+	switch n := parent.(type) {
+	case OrderedMap:
+		v, ok := n.Get(tok)
+		if !ok {
+			return nil, nil, &PointerError{pointer, "value not found"}
+		}
+		n.Delete(tok)
+		return n, v, nil
+	case []interface{}:
+		i, err := elementIndex(n, tok, pointer, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := n[i]
+		return append(n[:i], n[i+1:]...), v, nil
+	}
+	return nil, nil, &PointerError{pointer, "cannot reference " + strconv.Quote(tok) + " in a scalar value"}
+}
+
+// elementIndex returns the index of the array element referenced by tok.
+// If insert is set, tok may also be "-" or the length of the array.
+func elementIndex(a []interface{}, tok, pointer string, insert bool) (int, error) {
+	if insert && tok == "-" {
+		return len(a), nil
+	}
+	i, ok := arrayIndex(tok)
+	if !ok {
+		return 0, &PointerError{pointer, "invalid array index " + strconv.Quote(tok)}
+	}
+	if i > len(a) || (i == len(a) && !insert) {
+		return 0, &PointerError{pointer, "array index " + tok + " out of range"}
+	}
+	return i, nil
+}
+
+func isPrefix(prefix, tokens []string) bool {
+	for i, tok := range prefix {
+		if tokens[i] != tok {
+			return false
+		}
+	}
+	return true
+}
+
+// copyTree returns a deep copy of a decoded tree.
+func copyTree(v interface{}) interface{} {
+	switch v := v.(type) {
+	case OrderedMap:
+		m := make(OrderedMap, len(v))
+		for i, kv := range v {
+			m[i] = KeyValue{Key: kv.Key, Value: copyTree(kv.Value)}
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, elem := range v {
+			a[i] = copyTree(elem)
+		}
+		return a
+	}
+	return v
+}
+
+// equalTree reports whether two decoded trees are equal as defined by RFC 6902:
+// numbers are compared by value and objects regardless of key order.
+func equalTree(a, b interface{}) bool {
+	switch a := a.(type) {
+	case OrderedMap:
+		b, ok := b.(OrderedMap)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for _, kv := range a {
+			v, ok := b.Get(kv.Key)
+			if !ok || !equalTree(kv.Value, v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equalTree(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if a == b {
+			return true
+		}
+		// With 4 bits per character, rounding can't make
+		// distinct numbers of up to that many digits equal.
+		prec := uint(len(a))
+		if len(b) > len(a) {
+			prec = uint(len(b))
+		}
+		prec = prec*4 + 64
+		x, _, errA := big.ParseFloat(string(a), 10, prec, big.ToNearestEven)
+		y, _, errB := big.ParseFloat(string(b), 10, prec, big.ToNearestEven)
+		return errA == nil && errB == nil && !x.IsInf() && x.Cmp(y) == 0
+	}
+	return a == b
+}
+
+// decodeTree decodes data into an interface{} value, with objects decoded
+// as OrderedMaps and numbers as json.Numbers, so that it can be re-encoded
+// without losing key order or precision.
+// data may use the relaxed syntax enabled on c, such as AllowComments.
+func (c *JSON) decodeTree(data []byte) (interface{}, error) {
+	var d decodeState
+	d.converter = treeJSON
+	d.useNumber = true
+	d.orderedObjects = true
+	c.initScanner(&d.scan)
+	if err := checkValid(data, &d.scan); err != nil {
+		return nil, err
+	}
+	d.init(data)
+	if d.needsRewrite() {
+		d.rewriteRelaxed()
+	}
+	d.scan.reset()
+	d.scanWhile(scanSkipSpace)
+	v := d.valueInterface()
+	return v, d.savedError
+}
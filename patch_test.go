@@ -0,0 +1,282 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import "testing"
+
+func TestMergePatch(t *testing.T) {
+	// Test cases from RFC 7386, Appendix A.
+	tests := []struct {
+		original, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+
+		// Example from RFC 7386, Section 3.
+		{
+			`{"title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],"content":"This will be unchanged"}`,
+			`{"title":"Hello!","phoneNumber":"+01-123-456-7890","author":{"familyName":null},"tags":["example"]}`,
+			`{"title":"Hello!","author":{"givenName":"John"},"tags":["example"],"content":"This will be unchanged","phoneNumber":"+01-123-456-7890"}`,
+		},
+
+		// Numbers are copied exactly.
+		{`{"n":12345678901234567890}`, `{"m":1.50}`, `{"n":12345678901234567890,"m":1.50}`},
+	}
+	for _, tt := range tests {
+		have, err := MergePatch([]byte(tt.original), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("MergePatch(%s, %s): %v", tt.original, tt.patch, err)
+			continue
+		}
+		if string(have) != tt.want {
+			t.Errorf("MergePatch(%s, %s) = %s, want %s", tt.original, tt.patch, have, tt.want)
+		}
+	}
+}
+
+func TestMergePatchEscapeHTML(t *testing.T) {
+	have, err := MergePatch([]byte(`{"a":"<b>"}`), []byte(`{"c":"&"}`))
+	if err != nil {
+		t.Fatalf("MergePatch: %v", err)
+	}
+	if expected := `{"a":"\u003cb\u003e","c":"\u0026"}`; string(have) != expected {
+		t.Errorf("have: %s, want: %s", have, expected)
+	}
+	have, err = New().EscapeHTML(false).MergePatch([]byte(`{"a":"<b>"}`), []byte(`{"c":"&"}`))
+	if err != nil {
+		t.Fatalf("MergePatch: %v", err)
+	}
+	if expected := `{"a":"<b>","c":"&"}`; string(have) != expected {
+		t.Errorf("have: %s, want: %s", have, expected)
+	}
+}
+
+func TestMergePatchSyntaxError(t *testing.T) {
+	if _, err := MergePatch([]byte(`{"a":1}`), []byte(`{"a":`)); err == nil {
+		t.Errorf("expected error for invalid patch")
+	}
+	if _, err := MergePatch([]byte(`{"a"`), []byte(`{}`)); err == nil {
+		t.Errorf("expected error for invalid original")
+	}
+}
+
+func TestMergePatchRelaxed(t *testing.T) {
+	j := New().AllowComments().AllowTrailingCommas().AllowSingleQuotes().AllowUnquotedKeys()
+	have, err := j.MergePatch([]byte(`{a: 1, /* c */ 'b': [2,],}`), []byte(`{"c": 3} // patch`))
+	if err != nil {
+		t.Fatalf("MergePatch: %v", err)
+	}
+	if expected := `{"a":1,"b":[2],"c":3}`; string(have) != expected {
+		t.Errorf("have: %s, want: %s", have, expected)
+	}
+	if _, err := MergePatch([]byte(`{"a": 1 /* c */}`), []byte(`{}`)); err == nil {
+		t.Errorf("expected error without AllowComments")
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	// Most test cases are from RFC 6902, Appendix A.
+	tests := []struct {
+		doc, patch, want string
+	}{
+		// add
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"foo":"bar","baz":"qux"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/0","value":"qux"}]`, `{"foo":["qux","bar"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`, `{"foo":"bar","baz":"qux"}`},
+		{`{"foo":null}`, `[{"op":"add","path":"/foo","value":1}]`, `{"foo":1}`},
+		{`{"foo":1}`, `[{"op":"add","path":"/bar","value":null}]`, `{"foo":1,"bar":null}`},
+		{`{"foo":1}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`},
+		{`{"":1}`, `[{"op":"add","path":"/","value":2}]`, `{"":2}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/a~1b","value":1},{"op":"add","path":"/m~0n","value":2}]`, `{"foo":"bar","a/b":1,"m~n":2}`},
+
+		// remove
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/2"}]`, `{"foo":["bar","qux"]}`},
+
+		// replace
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":[1,2,3]}`, `[{"op":"replace","path":"/foo/0","value":{"a":1}}]`, `{"foo":[{"a":1},2,3]}`},
+		{`{"foo":1}`, `[{"op":"replace","path":"","value":"x"}]`, `"x"`},
+
+		// move
+		{
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"foo":["a","b","c"]}`, `[{"op":"move","from":"/foo/2","path":"/foo/0"}]`, `{"foo":["c","a","b"]}`},
+		{`{"foo":["a","b"]}`, `[{"op":"move","from":"/foo/0","path":"/foo/-"}]`, `{"foo":["b","a"]}`},
+		{`{"foo":1}`, `[{"op":"move","from":"/foo","path":"/foo"}]`, `{"foo":1}`},
+
+		// copy
+		{`{"foo":{"bar":[1]}}`, `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"add","path":"/baz/bar/-","value":2}]`, `{"foo":{"bar":[1]},"baz":{"bar":[1,2]}}`},
+		{`{"foo":["a","b"]}`, `[{"op":"copy","from":"/foo/1","path":"/foo/0"}]`, `{"foo":["b","a","b"]}`},
+
+		// test
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+		{`{"a":{"x":1,"y":[1.0]}}`, `[{"op":"test","path":"/a","value":{"y":[1],"x":10e-1}}]`, `{"a":{"x":1,"y":[1.0]}}`},
+		{`{"a":null}`, `[{"op":"test","path":"/a","value":null}]`, `{"a":null}`},
+		{`{"a":12345678901234567890123}`, `[{"op":"test","path":"/a","value":1.2345678901234567890123e22}]`, `{"a":12345678901234567890123}`},
+	}
+	for _, tt := range tests {
+		have, err := ApplyPatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("ApplyPatch(%s, %s): %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if string(have) != tt.want {
+			t.Errorf("ApplyPatch(%s, %s) = %s, want %s", tt.doc, tt.patch, have, tt.want)
+		}
+	}
+}
+
+func TestApplyPatchError(t *testing.T) {
+	tests := []struct {
+		doc, patch string
+		index      int
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, 0},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":1}]`, 0},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/01","value":1}]`, 0},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-1","value":1}]`, 0},
+		{`{"foo":1}`, `[{"op":"add","path":"/foo"}]`, 0},
+		{`{"foo":1}`, `[{"op":"add","value":1}]`, 0},
+		{`{"foo":1}`, `[{"op":"remove","path":"/bar"}]`, 0},
+		{`{"foo":[1]}`, `[{"op":"remove","path":"/foo/1"}]`, 0},
+		{`{"foo":[1]}`, `[{"op":"remove","path":"/foo/-"}]`, 0},
+		{`{"foo":1}`, `[{"op":"replace","path":"/bar","value":1}]`, 0},
+		{`{"foo":[1]}`, `[{"op":"replace","path":"/foo/1","value":1}]`, 0},
+		{`{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, 0},
+		{`{"foo":1}`, `[{"op":"move","from":"/bar","path":"/baz"}]`, 0},
+		{`{"foo":1}`, `[{"op":"copy","path":"/baz"}]`, 0},
+		{`{"foo":1}`, `[{"op":"test","path":"/foo","value":1},{"op":"frobnicate","path":"/foo"}]`, 1},
+		{`{"foo":1}`, `[{"op":"add","path":"/foo/bar","value":1}]`, 0},
+		{`{"foo":1}`, `[{"op":"add","path":"foo","value":1}]`, 0},
+	}
+	for _, tt := range tests {
+		_, err := ApplyPatch([]byte(tt.doc), []byte(tt.patch))
+		perr, ok := err.(*PatchError)
+		if !ok {
+			t.Errorf("ApplyPatch(%s, %s): expected PatchError, have %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if perr.Index != tt.index {
+			t.Errorf("ApplyPatch(%s, %s): have index %d, want %d", tt.doc, tt.patch, perr.Index, tt.index)
+		}
+	}
+}
+
+func TestApplyPatchTestFailed(t *testing.T) {
+	tests := []struct {
+		doc, patch string
+	}{
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`},
+		{`{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`},
+		{`{"a":[1,2]}`, `[{"op":"test","path":"/a","value":[2,1]}]`},
+		{`{"a":{"x":1}}`, `[{"op":"test","path":"/a","value":{"x":1,"y":2}}]`},
+		{`{"a":null}`, `[{"op":"test","path":"/a","value":false}]`},
+		{`{"a":12345678901234567890123}`, `[{"op":"test","path":"/a","value":12345678901234567890124}]`},
+		{`{"a":0.10000000000000000001}`, `[{"op":"test","path":"/a","value":1e-1}]`},
+		{`{"a":1e700000000}`, `[{"op":"test","path":"/a","value":1e700000001}]`},
+	}
+	for _, tt := range tests {
+		_, err := ApplyPatch([]byte(tt.doc), []byte(tt.patch))
+		if perr, ok := err.(*PatchError); !ok || perr.Err != ErrPatchTestFailed {
+			t.Errorf("ApplyPatch(%s, %s): have %v, want ErrPatchTestFailed", tt.doc, tt.patch, err)
+		}
+	}
+
+	// A failed test operation prevents the rest of the patch from being applied.
+	_, err := ApplyPatch([]byte(`{"a":1}`), []byte(`[{"op":"remove","path":"/a"},{"op":"test","path":"/a","value":1}]`))
+	if perr, ok := err.(*PatchError); !ok || perr.Index != 1 || perr.Op != "test" {
+		t.Errorf("have: %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{`{"a":1}`, `{"a":1}`, `[]`},
+		{`{"a":1}`, `{"a":2}`, `[{"op":"replace","path":"/a","value":2}]`},
+		{`{"a":1,"b":2}`, `{"b":2,"c":null}`, `[{"op":"remove","path":"/a"},{"op":"add","path":"/c","value":null}]`},
+		{`{"a/b":{"m~n":1}}`, `{"a/b":{"m~n":[]}}`, `[{"op":"replace","path":"/a~1b/m~0n","value":[]}]`},
+		{`[1,2,3]`, `[1,5]`, `[{"op":"replace","path":"/1","value":5},{"op":"remove","path":"/2"}]`},
+		{`[1]`, `[1,2,3]`, `[{"op":"add","path":"/-","value":2},{"op":"add","path":"/-","value":3}]`},
+		{`{"a":1}`, `[1]`, `[{"op":"replace","path":"","value":[1]}]`},
+		{`{"n":1.0}`, `{"n":1}`, `[]`},
+	}
+	for _, tt := range tests {
+		have, err := Diff([]byte(tt.a), []byte(tt.b))
+		if err != nil {
+			t.Errorf("Diff(%s, %s): %v", tt.a, tt.b, err)
+			continue
+		}
+		if string(have) != tt.want {
+			t.Errorf("Diff(%s, %s) = %s, want %s", tt.a, tt.b, have, tt.want)
+		}
+	}
+}
+
+func TestDiffRoundTrip(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{`{}`, `{}`},
+		{`{"a":1}`, `{"b":2}`},
+		{`{"a":{"b":{"c":[1,2,{"d":"e"}]}}}`, `{"a":{"b":{"c":[1,{"d":"f"}],"x":true}}}`},
+		{`[1,2,3,4,5]`, `[]`},
+		{`[]`, `[[],{},null]`},
+		{`[{"id":1},{"id":2}]`, `[{"id":2},{"id":1},{"id":3}]`},
+		{`{"a":[1,2]}`, `{"a":{"0":1,"1":2}}`},
+		{`{"~":{"/":1},"":2}`, `{"~":{"/":3},"":null}`},
+		{`"x"`, `{"x":1}`},
+		{`null`, `[null]`},
+		{`{"big":12345678901234567890}`, `{"big":12345678901234567891}`},
+	}
+	for _, tt := range tests {
+		patch, err := Diff([]byte(tt.a), []byte(tt.b))
+		if err != nil {
+			t.Errorf("Diff(%s, %s): %v", tt.a, tt.b, err)
+			continue
+		}
+		have, err := ApplyPatch([]byte(tt.a), patch)
+		if err != nil {
+			t.Errorf("ApplyPatch(%s, %s): %v", tt.a, patch, err)
+			continue
+		}
+		x, err := defaultJSON.decodeTree(have)
+		if err != nil {
+			t.Fatal(err)
+		}
+		y, err := defaultJSON.decodeTree([]byte(tt.b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalTree(x, y) {
+			t.Errorf("Diff(%s, %s) = %s, applied: %s", tt.a, tt.b, patch, have)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// A PointerError describes a JSON Pointer that is malformed
+// or cannot be resolved against a document.
+type PointerError struct {
+	Pointer string // the JSON Pointer
+	Msg     string // description of the error
+}
+
+func (e *PointerError) Error() string {
+	return "json: pointer " + strconv.Quote(e.Pointer) + ": " + e.Msg
+}
+
+// GetPointer returns the value in data referenced by the RFC 6901 JSON Pointer
+// pointer, such as "/items/0/name". The empty pointer references the whole document.
+// Only the values on the path to the result are examined, nothing is unmarshaled.
+// data may use the relaxed syntax enabled on c, such as AllowComments,
+// and the result is returned as it appears in data.
+func (c *JSON) GetPointer(data []byte, pointer string) (json.RawMessage, error) {
+	t, err := c.findPointer(data, pointer)
+	if err != nil {
+		return nil, err
+	}
+	if !t.found {
+		return nil, &PointerError{pointer, "value not found"}
+	}
+	return append(json.RawMessage(nil), data[t.start:t.end]...), nil
+}
+
+// GetPointer returns the value in data referenced by the RFC 6901 JSON Pointer pointer.
+func GetPointer(data []byte, pointer string) (json.RawMessage, error) {
+	return defaultJSON.GetPointer(data, pointer)
+}
+
+// SetPointer returns a copy of data with the value referenced by the
+// RFC 6901 JSON Pointer pointer replaced with the encoding of value.
+// If the last token of the pointer is a key missing from its object,
+// the key is added at the end of the object. The token "-" appends
+// value to an array.
+// The rest of the document is copied as is; value and any added key
+// are encoded with the encoder's options, including EscapeHTML.
+func (c *JSON) SetPointer(data []byte, pointer string, value interface{}) ([]byte, error) {
+	t, err := c.findPointer(data, pointer)
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if t.found {
+		return splice(data, t.start, t.end, b), nil
+	}
+	if t.parentEnd < 0 {
+		return nil, &PointerError{pointer, "value not found"}
+	}
+	var ins []byte
+	if !t.parentEmpty {
+		ins = append(ins, ',')
+	}
+	if t.parentObject {
+		key, err := c.Marshal(t.key)
+		if err != nil {
+			return nil, err
+		}
+		ins = append(ins, key...)
+		ins = append(ins, ':')
+	}
+	ins = append(ins, b...)
+	return splice(data, t.parentEnd, t.parentEnd, ins), nil
+}
+
+// SetPointer returns a copy of data with the value referenced by the
+// RFC 6901 JSON Pointer pointer replaced with the encoding of value.
+func SetPointer(data []byte, pointer string, value interface{}) ([]byte, error) {
+	return defaultJSON.SetPointer(data, pointer, value)
+}
+
+// splice returns a copy of data with data[start:end] replaced with b.
+func splice(data []byte, start, end int, b []byte) []byte {
+	out := make([]byte, 0, len(data)-(end-start)+len(b))
+	out = append(out, data[:start]...)
+	out = append(out, b...)
+	return append(out, data[end:]...)
+}
+
+// pointerTarget is the result of resolving a JSON Pointer.
+type pointerTarget struct {
+	found      bool
+	start, end int // offsets of the value, if found
+
+	// If the last token is a missing key or the "-" array token,
+	// parentEnd is the offset of the closing bracket of its parent,
+	// otherwise it is -1.
+	parentEnd    int
+	parentEmpty  bool // the parent is empty or ends with a trailing comma
+	parentObject bool
+	key          string // the last token
+}
+
+// parsePointer splits a JSON Pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, &PointerError{pointer, "must be empty or start with /"}
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, tok := range tokens {
+		for j := 0; j < len(tok); j++ {
+			if tok[j] == '~' && (j+1 == len(tok) || (tok[j+1] != '0' && tok[j+1] != '1')) {
+				return nil, &PointerError{pointer, "invalid escape sequence in " + strconv.Quote(tok)}
+			}
+		}
+		tokens[i] = strings.Replace(strings.Replace(tok, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array index reference token.
+func arrayIndex(tok string) (int, bool) {
+	if tok == "" || (len(tok) > 1 && tok[0] == '0') {
+		return 0, false
+	}
+	for i := 0; i < len(tok); i++ {
+		if tok[i] < '0' || tok[i] > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(tok)
+	return n, err == nil
+}
+
+// findPointer resolves pointer against data.
+func (c *JSON) findPointer(data []byte, pointer string) (t pointerTarget, err error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return t, err
+	}
+	var d decodeState
+	c.initScanner(&d.scan)
+	if err := checkValid(data, &d.scan); err != nil {
+		return t, err
+	}
+	d.init(data)
+	d.scan.reset()
+	d.scanWhile(scanSkipSpace)
+	t.parentEnd = -1
+
+	// The offsets refer to data, so relaxed literals can't be rewritten
+	// as in Unmarshal. rescanLiteral only supports standard literals,
+	// so step through them with the scanner instead.
+	relaxed := d.scan.allowSingleQuotes || d.scan.allowUnquotedKeys || d.scan.allowExtendedNumbers
+	skipValue := func() {
+		if relaxed && d.opcode == scanBeginLiteral {
+			d.scanWhile(scanContinue)
+		} else {
+			d.skipValue()
+		}
+	}
+
+	for i, tok := range tokens {
+		last := i == len(tokens)-1
+		switch d.opcode {
+		case scanBeginObject:
+			for {
+				d.scanWhile(scanSkipSpace)
+				if d.opcode == scanEndObject {
+					if last {
+						// The object is empty or ends with a trailing comma.
+						t.parentEnd = d.readIndex()
+						t.parentEmpty = true
+						t.parentObject = true
+						t.key = tok
+					}
+					return t, nil
+				}
+				start := d.readIndex()
+				skipValue()
+				key, ok := d.pointerKey(d.data[start:d.readIndex()])
+				if !ok {
+					panic(phasePanicMsg)
+				}
+				if d.opcode == scanSkipSpace {
+					d.scanWhile(scanSkipSpace)
+				}
+				d.scanWhile(scanSkipSpace)
+				if key == tok {
+					break
+				}
+				skipValue()
+				if d.opcode == scanSkipSpace {
+					d.scanWhile(scanSkipSpace)
+				}
+				if d.opcode == scanEndObject {
+					if last {
+						t.parentEnd = d.readIndex()
+						t.parentObject = true
+						t.key = tok
+					}
+					return t, nil
+				}
+			}
+		case scanBeginArray:
+			n, ok := arrayIndex(tok)
+			if !ok && tok != "-" {
+				return t, &PointerError{pointer, "invalid array index " + strconv.Quote(tok)}
+			}
+			d.scanWhile(scanSkipSpace)
+			if d.opcode == scanEndArray {
+				if last && tok == "-" {
+					t.parentEnd = d.readIndex()
+					t.parentEmpty = true
+				}
+				return t, nil
+			}
+			for j := 0; tok == "-" || j < n; j++ {
+				skipValue()
+				if d.opcode == scanSkipSpace {
+					d.scanWhile(scanSkipSpace)
+				}
+				if d.opcode == scanEndArray {
+					if last && tok == "-" {
+						t.parentEnd = d.readIndex()
+					}
+					return t, nil
+				}
+				d.scanWhile(scanSkipSpace)
+				if d.opcode == scanEndArray {
+					// A trailing comma.
+					if last && tok == "-" {
+						t.parentEnd = d.readIndex()
+						t.parentEmpty = true
+					}
+					return t, nil
+				}
+			}
+		default:
+			return t, &PointerError{pointer, "cannot reference " + strconv.Quote(tok) + " in a scalar value"}
+		}
+	}
+
+	t.found = true
+	t.start = d.readIndex()
+	skipValue()
+	t.end = d.readIndex()
+	return t, nil
+}
+
+// pointerKey unquotes the object key literal key, which may also be
+// single-quoted or unquoted if the relaxed syntax allows it.
+func (d *decodeState) pointerKey(key []byte) (string, bool) {
+	switch key[0] {
+	case '"':
+		return d.unquote(key)
+	case '\'':
+		return d.unquote(relaxedToStandard(key))
+	}
+	return string(key), true
+}
@@ -0,0 +1,173 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import "testing"
+
+const pointerDoc = `{
+	"name": "doc",
+	"items": [ {"id": 1, "tags": ["a", "b"]}, {"id": 2, "tags": []} ],
+	"a/b": "slash",
+	"m~n": "tilde",
+	"": "empty",
+	"meta": {}
+}`
+
+func TestGetPointer(t *testing.T) {
+	tests := []struct {
+		pointer, want string
+	}{
+		{"", pointerDoc},
+		{"/name", `"doc"`},
+		{"/items/0/id", `1`},
+		{"/items/0/tags", `["a", "b"]`},
+		{"/items/0/tags/1", `"b"`},
+		{"/items/1", `{"id": 2, "tags": []}`},
+		{"/a~1b", `"slash"`},
+		{"/m~0n", `"tilde"`},
+		{"/", `"empty"`},
+		{"/meta", `{}`},
+	}
+	for _, tt := range tests {
+		have, err := GetPointer([]byte(pointerDoc), tt.pointer)
+		if err != nil {
+			t.Errorf("GetPointer(%q): %v", tt.pointer, err)
+			continue
+		}
+		if string(have) != tt.want {
+			t.Errorf("GetPointer(%q) = %s, want %s", tt.pointer, have, tt.want)
+		}
+	}
+
+	have, err := GetPointer([]byte(" 12 "), "")
+	if err != nil || string(have) != "12" {
+		t.Errorf("GetPointer scalar = %s, %v", have, err)
+	}
+}
+
+func TestGetPointerError(t *testing.T) {
+	tests := []string{
+		"name",
+		"/missing",
+		"/items/2",
+		"/items/-",
+		"/items/01",
+		"/items/x",
+		"/name/0",
+		"/a~2b",
+		"/meta/x",
+	}
+	for _, pointer := range tests {
+		_, err := GetPointer([]byte(pointerDoc), pointer)
+		if _, ok := err.(*PointerError); !ok {
+			t.Errorf("GetPointer(%q): expected PointerError, have %v", pointer, err)
+		}
+	}
+
+	if _, err := GetPointer([]byte(`{"a":`), "/a"); err == nil {
+		t.Errorf("expected syntax error")
+	}
+}
+
+func TestSetPointer(t *testing.T) {
+	tests := []struct {
+		in, pointer string
+		value       interface{}
+		want        string
+	}{
+		{`{"a": {"b": 1}}`, "/a/b", 2, `{"a": {"b": 2}}`},
+		{`{"a": {"b": 1}}`, "/a/c", []int{1}, `{"a": {"b": 1,"c":[1]}}`},
+		{`{"a": {}}`, "/a/c", true, `{"a": {"c":true}}`},
+		{`{"a": [1, 2, 3]}`, "/a/1", "x", `{"a": [1, "x", 3]}`},
+		{`{"a": [1, 2]}`, "/a/-", 3, `{"a": [1, 2,3]}`},
+		{`{"a": [ ]}`, "/a/-", 3, `{"a": [ 3]}`},
+		{`[[1], [2]]`, "/1/-", map[string]int{"k": 1}, `[[1], [2,{"k":1}]]`},
+		{`{"a/b": 1}`, "/a~1b", nil, `{"a/b": null}`},
+		{`{"a": 1}`, "", "root", `"root"`},
+		{`{"a": 1}`, "/a", "<b>", `{"a": "\u003cb\u003e"}`},
+	}
+	for _, tt := range tests {
+		have, err := SetPointer([]byte(tt.in), tt.pointer, tt.value)
+		if err != nil {
+			t.Errorf("SetPointer(%s, %q): %v", tt.in, tt.pointer, err)
+			continue
+		}
+		if string(have) != tt.want {
+			t.Errorf("SetPointer(%s, %q) = %s, want %s", tt.in, tt.pointer, have, tt.want)
+		}
+	}
+
+	have, err := New().EscapeHTML(false).SetPointer([]byte(`{"a": 1}`), "/<b>", "<b>")
+	if err != nil {
+		t.Fatalf("SetPointer: %v", err)
+	}
+	if string(have) != `{"a": 1,"<b>":"<b>"}` {
+		t.Errorf("have: %s", have)
+	}
+}
+
+func TestPointerRelaxed(t *testing.T) {
+	j := New().AllowComments().AllowTrailingCommas().AllowSingleQuotes().AllowUnquotedKeys().AllowExtendedNumbers()
+	doc := `{/* c */ "a": [1, 'two', 0x10,], b: {'c\'d': +1.,},}`
+	gets := []struct {
+		pointer, want string
+	}{
+		{"/a/1", `'two'`},
+		{"/a/2", `0x10`},
+		{"/b/c'd", `+1.`},
+	}
+	for _, tt := range gets {
+		have, err := j.GetPointer([]byte(doc), tt.pointer)
+		if err != nil {
+			t.Errorf("GetPointer(%q): %v", tt.pointer, err)
+			continue
+		}
+		if string(have) != tt.want {
+			t.Errorf("GetPointer(%q) = %s, want %s", tt.pointer, have, tt.want)
+		}
+	}
+	if _, err := j.GetPointer([]byte(doc), "/a/3"); err == nil {
+		t.Errorf("GetPointer past a trailing comma: expected error")
+	}
+
+	sets := []struct {
+		pointer, want string
+	}{
+		{"/a/-", `{/* c */ "a": [1, 'two', 0x10,5], b: {'c\'d': +1.,},}`},
+		{"/b/e", `{/* c */ "a": [1, 'two', 0x10,], b: {'c\'d': +1.,"e":5},}`},
+		{"/f", `{/* c */ "a": [1, 'two', 0x10,], b: {'c\'d': +1.,},"f":5}`},
+	}
+	for _, tt := range sets {
+		have, err := j.SetPointer([]byte(doc), tt.pointer, 5)
+		if err != nil {
+			t.Errorf("SetPointer(%q): %v", tt.pointer, err)
+			continue
+		}
+		if string(have) != tt.want {
+			t.Errorf("SetPointer(%q) = %s, want %s", tt.pointer, have, tt.want)
+		}
+	}
+
+	if _, err := GetPointer([]byte(doc), "/a"); err == nil {
+		t.Errorf("GetPointer without relaxed syntax: expected error")
+	}
+}
+
+func TestSetPointerError(t *testing.T) {
+	tests := []struct {
+		in, pointer string
+	}{
+		{`{"a": [1]}`, "/a/1"},
+		{`{"a": [1]}`, "/b/c"},
+		{`{"a": 1}`, "/a/b"},
+		{`[1]`, "/x"},
+	}
+	for _, tt := range tests {
+		_, err := SetPointer([]byte(tt.in), tt.pointer, 1)
+		if _, ok := err.(*PointerError); !ok {
+			t.Errorf("SetPointer(%s, %q): expected PointerError, have %v", tt.in, tt.pointer, err)
+		}
+	}
+}
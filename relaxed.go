@@ -0,0 +1,146 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"bytes"
+	"math/big"
+)
+
+// The relaxed syntax accepted by AllowSingleQuotes, AllowUnquotedKeys
+// and AllowExtendedNumbers is validated by the scanner, but the rest of the decoder only understands standard JSON.
+// Before decoding, d.data is rewritten into standard JSON by relaxedToStandard.
+
+// needsRewrite reports whether d.data may use syntax that must be
+// rewritten before decoding.
+func (d *decodeState) needsRewrite() bool {
+	return d.scan.allowUnquotedKeys || d.scan.allowExtendedNumbers ||
+		d.scan.allowSingleQuotes && bytes.IndexByte(d.data[d.off:], '\'') >= 0
+}
+
+// rewriteRelaxed replaces d.data with its standard JSON equivalent.
+// d.data must have been validated by a scanner with the same options as d.scan.
+func (d *decodeState) rewriteRelaxed() {
+	d.init(relaxedToStandard(d.data[d.off:]))
+}
+
+// relaxedToStandard rewrites the valid relaxed JSON data into standard JSON.
+// Single-quoted strings are converted to double-quoted strings,
+// and \' escapes are replaced by '. Unquoted object keys are quoted.
+// Extended numbers are converted to standard numbers by appendStandardNumber.
+// Comments are kept as they are.
+func relaxedToStandard(data []byte) []byte {
+	out := make([]byte, 0, len(data)+len(data)/8)
+	for i := 0; i < len(data); {
+		switch c := data[i]; c {
+		case '"', '\'':
+			out = append(out, '"')
+			for i++; data[i] != c; i++ {
+				switch data[i] {
+				case '\\':
+					i++
+					if data[i] != '\'' {
+						out = append(out, '\\')
+					}
+				case '"':
+					// Only possible in a single-quoted string.
+					out = append(out, '\\')
+				}
+				out = append(out, data[i])
+			}
+			out = append(out, '"')
+			i++
+		case '/':
+			// A comment. Copy it so that quotes in it are not mistaken
+			// for strings.
+			n := commentLen(data[i:])
+			if n <= 0 {
+				// A line comment at the end of the input.
+				n = len(data) - i
+			}
+			out = append(out, data[i:i+n]...)
+			i += n
+		case '-', '+', '.', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			j := i + 1
+			for j < len(data) && isNumberByte(data[j]) {
+				j++
+			}
+			out = appendStandardNumber(out, data[i:j])
+			i = j
+		default:
+			if !isIdentifierStart(c) {
+				out = append(out, c)
+				i++
+				break
+			}
+			// An unquoted key, or a literal such as true, or the exponent
+			// of a number. Only a key can be followed by a colon.
+			j := i + 1
+			for j < len(data) && isIdentifierByte(data[j]) {
+				j++
+			}
+			if isFollowedByColon(data[j:]) {
+				out = append(out, '"')
+				out = append(out, data[i:j]...)
+				out = append(out, '"')
+			} else {
+				out = append(out, data[i:j]...)
+			}
+			i = j
+		}
+	}
+	return out
+}
+
+func isNumberByte(c byte) bool {
+	return isIdentifierByte(c) || c == '.' || c == '+' || c == '-'
+}
+
+// appendStandardNumber appends the valid relaxed number literal lit to out
+// as a standard JSON number. A leading + sign is removed, a decimal point
+// without digits before or after it gets a 0 or is removed,
+// and hexadecimal integers are converted to decimal.
+func appendStandardNumber(out, lit []byte) []byte {
+	switch lit[0] {
+	case '+':
+		lit = lit[1:]
+	case '-':
+		out = append(out, '-')
+		lit = lit[1:]
+	}
+	if len(lit) > 2 && lit[0] == '0' && (lit[1] == 'x' || lit[1] == 'X') {
+		n, _ := new(big.Int).SetString(string(lit[2:]), 16)
+		return n.Append(out, 10)
+	}
+	if lit[0] == '.' {
+		out = append(out, '0')
+	}
+	for i, c := range lit {
+		if c == '.' && (i == len(lit)-1 || lit[i+1] == 'e' || lit[i+1] == 'E') {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// isFollowedByColon reports whether the first byte of data that is not
+// space or part of a comment is a colon.
+func isFollowedByColon(data []byte) bool {
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case isSpace(c):
+		case c == '/':
+			n := commentLen(data[i:])
+			if n <= 0 {
+				return false
+			}
+			i += n - 1
+		default:
+			return c == ':'
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Scan reads a stream of JSON values from r and calls fn with each token,
+// as returned by Decoder.Token, and the JSONPath of the value it belongs to,
+// such as "$.items[2].name". The delimiters of an object or array and
+// the object keys have the path of the object or array and the member,
+// respectively. Keys that are not identifiers are written as
+// bracketed strings, e.g. $['first name'].
+// The path of each top-level value in the stream is "$".
+//
+// Numbers are float64 values, or json.Number values if UseNumber is set.
+// If fn returns an error, Scan stops and returns it.
+func (c *JSON) Scan(r io.Reader, fn func(path string, tok json.Token) error) error {
+	type frame struct {
+		array     bool
+		index     int
+		key       string
+		expectKey bool
+	}
+	var stack []frame
+	var path []byte
+	buildPath := func() string {
+		path = append(path[:0], '$')
+		for _, f := range stack {
+			if f.array {
+				if f.index >= 0 {
+					path = append(path, '[')
+					path = strconv.AppendInt(path, int64(f.index), 10)
+					path = append(path, ']')
+				}
+			} else if !f.expectKey {
+				path = appendPathKey(path, f.key)
+			}
+		}
+		return string(path)
+	}
+	beginValue := func() {
+		if n := len(stack); n > 0 && stack[n-1].array {
+			stack[n-1].index++
+		}
+	}
+	endValue := func() {
+		if n := len(stack); n > 0 && !stack[n-1].array {
+			stack[n-1].expectKey = true
+		}
+	}
+
+	dec := c.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			beginValue()
+			if err := fn(buildPath(), tok); err != nil {
+				return err
+			}
+			stack = append(stack, frame{array: tok == json.Delim('['), index: -1, expectKey: true})
+			continue
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			if err := fn(buildPath(), tok); err != nil {
+				return err
+			}
+			endValue()
+			continue
+		}
+		if n := len(stack); n > 0 && !stack[n-1].array && stack[n-1].expectKey {
+			stack[n-1].key = tok.(string)
+			stack[n-1].expectKey = false
+			if err := fn(buildPath(), tok); err != nil {
+				return err
+			}
+			continue
+		}
+		beginValue()
+		if err := fn(buildPath(), tok); err != nil {
+			return err
+		}
+		endValue()
+	}
+}
+
+// Scan reads a stream of JSON values from r and calls fn with each token
+// and the JSONPath of the value it belongs to.
+func Scan(r io.Reader, fn func(path string, tok json.Token) error) error {
+	return defaultJSON.Scan(r, fn)
+}
+
+var pathKeyReplacer = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// appendPathKey appends the JSONPath selector of an object member to path.
+func appendPathKey(path []byte, key string) []byte {
+	if isPathIdentifier(key) {
+		path = append(path, '.')
+		return append(path, key...)
+	}
+	path = append(path, "['"...)
+	path = append(path, pathKeyReplacer.Replace(key)...)
+	return append(path, "']"...)
+}
+
+func isPathIdentifier(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	const data = `{
+		"name": "doc",
+		"items": [
+			{"id": 1, "tags": ["a", "b"]},
+			{"id": 2, "tags": []},
+			[true, null]
+		],
+		"first name": {"it's": 1.5},
+		"empty": {}
+	} 3`
+	expected := []string{
+		`$ {`,
+		`$.name "name"`,
+		`$.name "doc"`,
+		`$.items "items"`,
+		`$.items [`,
+		`$.items[0] {`,
+		`$.items[0].id "id"`,
+		`$.items[0].id 1`,
+		`$.items[0].tags "tags"`,
+		`$.items[0].tags [`,
+		`$.items[0].tags[0] "a"`,
+		`$.items[0].tags[1] "b"`,
+		`$.items[0].tags ]`,
+		`$.items[0] }`,
+		`$.items[1] {`,
+		`$.items[1].id "id"`,
+		`$.items[1].id 2`,
+		`$.items[1].tags "tags"`,
+		`$.items[1].tags [`,
+		`$.items[1].tags ]`,
+		`$.items[1] }`,
+		`$.items[2] [`,
+		`$.items[2][0] true`,
+		`$.items[2][1] <nil>`,
+		`$.items[2] ]`,
+		`$.items ]`,
+		`$['first name'] "first name"`,
+		`$['first name'] {`,
+		`$['first name']['it\'s'] "it's"`,
+		`$['first name']['it\'s'] 1.5`,
+		`$['first name'] }`,
+		`$.empty "empty"`,
+		`$.empty {`,
+		`$.empty }`,
+		`$ }`,
+		`$ 3`,
+	}
+	var have []string
+	err := Scan(strings.NewReader(data), func(path string, tok json.Token) error {
+		switch tok := tok.(type) {
+		case json.Delim:
+			have = append(have, path+" "+tok.String())
+		case string:
+			have = append(have, fmt.Sprintf("%s %q", path, tok))
+		default:
+			have = append(have, fmt.Sprintf("%s %v", path, tok))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if !reflect.DeepEqual(have, expected) {
+		t.Errorf("mismatch\nhave: %q\nwant: %q", have, expected)
+	}
+}
+
+func TestScanUseNumber(t *testing.T) {
+	var tokens []json.Token
+	err := UseNumber().Scan(strings.NewReader(`{"n":[1.50]}`), func(path string, tok json.Token) error {
+		if path == "$.n[0]" {
+			tokens = append(tokens, tok)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if expected := []json.Token{json.Number("1.50")}; !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("have: %#v, want: %#v", tokens, expected)
+	}
+}
+
+func TestScanError(t *testing.T) {
+	stop := errors.New("stop")
+	n := 0
+	err := Scan(strings.NewReader(`[1,2,3]`), func(path string, tok json.Token) error {
+		n++
+		if path == "$[1]" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 3 {
+		t.Errorf("have: %v after %d tokens, want: %v after 3", err, n, stop)
+	}
+
+	err = Scan(strings.NewReader(`{"a":}`), func(path string, tok json.Token) error { return nil })
+	if err == nil {
+		t.Errorf("expected syntax error")
+	}
+}
@@ -78,6 +78,45 @@ type scanner struct {
 	// total bytes consumed, updated by decoder.Decode (and deliberately
 	// not set to zero by scan.reset)
 	bytes int64
+
+	// Limits on the input, if positive. They are not reset by scan.reset.
+	maxDepth      int
+	maxStringLen  int
+	maxObjectKeys int
+
+	// Accept a comma before the closing ] or }. Not reset by scan.reset.
+	allowTrailingCommas bool
+
+	// Accept // and /* */ comments where space is allowed.
+	// Not reset by scan.reset.
+	allowComments bool
+
+	// The step to return to at the end of the current comment,
+	// and whether the input must not end before the end of the comment,
+	// as in a block comment.
+	commentEnd     func(*scanner, byte) int
+	inCommentNoEOF bool
+
+	// Accept strings in single quotes. Not reset by scan.reset.
+	allowSingleQuotes bool
+
+	// The opening quote character of the current string.
+	quote byte
+
+	// Accept object keys that are identifiers without quotes.
+	// Not reset by scan.reset.
+	allowUnquotedKeys bool
+
+	// Accept hexadecimal integers, a leading + sign, and a leading or
+	// trailing decimal point in numbers. Not reset by scan.reset.
+	allowExtendedNumbers bool
+
+	// Value of bytes at the opening quote of the current string.
+	stringStart int64
+
+	// Number of keys read so far in each entry of parseState,
+	// only maintained if maxObjectKeys is positive.
+	keyCounts []int
 }
 
 var scannerPool = sync.Pool{
@@ -98,6 +137,7 @@ func freeScanner(scan *scanner) {
 	// Avoid hanging on to too much memory in extreme cases.
 	if len(scan.parseState) > 1024 {
 		scan.parseState = nil
+		scan.keyCounts = nil
 	}
 	scannerPool.Put(scan)
 }
@@ -142,8 +182,10 @@ const (
 func (s *scanner) reset() {
 	s.step = stateBeginValue
 	s.parseState = s.parseState[0:0]
+	s.keyCounts = s.keyCounts[0:0]
 	s.err = nil
 	s.endTop = false
+	s.inCommentNoEOF = false
 }
 
 // eof tells the scanner that the end of input has been reached.
@@ -152,6 +194,10 @@ func (s *scanner) eof() int {
 	if s.err != nil {
 		return scanError
 	}
+	if s.inCommentNoEOF {
+		s.err = &SyntaxError{"unexpected end of JSON input", s.bytes}
+		return scanError
+	}
 	if s.endTop {
 		return scanEnd
 	}
@@ -165,9 +211,17 @@ func (s *scanner) eof() int {
 	return scanError
 }
 
-// pushParseState pushes a new parse state p onto the parse stack.
-func (s *scanner) pushParseState(p int) {
+// pushParseState pushes a new parse state p onto the parse stack
+// and returns successState, or scanError if the stack is deeper than allowed.
+func (s *scanner) pushParseState(p int, successState int) int {
 	s.parseState = append(s.parseState, p)
+	if s.maxObjectKeys > 0 {
+		s.keyCounts = append(s.keyCounts, 0)
+	}
+	if s.maxDepth > 0 && len(s.parseState) > s.maxDepth {
+		return s.limitError("depth", s.maxDepth)
+	}
+	return successState
 }
 
 // popParseState pops a parse state (already obtained) off the stack
@@ -175,6 +229,9 @@ func (s *scanner) pushParseState(p int) {
 func (s *scanner) popParseState() {
 	n := len(s.parseState) - 1
 	s.parseState = s.parseState[0:n]
+	if s.maxObjectKeys > 0 {
+		s.keyCounts = s.keyCounts[0:n]
+	}
 	if n == 0 {
 		s.step = stateEndTop
 		s.endTop = true
@@ -195,6 +252,9 @@ func stateBeginValueOrEmpty(s *scanner, c byte) int {
 	if c == ']' {
 		return stateEndValue(s, c)
 	}
+	if c == '/' && s.allowComments {
+		return s.beginComment(stateBeginValueOrEmpty)
+	}
 	return stateBeginValue(s, c)
 }
 
@@ -206,20 +266,20 @@ func stateBeginValue(s *scanner, c byte) int {
 	switch c {
 	case '{':
 		s.step = stateBeginStringOrEmpty
-		s.pushParseState(parseObjectKey)
-		return scanBeginObject
+		return s.pushParseState(parseObjectKey, scanBeginObject)
 	case '[':
 		s.step = stateBeginValueOrEmpty
-		s.pushParseState(parseArrayValue)
-		return scanBeginArray
+		return s.pushParseState(parseArrayValue, scanBeginArray)
 	case '"':
 		s.step = stateInString
+		s.stringStart = s.bytes
+		s.quote = c
 		return scanBeginLiteral
 	case '-':
 		s.step = stateNeg
 		return scanBeginLiteral
 	case '0': // beginning of 0.123
-		s.step = state0
+		s.step = s.zeroState()
 		return scanBeginLiteral
 	case 't': // beginning of true
 		s.step = stateT
@@ -235,6 +295,25 @@ func stateBeginValue(s *scanner, c byte) int {
 		s.step = state1
 		return scanBeginLiteral
 	}
+	if c == '\'' && s.allowSingleQuotes {
+		s.step = stateInString
+		s.stringStart = s.bytes
+		s.quote = c
+		return scanBeginLiteral
+	}
+	if s.allowExtendedNumbers {
+		switch c {
+		case '+':
+			s.step = stateNeg
+			return scanBeginLiteral
+		case '.': // beginning of .5
+			s.step = stateLeadingDot
+			return scanBeginLiteral
+		}
+	}
+	if c == '/' && s.allowComments {
+		return s.beginComment(stateBeginValue)
+	}
 	return s.error(c, "looking for beginning of value")
 }
 
@@ -248,6 +327,9 @@ func stateBeginStringOrEmpty(s *scanner, c byte) int {
 		s.parseState[n-1] = parseObjectValue
 		return stateEndValue(s, c)
 	}
+	if c == '/' && s.allowComments {
+		return s.beginComment(stateBeginStringOrEmpty)
+	}
 	return stateBeginString(s, c)
 }
 
@@ -256,13 +338,49 @@ func stateBeginString(s *scanner, c byte) int {
 	if c <= ' ' && isSpace(c) {
 		return scanSkipSpace
 	}
-	if c == '"' {
+	quoted := c == '"' || c == '\'' && s.allowSingleQuotes
+	if quoted || s.allowUnquotedKeys && isIdentifierStart(c) {
+		if s.maxObjectKeys > 0 {
+			n := len(s.keyCounts) - 1
+			s.keyCounts[n]++
+			if s.keyCounts[n] > s.maxObjectKeys {
+				return s.limitError("number of object keys", s.maxObjectKeys)
+			}
+		}
+		if !quoted {
+			s.step = stateInIdentifier
+			return scanBeginLiteral
+		}
 		s.step = stateInString
+		s.stringStart = s.bytes
+		s.quote = c
 		return scanBeginLiteral
 	}
+	if c == '/' && s.allowComments {
+		return s.beginComment(stateBeginString)
+	}
 	return s.error(c, "looking for beginning of object key string")
 }
 
+// isIdentifierStart reports whether c can begin an unquoted object key.
+func isIdentifierStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == '$'
+}
+
+// isIdentifierByte reports whether c can be part of an unquoted object key.
+func isIdentifierByte(c byte) bool {
+	return isIdentifierStart(c) || '0' <= c && c <= '9'
+}
+
+// stateInIdentifier is the state after reading the first byte
+// of an unquoted object key.
+func stateInIdentifier(s *scanner, c byte) int {
+	if isIdentifierByte(c) {
+		return scanContinue
+	}
+	return stateEndValue(s, c)
+}
+
 // stateEndValue is the state after completing a value,
 // such as after reading `{}` or `true` or `["x"`.
 func stateEndValue(s *scanner, c byte) int {
@@ -277,6 +395,9 @@ func stateEndValue(s *scanner, c byte) int {
 		s.step = stateEndValue
 		return scanSkipSpace
 	}
+	if c == '/' && s.allowComments {
+		return s.beginComment(stateEndValue)
+	}
 	ps := s.parseState[n-1]
 	switch ps {
 	case parseObjectKey:
@@ -289,7 +410,11 @@ func stateEndValue(s *scanner, c byte) int {
 	case parseObjectValue:
 		if c == ',' {
 			s.parseState[n-1] = parseObjectKey
-			s.step = stateBeginString
+			if s.allowTrailingCommas {
+				s.step = stateBeginStringOrEmpty
+			} else {
+				s.step = stateBeginString
+			}
 			return scanObjectValue
 		}
 		if c == '}' {
@@ -299,7 +424,11 @@ func stateEndValue(s *scanner, c byte) int {
 		return s.error(c, "after object key:value pair")
 	case parseArrayValue:
 		if c == ',' {
-			s.step = stateBeginValue
+			if s.allowTrailingCommas {
+				s.step = stateBeginValueOrEmpty
+			} else {
+				s.step = stateBeginValue
+			}
 			return scanArrayValue
 		}
 		if c == ']' {
@@ -315,6 +444,9 @@ func stateEndValue(s *scanner, c byte) int {
 // such as after reading `{}` or `[1,2,3]`.
 // Only space characters should be seen now.
 func stateEndTop(s *scanner, c byte) int {
+	if c == '/' && s.allowComments {
+		return s.beginComment(stateEndTop)
+	}
 	if !isSpace(c) {
 		// Complain about non-space byte on next call.
 		s.error(c, "after top-level value")
@@ -322,9 +454,81 @@ func stateEndTop(s *scanner, c byte) int {
 	return scanEnd
 }
 
-// stateInString is the state after reading `"`.
+// beginComment is called for a '/' byte where space is allowed.
+// The scanner returns to the step end after the comment.
+func (s *scanner) beginComment(end func(*scanner, byte) int) int {
+	s.commentEnd = end
+	s.step = stateBeginComment
+	s.inCommentNoEOF = true
+	return s.commentSpace()
+}
+
+// commentSpace is the result of scanning a byte of a comment:
+// comments are like space, including after the top-level value.
+func (s *scanner) commentSpace() int {
+	if s.endTop {
+		return scanEnd
+	}
+	return scanSkipSpace
+}
+
+// stateBeginComment is the state after reading `/` outside of a value.
+func stateBeginComment(s *scanner, c byte) int {
+	switch c {
+	case '/':
+		s.step = stateLineComment
+		s.inCommentNoEOF = false
+		return s.commentSpace()
+	case '*':
+		s.step = stateBlockComment
+		return s.commentSpace()
+	}
+	return s.error(c, "looking for beginning of comment")
+}
+
+// stateLineComment is the state after reading `//`.
+func stateLineComment(s *scanner, c byte) int {
+	if c == '\n' {
+		s.step = s.commentEnd
+	}
+	return s.commentSpace()
+}
+
+// stateBlockComment is the state after reading `/*`.
+func stateBlockComment(s *scanner, c byte) int {
+	if c == '*' {
+		s.step = stateBlockCommentStar
+	}
+	return s.commentSpace()
+}
+
+// stateBlockCommentStar is the state after reading `*` in a block comment.
+func stateBlockCommentStar(s *scanner, c byte) int {
+	switch c {
+	case '/':
+		s.step = s.commentEnd
+		s.inCommentNoEOF = false
+	case '*':
+	default:
+		s.step = stateBlockComment
+	}
+	return s.commentSpace()
+}
+
+// stateInString is the state after reading `"`, or `'` if single quotes
+// are allowed.
 func stateInString(s *scanner, c byte) int {
-	if c == '"' {
+	if s.maxStringLen > 0 {
+		// Length of the string so far, as it appears in the input.
+		n := s.bytes - s.stringStart
+		if c == s.quote {
+			n--
+		}
+		if n > int64(s.maxStringLen) {
+			return s.limitError("string length", s.maxStringLen)
+		}
+	}
+	if c == s.quote {
 		s.step = stateEndValue
 		return scanContinue
 	}
@@ -347,6 +551,11 @@ func stateInStringEsc(s *scanner, c byte) int {
 	case 'u':
 		s.step = stateInStringEscU
 		return scanContinue
+	case '\'':
+		if s.allowSingleQuotes {
+			s.step = stateInString
+			return scanContinue
+		}
 	}
 	return s.error(c, "in string escape code")
 }
@@ -391,19 +600,74 @@ func stateInStringEscU123(s *scanner, c byte) int {
 	return s.error(c, "in \\u hexadecimal character escape")
 }
 
-// stateNeg is the state after reading `-` during a number.
+// stateNeg is the state after reading `-`, or `+` if extended numbers
+// are allowed, during a number.
 func stateNeg(s *scanner, c byte) int {
 	if c == '0' {
-		s.step = state0
+		s.step = s.zeroState()
 		return scanContinue
 	}
 	if '1' <= c && c <= '9' {
 		s.step = state1
 		return scanContinue
 	}
+	if c == '.' && s.allowExtendedNumbers {
+		s.step = stateLeadingDot
+		return scanContinue
+	}
 	return s.error(c, "in numeric literal")
 }
 
+// zeroState returns the state after reading `0` at the start of a number.
+func (s *scanner) zeroState() func(*scanner, byte) int {
+	if s.allowExtendedNumbers {
+		return stateLeading0
+	}
+	return state0
+}
+
+// stateLeading0 is the state after reading `0` at the start of a number
+// if extended numbers are allowed, when it can be followed by x.
+func stateLeading0(s *scanner, c byte) int {
+	if c == 'x' || c == 'X' {
+		s.step = stateHex
+		return scanContinue
+	}
+	return state0(s, c)
+}
+
+// stateHex is the state after reading `0x` during a number.
+func stateHex(s *scanner, c byte) int {
+	if isHexDigit(c) {
+		s.step = stateHex0
+		return scanContinue
+	}
+	return s.error(c, "in hexadecimal numeric literal")
+}
+
+// stateHex0 is the state after reading `0x` and at least one hexadecimal
+// digit during a number, such as after reading `0x1F`.
+func stateHex0(s *scanner, c byte) int {
+	if isHexDigit(c) {
+		return scanContinue
+	}
+	return stateEndValue(s, c)
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// stateLeadingDot is the state after reading a decimal point without
+// an integer before it during a number, such as after reading `.` or `-.`.
+func stateLeadingDot(s *scanner, c byte) int {
+	if '0' <= c && c <= '9' {
+		s.step = stateDot0
+		return scanContinue
+	}
+	return s.error(c, "after decimal point in numeric literal")
+}
+
 // state1 is the state after reading a non-zero integer during a number,
 // such as after reading `1` or `100` but not `0`.
 func state1(s *scanner, c byte) int {
@@ -434,6 +698,10 @@ func stateDot(s *scanner, c byte) int {
 		s.step = stateDot0
 		return scanContinue
 	}
+	if s.allowExtendedNumbers {
+		// A trailing decimal point, such as in `5.`.
+		return stateDot0(s, c)
+	}
 	return s.error(c, "after decimal point in numeric literal")
 }
 
@@ -583,6 +851,13 @@ func (s *scanner) error(c byte, context string) int {
 	return scanError
 }
 
+// limitError records a LimitError and returns scanError.
+func (s *scanner) limitError(limit string, max int) int {
+	s.step = stateError
+	s.err = &LimitError{Limit: limit, Max: max, Offset: s.bytes}
+	return scanError
+}
+
 // quoteChar formats c as a quoted character literal
 func quoteChar(c byte) string {
 	// special cases - different from quoted strings
@@ -0,0 +1,106 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import "sort"
+
+// SortMapKeys causes the keys of maps, including sync.Maps, to be sorted
+// by their encoding, as written to the output, instead of by their
+// unescaped string values. This applies to all supported key types:
+// integer keys, such as those of a map[int]string, are sorted as the
+// strings they are encoded as, so 10 comes before 9, and keys
+// implementing encoding.TextMarshaler are sorted by their text.
+// Distinct keys with the same encoding, which TextMarshalers can produce,
+// are sorted by the encoding of their values, so that the output
+// doesn't depend on the iteration order of the map.
+// A comparison function set by MapKeyOrder is still applied first.
+// It returns a copy of the original JSON encoder/decoder, sharing its cache.
+func (j *JSON) SortMapKeys() *JSON {
+	j2 := *j
+	j2.sortMapKeys = true
+	return &j2
+}
+
+// SortMapKeys causes the keys of maps to be sorted by their encoding.
+// It returns a copy of the default JSON encoder/decoder, sharing its cache.
+func SortMapKeys() *JSON {
+	return defaultJSON.SortMapKeys()
+}
+
+// encodedKeySorter sorts the entries of a map by their encoded keys
+// for SortMapKeys.
+type encodedKeySorter struct {
+	scratch *encodeState
+	opts    encOpts
+	// keys are the unescaped keys and encoded their encodings.
+	keys    []string
+	encoded []string
+	// values holds the encodings of the values, computed when keys are equal.
+	values      []*string
+	encodeValue func(e *encodeState, i int)
+	swap        func(i, j int)
+}
+
+// sortEncodedKeys sorts the entries of a map, whose unescaped keys are keys,
+// and returns their encoded keys in the sorted order. keys is sorted too.
+// swap swaps two entries of the caller's slice of entries, which is kept
+// in the same order as keys, and encodeValue encodes the value of the entry
+// at index i of that slice.
+func sortEncodedKeys(e *encodeState, keys []string, opts encOpts, encodeValue func(e *encodeState, i int), swap func(i, j int)) []string {
+	scratch := newEncodeState()
+	defer freeEncodeState(scratch)
+	scratch.escapeSet = e.escapeSet
+	scratch.rejectInvalidUTF8 = e.rejectInvalidUTF8
+	scratch.ctx = e.ctx
+
+	s := &encodedKeySorter{
+		scratch:     scratch,
+		opts:        opts,
+		keys:        keys,
+		encoded:     make([]string, len(keys)),
+		values:      make([]*string, len(keys)),
+		encodeValue: encodeValue,
+		swap:        swap,
+	}
+	for i, k := range keys {
+		scratch.Reset()
+		scratch.string(k, opts.escapeHTML)
+		s.encoded[i] = scratch.String()
+	}
+	sort.Sort(s)
+	return s.encoded
+}
+
+func (s *encodedKeySorter) Len() int { return len(s.keys) }
+
+func (s *encodedKeySorter) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.encoded[i], s.encoded[j] = s.encoded[j], s.encoded[i]
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+	s.swap(i, j)
+}
+
+func (s *encodedKeySorter) Less(i, j int) bool {
+	if s.opts.mapKeyCompare != nil {
+		if c := s.opts.mapKeyCompare(s.keys[i], s.keys[j]); c != 0 {
+			return c < 0
+		}
+	}
+	if s.encoded[i] != s.encoded[j] {
+		return s.encoded[i] < s.encoded[j]
+	}
+	return s.value(i) < s.value(j)
+}
+
+// value returns the encoding of the value of the entry at index i.
+func (s *encodedKeySorter) value(i int) string {
+	if s.values[i] == nil {
+		s.scratch.Reset()
+		s.encodeValue(s.scratch, i)
+		v := s.scratch.String()
+		s.values[i] = &v
+	}
+	return *s.values[i]
+}
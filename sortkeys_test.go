@@ -0,0 +1,106 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// sortKey is a map key whose text is the same for all keys with the same name.
+type sortKey struct {
+	name string
+	id   int
+}
+
+func (k sortKey) MarshalText() ([]byte, error) {
+	return []byte("key-" + k.name), nil
+}
+
+func TestSortMapKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       interface{}
+		expected string
+	}{
+		{
+			name:     "int",
+			in:       map[int]string{1: "a", 2: "b", 10: "c", 9: "d", -1: "e"},
+			expected: `{"-1":"e","1":"a","10":"c","2":"b","9":"d"}`,
+		},
+		{
+			name:     "uint8",
+			in:       map[uint8]bool{200: true, 3: false, 30: true},
+			expected: `{"200":true,"3":false,"30":true}`,
+		},
+		{
+			name:     "TextMarshaler",
+			in:       map[sortKey]int{{"b", 1}: 1, {"a", 2}: 2, {"c", 3}: 3},
+			expected: `{"key-a":2,"key-b":1,"key-c":3}`,
+		},
+		{
+			name: "TextMarshaler with equal keys",
+			in: map[sortKey]int{
+				{"b", 1}: 4, {"b", 2}: 3, {"b", 3}: 2, {"b", 4}: 10, {"a", 5}: 1,
+			},
+			expected: `{"key-a":1,"key-b":10,"key-b":2,"key-b":3,"key-b":4}`,
+		},
+		{
+			name:     "escaped",
+			in:       map[string]int{"<": 1, "=": 2, "a": 3},
+			expected: `{"=":2,"\u003c":1,"a":3}`,
+		},
+	}
+	for _, tt := range tests {
+		// Repeat to catch a dependency on the map iteration order.
+		for n := 0; n < 20; n++ {
+			b, err := SortMapKeys().Marshal(tt.in)
+			if err != nil {
+				t.Fatalf("%s: Marshal: %v", tt.name, err)
+			}
+			if string(b) != tt.expected {
+				t.Fatalf("%s: have: %s, want: %s", tt.name, b, tt.expected)
+			}
+		}
+	}
+
+	// Without escaping, the order is the same as the default.
+	b, err := SortMapKeys().EscapeHTML(false).Marshal(map[string]int{"<": 1, "=": 2})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"<":1,"=":2}`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	// MapKeyOrder is applied first.
+	byLength := func(a, b string) int { return len(a) - len(b) }
+	b, err = SortMapKeys().MapKeyOrder(byLength).Marshal(map[int]int{100: 1, 9: 2, 10: 3, 8: 4})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"8":4,"9":2,"10":3,"100":1}`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+}
+
+func TestSortMapKeysSyncMap(t *testing.T) {
+	var m sync.Map
+	for i := 0; i < 12; i++ {
+		m.Store(i, fmt.Sprint(i))
+	}
+	m.Store(sortKey{"x", 1}, 2)
+	m.Store(sortKey{"x", 2}, 1)
+	b, err := SortMapKeys().Marshal(&m)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	expected := `{"0":"0","1":"1","10":"10","11":"11","2":"2","3":"3","4":"4",` +
+		`"5":"5","6":"6","7":"7","8":"8","9":"9","key-x":1,"key-x":2}`
+	if string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+}
@@ -6,8 +6,12 @@ package jsonx
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"strconv"
 )
 
 // A Decoder reads and decodes JSON values from an input stream.
@@ -17,8 +21,11 @@ type Decoder struct {
 	d       decodeState
 	scanp   int   // start of unread data in buf
 	scanned int64 // amount of data already scanned
+	minRead int   // minimum number of bytes to read at once
 	scan    scanner
 	err     error
+	tee     io.Writer // receives the consumed input, if set
+	teed    int64     // input offset up to which the input has been written to tee
 
 	tokenState int
 	tokenStack []int
@@ -35,10 +42,37 @@ func NewDecoder(r io.Reader) *Decoder {
 // The decoder introduces its own buffering and may
 // read data from r beyond the JSON values requested.
 func (c *JSON) NewDecoder(r io.Reader) *Decoder {
-	dec := &Decoder{r: r}
+	dec := &Decoder{r: r, minRead: defaultMinRead}
+	if c.decoderBufferSize > 0 {
+		dec.minRead = c.decoderBufferSize
+	}
+	dec.scan.maxDepth = c.maxDepth
+	dec.scan.maxStringLen = c.maxStringLen
+	dec.scan.maxObjectKeys = c.maxObjectKeys
+	dec.scan.allowTrailingCommas = c.allowTrailingCommas
+	dec.d.scan.allowTrailingCommas = c.allowTrailingCommas
+	dec.scan.allowComments = c.allowComments
+	dec.d.scan.allowComments = c.allowComments
+	dec.scan.allowSingleQuotes = c.allowSingleQuotes
+	dec.d.scan.allowSingleQuotes = c.allowSingleQuotes
+	dec.scan.allowUnquotedKeys = c.allowUnquotedKeys
+	dec.d.scan.allowUnquotedKeys = c.allowUnquotedKeys
+	dec.scan.allowExtendedNumbers = c.allowExtendedNumbers
+	dec.d.scan.allowExtendedNumbers = c.allowExtendedNumbers
 	dec.d.converter = c
 	dec.d.useNumber = c.useNumber
+	dec.d.numberType = c.numberType
+	dec.d.decimalMode = c.decimalMode
 	dec.d.disallowUnknownFields = c.disallowUnknownFields
+	dec.d.caseSensitive = c.caseSensitive
+	dec.d.scalarOrArray = c.scalarOrArray
+	dec.d.coerceScalars = c.coerceScalars
+	dec.d.autoUnquoteNumbers = c.autoUnquoteNumbers
+	dec.d.lenientNumbers = c.lenientNumbers
+	dec.d.strictFloat32 = c.strictFloat32
+	dec.d.disallowDuplicateKeys = c.disallowDuplicateKeys
+	dec.d.mergeDecode = c.mergeDecode
+	dec.d.replaceDecode = c.replaceDecode
 	return dec
 }
 
@@ -85,6 +119,83 @@ func (dec *Decoder) Decode(v interface{}) error {
 	// fixup token streaming state
 	dec.tokenValueEnd()
 
+	if teeErr := dec.flushTee(); err == nil {
+		err = teeErr
+	}
+	return err
+}
+
+// Tee causes the Decoder to write the input it consumes to w,
+// such as for logging exactly what was parsed.
+// Only consumed input is written: when Decode or Token returns,
+// w has received the input up to InputOffset, including white space,
+// commas and colons, but not the data read ahead into the buffer
+// (see Buffered). Input consumed before Tee is called is not written.
+// Calling Tee with a nil w stops copying.
+//
+// If writing to w fails, the error is returned by Decode or Token,
+// or by the next call that reads from the underlying reader,
+// and the input that failed to be written is not retried.
+func (dec *Decoder) Tee(w io.Writer) {
+	dec.tee = w
+	dec.teed = dec.InputOffset()
+}
+
+// flushTee writes the input consumed since the last call to the tee writer.
+func (dec *Decoder) flushTee() error {
+	if dec.tee == nil {
+		return nil
+	}
+	start := int(dec.teed - dec.scanned)
+	if start >= dec.scanp {
+		return nil
+	}
+	dec.teed = dec.InputOffset()
+	_, err := dec.tee.Write(dec.buf[start:dec.scanp])
+	return err
+}
+
+// DecodeArray reads a JSON array from the input and calls fn once for each
+// of its elements. fn is passed a decode function, which decodes the
+// current element into the value pointed to by its argument, like Decode.
+// If fn does not call decode, the element is skipped.
+//
+// If fn returns an error, DecodeArray stops and returns that error,
+// leaving the remaining elements in the input. They can be read
+// by calling Decode or Token, or by calling DecodeArray again
+// after reading the opening bracket with Token.
+// If the array has already been opened with Token, DecodeArray
+// continues with its next element.
+func (dec *Decoder) DecodeArray(fn func(decode func(interface{}) error) error) error {
+	if dec.tokenState != tokenArrayStart && dec.tokenState != tokenArrayComma {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok != json.Delim('[') {
+			return fmt.Errorf("json: cannot decode %v as array", tok)
+		}
+	}
+	for dec.More() {
+		decoded := false
+		decode := func(v interface{}) error {
+			if decoded {
+				return errors.New("json: array element already decoded")
+			}
+			decoded = true
+			return dec.Decode(v)
+		}
+		if err := fn(decode); err != nil {
+			return err
+		}
+		if !decoded {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := dec.Token()
 	return err
 }
 
@@ -138,7 +249,7 @@ Input:
 				if dec.scan.step(&dec.scan, ' ') == scanEnd {
 					break Input
 				}
-				if nonSpace(dec.buf) {
+				if nonSpace(dec.buf) && !(dec.scan.allowComments && onlyComments(dec.buf[dec.scanp:])) {
 					err = io.ErrUnexpectedEOF
 				}
 			}
@@ -153,9 +264,17 @@ Input:
 	return scanp - dec.scanp, nil
 }
 
+// defaultMinRead is the default minimum number of bytes
+// a Decoder reads from its input at once.
+const defaultMinRead = 512
+
 func (dec *Decoder) refill() error {
 	// Make room to read more into the buffer.
-	// First slide down data already consumed.
+	// First slide down data already consumed,
+	// after passing it on to the tee writer.
+	if err := dec.flushTee(); err != nil {
+		return err
+	}
 	if dec.scanp > 0 {
 		dec.scanned += int64(dec.scanp)
 		n := copy(dec.buf, dec.buf[dec.scanp:])
@@ -164,9 +283,8 @@ func (dec *Decoder) refill() error {
 	}
 
 	// Grow buffer if not large enough.
-	const minRead = 512
-	if cap(dec.buf)-len(dec.buf) < minRead {
-		newBuf := make([]byte, len(dec.buf), 2*cap(dec.buf)+minRead)
+	if cap(dec.buf)-len(dec.buf) < dec.minRead {
+		newBuf := make([]byte, len(dec.buf), 2*cap(dec.buf)+dec.minRead)
 		copy(newBuf, dec.buf)
 		dec.buf = newBuf
 	}
@@ -187,6 +305,42 @@ func nonSpace(b []byte) bool {
 	return false
 }
 
+// onlyComments reports whether b consists of space and complete comments.
+func onlyComments(b []byte) bool {
+	scan := scanner{allowComments: true}
+	scan.reset()
+	for _, c := range b {
+		if scan.step(&scan, c) != scanSkipSpace {
+			return false
+		}
+	}
+	return !scan.inCommentNoEOF
+}
+
+// commentLen returns the length of the comment at the start of b,
+// 0 if b ends before the end of the comment, or -1 if b doesn't start
+// with a comment. A line comment ends with a newline.
+func commentLen(b []byte) int {
+	if len(b) < 2 {
+		return 0
+	}
+	switch {
+	case b[0] != '/':
+		return -1
+	case b[1] == '/':
+		if i := bytes.IndexByte(b[2:], '\n'); i >= 0 {
+			return i + 3
+		}
+		return 0
+	case b[1] == '*':
+		if i := bytes.Index(b[2:], []byte("*/")); i >= 0 {
+			return i + 4
+		}
+		return 0
+	}
+	return -1
+}
+
 // An Encoder writes JSON values to an output stream.
 type Encoder struct {
 	w          io.Writer
@@ -197,6 +351,10 @@ type Encoder struct {
 	indentBuf    *bytes.Buffer
 	indentPrefix string
 	indentValue  string
+
+	flushEvery int  // flush w after this many values, if positive
+	unflushed  int  // values written since the last flush
+	noNewline  bool // don't terminate values with a newline
 }
 
 // NewEncoder returns a new encoder that writes to w
@@ -206,12 +364,21 @@ func NewEncoder(w io.Writer) *Encoder {
 }
 
 // NewEncoder returns a new encoder that writes to w.
+// The encoder encodes values with the options of c, like Marshal,
+// such as OmitEmpty and FloatFormat. SetEscapeHTML and SetIndent
+// override the corresponding options for this encoder only.
 func (c *JSON) NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{w: w, escapeHTML: !c.dontEscapeHTML, converter: c}
+	return &Encoder{
+		w:            w,
+		escapeHTML:   !c.dontEscapeHTML,
+		converter:    c,
+		indentPrefix: c.indentPrefix,
+		indentValue:  c.indentValue,
+	}
 }
 
 // Encode writes the JSON encoding of v to the stream,
-// followed by a newline character.
+// followed by a newline character, unless disabled with SetNewline.
 //
 // See the documentation for Marshal for details about the
 // conversion of Go values to JSON.
@@ -220,7 +387,12 @@ func (enc *Encoder) Encode(v interface{}) error {
 		return enc.err
 	}
 	e := newEncodeState()
-	err := enc.converter.marshal(e, v, encOpts{escapeHTML: enc.escapeHTML})
+	defer freeEncodeState(e)
+	opts := enc.converter.encOpts()
+	opts.escapeHTML = enc.escapeHTML
+	opts.indentPrefix = enc.indentPrefix
+	opts.indentValue = enc.indentValue
+	err := enc.converter.marshal(e, v, opts)
 	if err != nil {
 		return err
 	}
@@ -231,7 +403,9 @@ func (enc *Encoder) Encode(v interface{}) error {
 	// is required if the encoded value was a number,
 	// so that the reader knows there aren't more
 	// digits coming.
-	e.WriteByte('\n')
+	if !enc.noNewline {
+		e.WriteByte('\n')
+	}
 
 	b := e.Bytes()
 	if enc.indentPrefix != "" || enc.indentValue != "" {
@@ -247,19 +421,263 @@ func (enc *Encoder) Encode(v interface{}) error {
 	}
 	if _, err = enc.w.Write(b); err != nil {
 		enc.err = err
+		return err
+	}
+	enc.unflushed++
+	if enc.flushEvery > 0 && enc.unflushed >= enc.flushEvery {
+		return enc.Flush()
+	}
+	return nil
+}
+
+// EncodeMany writes the JSON encoding of each value in vs to the stream,
+// each followed by a newline character unless disabled with SetNewline,
+// just like calling Encode for each value.
+// The values are encoded into a single buffer, which is written to the
+// underlying writer at once.
+//
+// If a value cannot be encoded, EncodeMany returns an *EncodeManyError
+// identifying it, and nothing is written to the stream.
+func (enc *Encoder) EncodeMany(vs ...interface{}) error {
+	if enc.err != nil {
+		return enc.err
+	}
+	e := newEncodeState()
+	defer freeEncodeState(e)
+	opts := enc.converter.encOpts()
+	opts.escapeHTML = enc.escapeHTML
+	opts.indentPrefix = enc.indentPrefix
+	opts.indentValue = enc.indentValue
+	indent := enc.indentPrefix != "" || enc.indentValue != ""
+	if indent {
+		if enc.indentBuf == nil {
+			enc.indentBuf = new(bytes.Buffer)
+		}
+		enc.indentBuf.Reset()
+	}
+	for i, v := range vs {
+		start := e.Len()
+		if err := enc.converter.marshal(e, v, opts); err != nil {
+			return &EncodeManyError{Index: i, Err: err}
+		}
+		if !enc.noNewline {
+			e.WriteByte('\n')
+		}
+		if indent {
+			// Values are indented one by one, since Indent
+			// only accepts a single top-level value.
+			if err := json.Indent(enc.indentBuf, e.Bytes()[start:], enc.indentPrefix, enc.indentValue); err != nil {
+				return &EncodeManyError{Index: i, Err: err}
+			}
+		}
+	}
+
+	b := e.Bytes()
+	if indent {
+		b = enc.indentBuf.Bytes()
+	}
+	if _, err := enc.w.Write(b); err != nil {
+		enc.err = err
+		return err
+	}
+	enc.unflushed += len(vs)
+	if enc.flushEvery > 0 && enc.unflushed >= enc.flushEvery {
+		return enc.Flush()
+	}
+	return nil
+}
+
+// An EncodeManyError is returned by Encoder.EncodeMany
+// when one of the values cannot be encoded.
+type EncodeManyError struct {
+	Index int   // index of the value in the arguments of EncodeMany
+	Err   error // error returned while encoding the value
+}
+
+func (e *EncodeManyError) Error() string {
+	return "json: encoding value " + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *EncodeManyError) Unwrap() error {
+	return e.Err
+}
+
+// FlushEvery instructs the encoder to call Flush after every n values
+// written by Encode. This is useful when the underlying writer is buffered,
+// such as a *bufio.Writer wrapping a network connection.
+// Calling FlushEvery(0) disables automatic flushing.
+func (enc *Encoder) FlushEvery(n int) {
+	enc.flushEvery = n
+}
+
+// Flush flushes the underlying writer if it has a Flush method,
+// such as a *bufio.Writer or an http.Flusher. Otherwise it does nothing.
+// An error returned by the writer's Flush method is returned by
+// all subsequent calls to Encode.
+func (enc *Encoder) Flush() error {
+	if enc.err != nil {
+		return enc.err
+	}
+	enc.unflushed = 0
+	if err := flushWriter(enc.w); err != nil {
+		enc.err = err
+		return err
+	}
+	return nil
+}
+
+// flushWriter calls w's Flush method, if it has one.
+func flushWriter(w io.Writer) error {
+	switch f := w.(type) {
+	case interface{ Flush() error }:
+		return f.Flush()
+	case interface{ Flush() }:
+		f.Flush()
+	}
+	return nil
+}
+
+// MarshalStream writes the JSON encoding of each value received from values
+// to w as soon as it arrives, and returns when values is closed.
+// If lineDelimited is false, the values are written as the elements of
+// a JSON array, which is terminated when values is closed; otherwise they
+// are written as newline-delimited JSON, like a LineDelimitedEncoder.
+// Either way, the output is followed by a newline character, and w is
+// flushed after each value if it has a Flush method.
+// Indentation configured on c is ignored.
+//
+// If a value cannot be encoded or w returns an error, MarshalStream stops
+// writing, without terminating the array, but it keeps receiving and
+// discarding values until values is closed, so that the sender doesn't
+// block forever. Then it returns the error.
+func (c *JSON) MarshalStream(w io.Writer, values <-chan interface{}, lineDelimited bool) error {
+	err := c.marshalStream(w, values, lineDelimited)
+	if err != nil {
+		for range values {
+		}
 	}
-	encodeStatePool.Put(e)
 	return err
 }
 
+func (c *JSON) marshalStream(w io.Writer, values <-chan interface{}, lineDelimited bool) error {
+	if lineDelimited {
+		enc := c.NewLineDelimitedEncoder(w)
+		for v := range values {
+			if err := enc.Encode(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	c = c.Indent("", "")
+	buf := []byte{'['}
+	for v := range values {
+		var err error
+		if buf, err = c.MarshalAppend(buf, v); err != nil {
+			return err
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		if err := flushWriter(w); err != nil {
+			return err
+		}
+		buf = append(buf[:0], ',')
+	}
+	if buf[0] == '[' {
+		// No values were received.
+		buf = append(buf, ']', '\n')
+	} else {
+		buf = append(buf[:0], ']', '\n')
+	}
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	return flushWriter(w)
+}
+
+// MarshalStream writes the JSON encoding of each value received from values to w
+// using the default JSON encoder, as a JSON array or as newline-delimited JSON.
+func MarshalStream(w io.Writer, values <-chan interface{}, lineDelimited bool) error {
+	return defaultJSON.MarshalStream(w, values, lineDelimited)
+}
+
+// DecodeToChannel reads a JSON array from r and sends the raw encoding
+// of each of its elements to ch, without decoding them.
+// ch is closed when DecodeToChannel returns, either at the end of the array
+// or because of an error.
+func (c *JSON) DecodeToChannel(r io.Reader, ch chan<- json.RawMessage) error {
+	return c.decodeToChannel(nil, r, ch)
+}
+
+// DecodeToChannel reads a JSON array from r using the default JSON decoder
+// and sends the raw encoding of each of its elements to ch.
+func DecodeToChannel(r io.Reader, ch chan<- json.RawMessage) error {
+	return defaultJSON.DecodeToChannel(r, ch)
+}
+
+// DecodeToChannelContext is like DecodeToChannel, but stops and returns
+// ctx.Err() if ctx is cancelled before the whole array is read,
+// including while it is waiting to send an element to ch.
+func (c *JSON) DecodeToChannelContext(ctx context.Context, r io.Reader, ch chan<- json.RawMessage) error {
+	return c.decodeToChannel(ctx, r, ch)
+}
+
+// DecodeToChannelContext is like DecodeToChannel, but stops and returns
+// ctx.Err() if ctx is cancelled before the whole array is read.
+func DecodeToChannelContext(ctx context.Context, r io.Reader, ch chan<- json.RawMessage) error {
+	return defaultJSON.DecodeToChannelContext(ctx, r, ch)
+}
+
+// decodeToChannel implements DecodeToChannel and DecodeToChannelContext.
+// ctx may be nil.
+func (c *JSON) decodeToChannel(ctx context.Context, r io.Reader, ch chan<- json.RawMessage) error {
+	defer close(ch)
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	dec := c.NewDecoder(r)
+	return dec.DecodeArray(func(decode func(interface{}) error) error {
+		if ctx != nil {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		var raw json.RawMessage
+		if err := decode(&raw); err != nil {
+			return err
+		}
+		select {
+		case ch <- raw:
+			return nil
+		case <-done:
+			return ctx.Err()
+		}
+	})
+}
+
 // SetIndent instructs the encoder to format each subsequent encoded
 // value as if indented by the package-level function Indent(dst, src, prefix, indent).
 // Calling SetIndent("", "") disables indentation.
+// It overrides the indentation configured with JSON.Indent
+// for this Encoder only.
 func (enc *Encoder) SetIndent(prefix, indent string) {
 	enc.indentPrefix = prefix
 	enc.indentValue = indent
 }
 
+// SetNewline specifies whether Encode and EncodeMany terminate each value
+// with a newline character, which is the default.
+// SetNewline(false) leaves it to the caller to write delimiters between
+// the values. Note that some kind of delimiter is required between
+// numbers, so that a reader knows where one ends.
+func (enc *Encoder) SetNewline(on bool) {
+	enc.noNewline = !on
+}
+
 // SetEscapeHTML specifies whether problematic HTML characters
 // should be escaped inside JSON quoted strings.
 // The default behavior is to escape &, <, and > to \u0026, \u003c, and \u003e
@@ -267,6 +685,10 @@ func (enc *Encoder) SetIndent(prefix, indent string) {
 //
 // In non-HTML settings where the escaping interferes with the readability
 // of the output, SetEscapeHTML(false) disables this behavior.
+//
+// The initial setting is taken from the JSON encoder/decoder that created
+// the Encoder (see JSON.EscapeHTML), and SetEscapeHTML overrides it
+// for this Encoder only. Runes added with EscapeSet are escaped either way.
 func (enc *Encoder) SetEscapeHTML(on bool) {
 	enc.escapeHTML = on
 }
@@ -353,6 +775,15 @@ func (dec *Decoder) tokenValueEnd() {
 // to mark the start and end of arrays and objects.
 // Commas and colons are elided.
 func (dec *Decoder) Token() (json.Token, error) {
+	tok, err := dec.token()
+	if teeErr := dec.flushTee(); err == nil && teeErr != nil {
+		return nil, teeErr
+	}
+	return tok, err
+}
+
+// token implements Token.
+func (dec *Decoder) token() (json.Token, error) {
 	for {
 		c, err := dec.peek()
 		if err != nil {
@@ -369,7 +800,8 @@ func (dec *Decoder) Token() (json.Token, error) {
 			return json.Delim('['), nil
 
 		case ']':
-			if dec.tokenState != tokenArrayStart && dec.tokenState != tokenArrayComma {
+			if dec.tokenState != tokenArrayStart && dec.tokenState != tokenArrayComma &&
+				!(dec.scan.allowTrailingCommas && dec.tokenState == tokenArrayValue) {
 				return dec.tokenError(c)
 			}
 			dec.scanp++
@@ -388,7 +820,8 @@ func (dec *Decoder) Token() (json.Token, error) {
 			return json.Delim('{'), nil
 
 		case '}':
-			if dec.tokenState != tokenObjectStart && dec.tokenState != tokenObjectComma {
+			if dec.tokenState != tokenObjectStart && dec.tokenState != tokenObjectComma &&
+				!(dec.scan.allowTrailingCommas && dec.tokenState == tokenObjectKey) {
 				return dec.tokenError(c)
 			}
 			dec.scanp++
@@ -418,8 +851,8 @@ func (dec *Decoder) Token() (json.Token, error) {
 			}
 			return dec.tokenError(c)
 
-		case '"':
-			if dec.tokenState == tokenObjectStart || dec.tokenState == tokenObjectKey {
+		case '"', '\'':
+			if (c == '"' || dec.scan.allowSingleQuotes) && (dec.tokenState == tokenObjectStart || dec.tokenState == tokenObjectKey) {
 				var x string
 				old := dec.tokenState
 				dec.tokenState = tokenTopValue
@@ -434,6 +867,14 @@ func (dec *Decoder) Token() (json.Token, error) {
 			fallthrough
 
 		default:
+			if dec.scan.allowUnquotedKeys && isIdentifierStart(c) && (dec.tokenState == tokenObjectStart || dec.tokenState == tokenObjectKey) {
+				x, err := dec.readIdentifier()
+				if err != nil {
+					return nil, err
+				}
+				dec.tokenState = tokenObjectColon
+				return x, nil
+			}
 			if !dec.tokenValueAllowed() {
 				return dec.tokenError(c)
 			}
@@ -446,6 +887,27 @@ func (dec *Decoder) Token() (json.Token, error) {
 	}
 }
 
+// readIdentifier reads the unquoted object key at dec.scanp.
+func (dec *Decoder) readIdentifier() (string, error) {
+	var err error
+	for {
+		for i := dec.scanp + 1; i < len(dec.buf); i++ {
+			if !isIdentifierByte(dec.buf[i]) {
+				x := string(dec.buf[dec.scanp:i])
+				dec.scanp = i
+				return x, nil
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		err = dec.refill()
+	}
+}
+
 func (dec *Decoder) tokenError(c byte) (json.Token, error) {
 	var context string
 	switch dec.tokenState {
@@ -469,6 +931,19 @@ func (dec *Decoder) tokenError(c byte) (json.Token, error) {
 // current array or object being parsed.
 func (dec *Decoder) More() bool {
 	c, err := dec.peek()
+	if err == nil && c == ',' && dec.scan.allowTrailingCommas {
+		// Skip the comma to see whether it is a trailing one.
+		switch dec.tokenState {
+		case tokenArrayComma:
+			dec.scanp++
+			dec.tokenState = tokenArrayValue
+			c, err = dec.peek()
+		case tokenObjectComma:
+			dec.scanp++
+			dec.tokenState = tokenObjectKey
+			c, err = dec.peek()
+		}
+	}
 	return err == nil && c != ']' && c != '}'
 }
 
@@ -480,11 +955,25 @@ func (dec *Decoder) peek() (byte, error) {
 			if isSpace(c) {
 				continue
 			}
+			if c == '/' && dec.scan.allowComments {
+				if n := commentLen(dec.buf[i:]); n > 0 {
+					i += n - 1
+					continue
+				} else if n == 0 {
+					// Read the rest of the comment.
+					dec.scanp = i
+					break
+				}
+			}
 			dec.scanp = i
 			return c, nil
 		}
 		// buffer has been scanned, now report any error
 		if err != nil {
+			if err == io.EOF && dec.scanp < len(dec.buf) && !onlyComments(dec.buf[dec.scanp:]) {
+				// An unterminated block comment, or a lone '/'.
+				err = io.ErrUnexpectedEOF
+			}
 			return 0, err
 		}
 		err = dec.refill()
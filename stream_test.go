@@ -6,7 +6,10 @@ package jsonx
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
@@ -16,6 +19,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 // Test values for the stream test.
@@ -91,6 +95,69 @@ func TestEncoderIndent(t *testing.T) {
 	}
 }
 
+func TestEncoderSetNewline(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetNewline(false)
+	if err := enc.Encode(map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	buf.WriteByte(',')
+	if err := enc.EncodeMany([]int{1}, "x"); err != nil {
+		t.Fatalf("EncodeMany: %v", err)
+	}
+	if have, want := buf.String(), `{"a":1},[1]"x"`; have != want {
+		t.Errorf("have: %q, want: %q", have, want)
+	}
+
+	buf.Reset()
+	enc.SetIndent("", "\t")
+	if err := enc.Encode([]int{1}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	enc.SetNewline(true)
+	if err := enc.Encode(2); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if have, want := buf.String(), "[\n\t1\n]2\n"; have != want {
+		t.Errorf("have: %q, want: %q", have, want)
+	}
+}
+
+func TestEncoderSetIndentOverride(t *testing.T) {
+	c := New().Indent("", "\t")
+	v := map[string][]int{"a": {1}}
+
+	var buf bytes.Buffer
+	enc := c.NewEncoder(&buf)
+	if err := enc.Encode(v); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	enc.SetIndent(">", " ")
+	if err := enc.Encode(v); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	enc.SetIndent("", "")
+	if err := enc.Encode(v); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	want := "{\n\t\"a\": [\n\t\t1\n\t]\n}\n" +
+		"{\n> \"a\": [\n>  1\n> ]\n>}\n" +
+		"{\"a\":[1]}\n"
+	if have := buf.String(); have != want {
+		t.Errorf("have: %q\nwant: %q", have, want)
+	}
+
+	// The JSON encoder/decoder is not affected.
+	b, err := c.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if want := "{\n\t\"a\": [\n\t\t1\n\t]\n}"; string(b) != want {
+		t.Errorf("have: %q, want: %q", b, want)
+	}
+}
+
 type strMarshaler string
 
 func (s strMarshaler) MarshalJSON() ([]byte, error) {
@@ -169,6 +236,350 @@ func TestEncoderSetEscapeHTML(t *testing.T) {
 	}
 }
 
+func TestEncoderSetEscapeHTMLOverride(t *testing.T) {
+	const v = "<&>"
+	for _, tt := range []struct {
+		json *JSON
+		on   bool
+		want string
+	}{
+		{New(), false, `"<&>"`},
+		{New().EscapeHTML(false), true, `"\u003c\u0026\u003e"`},
+		{New().EscapeHTML(false), false, `"<&>"`},
+		{New().EscapeHTML(false).EscapeSet('&'), true, `"\u003c\u0026\u003e"`},
+		{New().EscapeSet('&'), false, `"<\u0026>"`},
+	} {
+		var buf bytes.Buffer
+		enc := tt.json.NewEncoder(&buf)
+		enc.SetEscapeHTML(!tt.on)
+		enc.SetEscapeHTML(tt.on)
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		if got := strings.TrimSpace(buf.String()); got != tt.want {
+			t.Errorf("SetEscapeHTML(%v): have %#q, want %#q", tt.on, got, tt.want)
+		}
+
+		// The JSON encoder/decoder is not affected.
+		b, err := tt.json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+		enc2 := tt.json.NewEncoder(&buf)
+		buf.Reset()
+		if err := enc2.Encode(v); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		if got := strings.TrimSpace(buf.String()); got != string(b) {
+			t.Errorf("new Encoder: have %#q, want %#q", got, b)
+		}
+	}
+}
+
+func TestEncoderOptions(t *testing.T) {
+	type T struct {
+		A string  `json:"a"`
+		F float64 `json:"f"`
+	}
+	v := T{F: 1e21}
+	j := New().OmitEmpty().FloatFormat(FloatModeInteger)
+	b, err := j.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"f":1000000000000000000000}`; string(b) != expected {
+		t.Errorf("Marshal: have %s, want %s", b, expected)
+	}
+
+	// The Encoder uses the same options as Marshal.
+	var buf bytes.Buffer
+	if err := j.NewEncoder(&buf).Encode(v); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != string(b) {
+		t.Errorf("Encode: have %s, want %s", got, b)
+	}
+}
+
+// flushCounter is a writer that counts calls to Flush.
+type flushCounter struct {
+	bytes.Buffer
+	flushes int
+	err     error
+}
+
+func (w *flushCounter) Flush() error {
+	w.flushes++
+	return w.err
+}
+
+func TestEncoderFlushEvery(t *testing.T) {
+	var w flushCounter
+	enc := NewEncoder(&w)
+	enc.FlushEvery(3)
+	for i := 1; i <= 10; i++ {
+		if err := enc.Encode(i); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		if want := i / 3; w.flushes != want {
+			t.Errorf("after %d values: have %d flushes, want %d", i, w.flushes, want)
+		}
+	}
+
+	// An explicit Flush restarts the count.
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if w.flushes != 4 {
+		t.Errorf("have %d flushes, want 4", w.flushes)
+	}
+	enc.Encode(11)
+	enc.Encode(12)
+	if w.flushes != 4 {
+		t.Errorf("have %d flushes, want 4", w.flushes)
+	}
+	enc.Encode(13)
+	if w.flushes != 5 {
+		t.Errorf("have %d flushes, want 5", w.flushes)
+	}
+
+	enc.FlushEvery(0)
+	for i := 0; i < 5; i++ {
+		enc.Encode(i)
+	}
+	if w.flushes != 5 {
+		t.Errorf("FlushEvery(0): have %d flushes, want 5", w.flushes)
+	}
+
+	t.Run("error", func(t *testing.T) {
+		w := flushCounter{err: errors.New("flush failed")}
+		enc := NewEncoder(&w)
+		enc.FlushEvery(1)
+		if err := enc.Encode(1); err != w.err {
+			t.Errorf("have: %v, want: %v", err, w.err)
+		}
+		if err := enc.Encode(2); err != w.err {
+			t.Errorf("have: %v, want: %v", err, w.err)
+		}
+		if w.String() != "1\n" || w.flushes != 1 {
+			t.Errorf("have %q after %d flushes, want %q after 1", w.String(), w.flushes, "1\n")
+		}
+	})
+}
+
+func TestEncoderEncodeMany(t *testing.T) {
+	type point struct {
+		X, Y int
+		Tag  string `json:",omitempty"`
+	}
+	vs := []interface{}{
+		point{1, 2, "<a>"},
+		42,
+		"hello",
+		nil,
+		[]interface{}{true, 1.5, point{}},
+		map[string]int{"b": 2, "a": 1},
+	}
+	for _, indent := range []string{"", "\t"} {
+		var want, got bytes.Buffer
+		enc := NewEncoder(&want)
+		enc.SetIndent("", indent)
+		for _, v := range vs {
+			if err := enc.Encode(v); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+		}
+		enc = NewEncoder(&got)
+		enc.SetIndent("", indent)
+		if err := enc.EncodeMany(vs...); err != nil {
+			t.Fatalf("EncodeMany: %v", err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("indent %q:\nhave: %q\nwant: %q", indent, got.String(), want.String())
+		}
+	}
+
+	t.Run("error", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := NewEncoder(&buf).EncodeMany(1, "two", make(chan int), 4)
+		me, ok := err.(*EncodeManyError)
+		if !ok {
+			t.Fatalf("have: %v, want EncodeManyError", err)
+		}
+		if me.Index != 2 {
+			t.Errorf("have index %d, want 2", me.Index)
+		}
+		if _, ok := me.Unwrap().(*json.UnsupportedTypeError); !ok {
+			t.Errorf("have: %v, want UnsupportedTypeError", me.Err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("have output %q, want none", buf.String())
+		}
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		var w flushCounter
+		enc := NewEncoder(&w)
+		enc.FlushEvery(3)
+		enc.EncodeMany(1, 2)
+		if w.flushes != 0 {
+			t.Errorf("have %d flushes, want 0", w.flushes)
+		}
+		enc.EncodeMany(3, 4)
+		if w.flushes != 1 {
+			t.Errorf("have %d flushes, want 1", w.flushes)
+		}
+	})
+}
+
+// chanWriter sends everything written to it on the channel.
+type chanWriter chan string
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestMarshalStream(t *testing.T) {
+	send := func(vs ...interface{}) <-chan interface{} {
+		ch := make(chan interface{})
+		go func() {
+			for _, v := range vs {
+				ch <- v
+			}
+			close(ch)
+		}()
+		return ch
+	}
+	values := []interface{}{map[string]int{"a": 1}, "x", nil, []int{1, 2}}
+
+	tests := []struct {
+		lineDelimited bool
+		values        []interface{}
+		expected      string
+	}{
+		{false, values, `[{"a":1},"x",null,[1,2]]` + "\n"},
+		{false, nil, "[]\n"},
+		{true, values, "{\"a\":1}\n\"x\"\nnull\n[1,2]\n"},
+		{true, nil, ""},
+	}
+	for _, tt := range tests {
+		var w flushCounter
+		if err := Indent("", "\t").MarshalStream(&w, send(tt.values...), tt.lineDelimited); err != nil {
+			t.Fatalf("MarshalStream: %v", err)
+		}
+		if w.String() != tt.expected {
+			t.Errorf("lineDelimited %v: have: %q, want: %q", tt.lineDelimited, w.String(), tt.expected)
+		}
+		if !tt.lineDelimited {
+			var out []interface{}
+			if err := Unmarshal(w.Bytes(), &out); err != nil {
+				t.Errorf("output is not a valid array: %v", err)
+			}
+			if w.flushes != len(tt.values)+1 {
+				t.Errorf("have %d flushes, want %d", w.flushes, len(tt.values)+1)
+			}
+		}
+	}
+
+	t.Run("values are written as they arrive", func(t *testing.T) {
+		ch := make(chan interface{})
+		w := chanWriter(make(chan string))
+		done := make(chan error)
+		go func() {
+			done <- MarshalStream(w, ch, false)
+		}()
+		for i, expected := range []string{"[1", ",2", ",3"} {
+			ch <- i + 1
+			if have := <-w; have != expected {
+				t.Errorf("have: %q, want: %q", have, expected)
+			}
+		}
+		close(ch)
+		if have := <-w; have != "]\n" {
+			t.Errorf("have: %q, want: %q", have, "]\n")
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("MarshalStream: %v", err)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var w flushCounter
+		ch := send(1, make(chan int), 3, 4)
+		err := MarshalStream(&w, ch, false)
+		if _, ok := err.(*json.UnsupportedTypeError); !ok {
+			t.Errorf("have: %v, want UnsupportedTypeError", err)
+		}
+		if w.String() != "[1" {
+			t.Errorf("have: %q, want: %q", w.String(), "[1")
+		}
+		// The remaining values are discarded, so the sender isn't blocked.
+		if v, ok := <-ch; ok {
+			t.Errorf("values not drained, received: %v", v)
+		}
+	})
+}
+
+func TestDecodeToChannel(t *testing.T) {
+	const n = 100000
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, `{"i":%d}`, i)
+	}
+	buf.WriteString("]")
+
+	ch := make(chan json.RawMessage, 16)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- DecodeToChannel(&buf, ch)
+	}()
+	count := 0
+	for raw := range ch {
+		if expected := fmt.Sprintf(`{"i":%d}`, count); string(raw) != expected {
+			t.Fatalf("#%d: have: %s, want: %s", count, raw, expected)
+		}
+		count++
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("DecodeToChannel: %v", err)
+	}
+	if count != n {
+		t.Errorf("have %d elements, want %d", count, n)
+	}
+
+	t.Run("not an array", func(t *testing.T) {
+		ch := make(chan json.RawMessage, 1)
+		if err := DecodeToChannel(strings.NewReader(`{"a":1}`), ch); err == nil {
+			t.Error("expected error")
+		}
+		if _, ok := <-ch; ok {
+			t.Error("channel was not closed")
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := make(chan json.RawMessage)
+		errc := make(chan error, 1)
+		go func() {
+			errc <- DecodeToChannelContext(ctx, strings.NewReader(`[1,2,3]`), ch)
+		}()
+		if raw := <-ch; string(raw) != "1" {
+			t.Errorf("have: %s, want: 1", raw)
+		}
+		// Nobody receives the second element.
+		cancel()
+		if err := <-errc; err != context.Canceled {
+			t.Errorf("have: %v, want: %v", err, context.Canceled)
+		}
+	})
+}
+
 func TestDecoder(t *testing.T) {
 	for i := 0; i <= len(streamTest); i++ {
 		// Use stream without newlines as input,
@@ -201,6 +612,38 @@ func TestDecoder(t *testing.T) {
 	}
 }
 
+func TestDecoderBufferSize(t *testing.T) {
+	// A value larger than any of the buffer sizes below.
+	long := strings.Repeat("x", 2000)
+	var buf bytes.Buffer
+	buf.WriteString(streamEncoded)
+	buf.WriteString(`"` + long + `"` + "\n")
+	expected := append(append([]interface{}{}, streamTest...), long)
+
+	for _, size := range []int{-1, 0, 1, 7, 512, 1 << 16} {
+		for _, oneByte := range []bool{false, true} {
+			var r io.Reader = bytes.NewReader(buf.Bytes())
+			if oneByte {
+				r = iotest.OneByteReader(r)
+			}
+			dec := DecoderBufferSize(size).NewDecoder(r)
+			out := make([]interface{}, len(expected))
+			for j := range out {
+				if err := dec.Decode(&out[j]); err != nil {
+					t.Fatalf("size %d: decode #%d: %v", size, j, err)
+				}
+			}
+			if !reflect.DeepEqual(out, expected) {
+				t.Errorf("size %d: mismatch\nhave: %v\nwant: %v", size, out, expected)
+			}
+			var x interface{}
+			if err := dec.Decode(&x); err != io.EOF {
+				t.Errorf("size %d: have: %v, want: %v", size, err, io.EOF)
+			}
+		}
+	}
+}
+
 func TestDecoderBuffered(t *testing.T) {
 	r := strings.NewReader(`{"Name": "Gopher"} extra `)
 	var m struct {
@@ -223,6 +666,88 @@ func TestDecoderBuffered(t *testing.T) {
 	}
 }
 
+func TestDecoderTee(t *testing.T) {
+	const input = ` {"a": 1, "b": [true, null]}` + "\n" + `[2, 3]  "x" 4 {"trailing": `
+
+	for _, size := range []int{0, 1, 7} {
+		for _, oneByte := range []bool{false, true} {
+			var r io.Reader = strings.NewReader(input)
+			if oneByte {
+				r = iotest.OneByteReader(r)
+			}
+			dec := DecoderBufferSize(size).NewDecoder(r)
+			var tee bytes.Buffer
+			dec.Tee(&tee)
+			for i := 0; i < 4; i++ {
+				var v interface{}
+				if err := dec.Decode(&v); err != nil {
+					t.Fatalf("size %d: decode #%d: %v", size, i, err)
+				}
+				if have, want := tee.String(), input[:dec.InputOffset()]; have != want {
+					t.Errorf("size %d: decode #%d: have tee: %q, want: %q", size, i, have, want)
+				}
+			}
+			if have, want := tee.String(), ` {"a": 1, "b": [true, null]}`+"\n"+`[2, 3]  "x" 4`; have != want {
+				t.Errorf("size %d: have tee: %q, want: %q", size, have, want)
+			}
+		}
+	}
+
+	t.Run("token", func(t *testing.T) {
+		dec := NewDecoder(strings.NewReader(input))
+		var tee bytes.Buffer
+		dec.Tee(&tee)
+		for i := 0; i < 8; i++ {
+			if _, err := dec.Token(); err != nil {
+				t.Fatalf("token #%d: %v", i, err)
+			}
+			if have, want := tee.String(), input[:dec.InputOffset()]; have != want {
+				t.Errorf("token #%d: have tee: %q, want: %q", i, have, want)
+			}
+		}
+		if have, want := tee.String(), ` {"a": 1, "b": [true, null]`; have != want {
+			t.Errorf("have tee: %q, want: %q", have, want)
+		}
+	})
+
+	t.Run("late", func(t *testing.T) {
+		dec := NewDecoder(strings.NewReader(input))
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		var tee bytes.Buffer
+		dec.Tee(&tee)
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		dec.Tee(nil)
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if have, want := tee.String(), "\n[2, 3]"; have != want {
+			t.Errorf("have tee: %q, want: %q", have, want)
+		}
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		errWrite := errors.New("write failed")
+		dec := NewDecoder(strings.NewReader(input))
+		dec.Tee(failingWriter{errWrite})
+		var v interface{}
+		if err := dec.Decode(&v); err != errWrite {
+			t.Errorf("have: %v, want: %v", err, errWrite)
+		}
+		if _, err := dec.Token(); err != errWrite {
+			t.Errorf("Token: have: %v, want: %v", err, errWrite)
+		}
+	})
+}
+
+type failingWriter struct{ err error }
+
+func (w failingWriter) Write(p []byte) (int, error) { return 0, w.err }
+
 func nlines(s string, n int) string {
 	if n <= 0 {
 		return ""
@@ -237,6 +762,111 @@ func nlines(s string, n int) string {
 	return s
 }
 
+func TestDecodeArray(t *testing.T) {
+	const input = `[{"Foo": "a", "Bar": 1}, {"Foo": "b", "Bar": 2}, {"Foo": "c", "Bar": 3}] "after"`
+
+	t.Run("all", func(t *testing.T) {
+		dec := NewDecoder(strings.NewReader(input))
+		var have []Keys
+		err := dec.DecodeArray(func(decode func(interface{}) error) error {
+			var v Keys
+			if err := decode(&v); err != nil {
+				return err
+			}
+			have = append(have, v)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("DecodeArray: %v", err)
+		}
+		want := []Keys{{Foo: "a", Bar: 1}, {Foo: "b", Bar: 2}, {Foo: "c", Bar: 3}}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", have, want)
+		}
+		var after string
+		if err := dec.Decode(&after); err != nil || after != "after" {
+			t.Errorf("Decode after array: have: %q, %v, want: %q", after, err, "after")
+		}
+	})
+
+	t.Run("stop early", func(t *testing.T) {
+		errStop := errors.New("stop")
+		dec := NewDecoder(strings.NewReader(input))
+		n := 0
+		err := dec.DecodeArray(func(decode func(interface{}) error) error {
+			n++
+			if n == 2 {
+				return errStop
+			}
+			return decode(new(Keys))
+		})
+		if err != errStop {
+			t.Fatalf("DecodeArray: have: %v, want: %v", err, errStop)
+		}
+		// The element that was not decoded and the rest of the array remain.
+		var rest []string
+		err = dec.DecodeArray(func(decode func(interface{}) error) error {
+			var v Keys
+			err := decode(&v)
+			rest = append(rest, v.Foo)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("DecodeArray: %v", err)
+		}
+		if want := []string{"b", "c"}; !reflect.DeepEqual(rest, want) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", rest, want)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		dec := NewDecoder(strings.NewReader(input))
+		n := 0
+		err := dec.DecodeArray(func(decode func(interface{}) error) error {
+			n++
+			return nil
+		})
+		if err != nil || n != 3 {
+			t.Fatalf("DecodeArray: have: %d, %v, want: 3, nil", n, err)
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		dec := UseNumber().NewDecoder(strings.NewReader(`[1, 2.5]`))
+		var have []interface{}
+		err := dec.DecodeArray(func(decode func(interface{}) error) error {
+			var v interface{}
+			err := decode(&v)
+			have = append(have, v)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("DecodeArray: %v", err)
+		}
+		if want := []interface{}{json.Number("1"), json.Number("2.5")}; !reflect.DeepEqual(have, want) {
+			t.Errorf("mismatch\nhave: %#+v\nwant: %#+v", have, want)
+		}
+
+		dec = DisallowUnknownFields().NewDecoder(strings.NewReader(`[{"x": 1}]`))
+		err = dec.DecodeArray(func(decode func(interface{}) error) error {
+			return decode(new(Keys))
+		})
+		if err == nil || err.Error() != `json: unknown field "x"` {
+			t.Errorf("DecodeArray: have: %v, want: unknown field error", err)
+		}
+	})
+
+	t.Run("not an array", func(t *testing.T) {
+		dec := NewDecoder(strings.NewReader(`{"a": 1}`))
+		err := dec.DecodeArray(func(decode func(interface{}) error) error {
+			return nil
+		})
+		if err == nil {
+			t.Fatalf("DecodeArray: expected error")
+		}
+	})
+}
+
 func TestRawMessage(t *testing.T) {
 	var data struct {
 		X  float64
@@ -0,0 +1,120 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var syncMapType = reflect.TypeOf(sync.Map{})
+
+// syncMapEncoder encodes a sync.Map like a map: as a JSON object with sorted keys.
+// Keys must be strings, integers or implement encoding.TextMarshaler.
+func (c *JSON) syncMapEncoder(e *encodeState, v reflect.Value, opts encOpts) {
+	if !v.CanAddr() {
+		// The methods of sync.Map need a pointer, and v is a copy anyway.
+		pv := reflect.New(syncMapType)
+		pv.Elem().Set(v)
+		v = pv.Elem()
+	}
+	m := v.Addr().Interface().(*sync.Map)
+
+	type entry struct {
+		key   reflectWithString
+		value interface{}
+	}
+	var entries []entry
+	m.Range(func(key, value interface{}) bool {
+		kv := reflect.ValueOf(key)
+		if key == nil {
+			e.error(&json.UnsupportedValueError{Value: kv, Str: "nil sync.Map key"})
+		}
+		if !isMapKeyKind(kv) {
+			e.error(&json.UnsupportedTypeError{Type: kv.Type()})
+		}
+		entries = append(entries, entry{reflectWithString{v: kv}, value})
+		return true
+	})
+	if opts.emptyAsNull && len(entries) == 0 {
+		e.WriteString("null")
+		return
+	}
+	for i := range entries {
+		if err := entries[i].key.resolve(); err != nil {
+			e.error(fmt.Errorf("json: encoding error for type %q: %q", entries[i].key.v.Type().String(), err.Error()))
+		}
+	}
+	elemOpts := opts
+	elemOpts.quoted = opts.quoteValues
+	elemOpts.quoteValues = false
+	var encodedKeys []string
+	if opts.sortMapKeys {
+		keys := make([]string, len(entries))
+		for i := range entries {
+			keys[i] = entries[i].key.s
+		}
+		encodedKeys = sortEncodedKeys(e, keys, opts, func(e *encodeState, i int) {
+			c.reflectValue(e, reflect.ValueOf(entries[i].value), elemOpts)
+		}, func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+	} else {
+		sort.Slice(entries, func(i, j int) bool {
+			return mapKeyLess(entries[i].key.s, entries[j].key.s, opts.mapKeyCompare)
+		})
+	}
+
+	e.WriteByte('{')
+	for i, kv := range entries {
+		e.checkpoint()
+		if i > 0 {
+			e.WriteByte(',')
+		}
+		if encodedKeys != nil {
+			e.WriteString(encodedKeys[i])
+		} else {
+			e.string(kv.key.s, opts.escapeHTML)
+		}
+		e.WriteByte(':')
+		ev := reflect.ValueOf(kv.value)
+		if opts.valueHook != nil {
+			opts.valueHook.encode(e, c.valueEncoder(ev), ev, kv.key.s, elemOpts)
+		} else {
+			c.reflectValue(e, ev, elemOpts)
+		}
+	}
+	e.WriteByte('}')
+}
+
+// isMapKeyKind reports whether v can be encoded as an object key.
+func isMapKeyKind(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	_, ok := v.Interface().(encoding.TextMarshaler)
+	return ok
+}
+
+// syncMapObject decodes an object into the sync.Map v, storing its members
+// with string keys. Values are decoded as if they were unmarshaled into
+// an interface{} value.
+func (d *decodeState) syncMapObject(v reflect.Value) {
+	m := v.Addr().Interface().(*sync.Map)
+	if d.replaceDecode {
+		m.Range(func(key, _ interface{}) bool {
+			m.Delete(key)
+			return true
+		})
+	}
+	for key, value := range d.objectInterface() {
+		m.Store(key, value)
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"encoding/json"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func syncMapContents(m *sync.Map) map[interface{}]interface{} {
+	contents := map[interface{}]interface{}{}
+	m.Range(func(key, value interface{}) bool {
+		contents[key] = value
+		return true
+	})
+	return contents
+}
+
+func TestSyncMapRoundTrip(t *testing.T) {
+	var m sync.Map
+	m.Store("b", 2)
+	m.Store("a", 1)
+	m.Store("c", 3)
+
+	b, err := Marshal(&m)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"a":1,"b":2,"c":3}`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	var m2 sync.Map
+	if err := UseNumber().Unmarshal(b, &m2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	expected := map[interface{}]interface{}{"a": json.Number("1"), "b": json.Number("2"), "c": json.Number("3")}
+	if have := syncMapContents(&m2); !reflect.DeepEqual(have, expected) {
+		t.Errorf("have: %v, want: %v", have, expected)
+	}
+
+	b2, err := Marshal(&m2)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b2) != string(b) {
+		t.Errorf("have: %s, want: %s", b2, b)
+	}
+}
+
+func TestSyncMapInStruct(t *testing.T) {
+	type T struct {
+		M sync.Map
+		P *sync.Map
+	}
+	v := &T{P: &sync.Map{}}
+	v.M.Store(2, "two")
+	v.M.Store(10, map[string]int{"x": 1})
+	v.P.Store("k", []int{1})
+
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if expected := `{"M":{"10":{"x":1},"2":"two"},"P":{"k":[1]}}`; string(b) != expected {
+		t.Errorf("have: %s, want: %s", b, expected)
+	}
+
+	var v2 T
+	v2.M.Store("old", true)
+	if err := Unmarshal(b, &v2); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	expected := map[interface{}]interface{}{"old": true, "10": map[string]interface{}{"x": 1.0}, "2": "two"}
+	if have := syncMapContents(&v2.M); !reflect.DeepEqual(have, expected) {
+		t.Errorf("M: have: %v, want: %v", have, expected)
+	}
+	if have := syncMapContents(v2.P); !reflect.DeepEqual(have, map[interface{}]interface{}{"k": []interface{}{1.0}}) {
+		t.Errorf("P: have: %v", have)
+	}
+
+	// ReplaceDecode removes the existing entries.
+	var v3 T
+	v3.M.Store("old", true)
+	if err := ReplaceDecode().Unmarshal(b, &v3); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if _, ok := v3.M.Load("old"); ok {
+		t.Errorf("old entry not removed")
+	}
+}
+
+func TestSyncMapEmpty(t *testing.T) {
+	var m sync.Map
+	b, err := Marshal(&m)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != `{}` {
+		t.Errorf("have: %s, want: {}", b)
+	}
+	b, err = EmptyAsNull().Marshal(&m)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(b) != `null` {
+		t.Errorf("have: %s, want: null", b)
+	}
+}
+
+func TestSyncMapErrors(t *testing.T) {
+	var m sync.Map
+	m.Store(1.5, "x")
+	if _, err := Marshal(&m); err == nil {
+		t.Errorf("expected error for float key")
+	}
+
+	var m2 sync.Map
+	err := Unmarshal([]byte(`[1]`), &m2)
+	if _, ok := err.(*json.UnmarshalTypeError); !ok {
+		t.Errorf("have: %v, want: UnmarshalTypeError", err)
+	}
+}
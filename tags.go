@@ -42,3 +42,22 @@ func (o tagOptions) Contains(optionName string) bool {
 	}
 	return false
 }
+
+// Value returns the value of an option of the form name=value,
+// and whether the option is present.
+// The value cannot contain a comma.
+func (o tagOptions) Value(optionName string) (string, bool) {
+	s := string(o)
+	for s != "" {
+		var next string
+		i := strings.Index(s, ",")
+		if i >= 0 {
+			s, next = s[:i], s[i+1:]
+		}
+		if strings.HasPrefix(s, optionName) && len(s) > len(optionName) && s[len(optionName)] == '=' {
+			return s[len(optionName)+1:], true
+		}
+		s = next
+	}
+	return "", false
+}
@@ -0,0 +1,104 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Validator is the interface implemented by types that check
+// their own invariants after being decoded.
+//
+// Unmarshal calls Validate once a value and all the values nested in it
+// have been decoded, so nested values are validated before the values containing them.
+type Validator interface {
+	Validate() error
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// validatorKind describes how the values of a type are validated.
+type validatorKind uint8
+
+const (
+	notValidator   validatorKind = iota // the type doesn't implement Validator
+	valueValidator                      // the type implements Validator
+	addrValidator                       // only a pointer to the type implements Validator
+)
+
+// validatorCache holds the validatorKind of the types seen by the decoder.
+// Unlike the encoder and field caches, it doesn't depend on the options,
+// so it is shared by all JSON encoders/decoders.
+var validatorCache sync.Map // map[reflect.Type]validatorKind
+
+// cachedValidatorKind returns the validatorKind of t, caching the result.
+func cachedValidatorKind(t reflect.Type) validatorKind {
+	if k, ok := validatorCache.Load(t); ok {
+		return k.(validatorKind)
+	}
+	k := notValidator
+	if t.Implements(validatorType) {
+		k = valueValidator
+	} else if t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(validatorType) {
+		k = addrValidator
+	}
+	validatorCache.Store(t, k)
+	return k
+}
+
+// A ValidationError is returned by Unmarshal when a Validate method returns an error.
+type ValidationError struct {
+	Type   reflect.Type // type of the value that failed validation
+	Struct string       // name of the struct type containing the field
+	Field  string       // the full path from the root struct to the field
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field != "" {
+		return "json: invalid value for Go struct field " + e.Struct + "." + e.Field + " of type " + e.Type.String() + ": " + e.Err.Error()
+	}
+	return "json: invalid value of type " + e.Type.String() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// validate calls the Validate method of v, which has just been decoded,
+// saving the error it returns.
+func (d *decodeState) validate(v reflect.Value) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return
+	}
+	t := v.Type()
+	switch cachedValidatorKind(t) {
+	case notValidator:
+		return
+	case addrValidator:
+		if !v.CanAddr() {
+			return
+		}
+		v = v.Addr()
+	case valueValidator:
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return
+		}
+	}
+	err := v.Interface().(Validator).Validate()
+	if err == nil {
+		return
+	}
+	verr := &ValidationError{Type: t, Err: err}
+	if d.errorContext.Struct != nil {
+		verr.Struct = d.errorContext.Struct.Name()
+		verr.Field = strings.Join(d.errorContext.FieldStack, ".")
+	}
+	d.saveError(verr)
+}
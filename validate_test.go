@@ -0,0 +1,136 @@
+// Copyright 2010 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jsonx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type validPercent int
+
+func (p validPercent) Validate() error {
+	if p < 0 || p > 100 {
+		return fmt.Errorf("%d is out of range", p)
+	}
+	return nil
+}
+
+var errEmptyRange = errors.New("empty range")
+
+type validRange struct {
+	Min   validPercent `json:"min"`
+	Max   validPercent `json:"max"`
+	calls *[]string
+}
+
+func (r *validRange) Validate() error {
+	if r.calls != nil {
+		*r.calls = append(*r.calls, fmt.Sprintf("range %d-%d", r.Min, r.Max))
+	}
+	if r.Min > r.Max {
+		return errEmptyRange
+	}
+	return nil
+}
+
+type validOuter struct {
+	Name   string                `json:"name"`
+	Range  validRange            `json:"range"`
+	Ranges []*validRange         `json:"ranges"`
+	ByName map[string]validRange `json:"by_name"`
+}
+
+func TestValidator(t *testing.T) {
+	tests := []struct {
+		in    string
+		err   string
+		field string
+	}{
+		{in: `{"name":"a","range":{"min":1,"max":2},"ranges":[{"min":0,"max":100},null],"by_name":{"x":{}}}`},
+		{
+			in:    `{"range":{"min":1,"max":101}}`,
+			err:   "json: invalid value for Go struct field validRange.range.max of type jsonx.validPercent: 101 is out of range",
+			field: "range.max",
+		},
+		{
+			in:    `{"range":{"min":2,"max":1}}`,
+			err:   "json: invalid value for Go struct field validOuter.range of type jsonx.validRange: empty range",
+			field: "range",
+		},
+		{
+			in:    `{"ranges":[{"min":-1}]}`,
+			err:   "json: invalid value for Go struct field validRange.ranges.min of type jsonx.validPercent: -1 is out of range",
+			field: "ranges.min",
+		},
+		{
+			in:    `{"by_name":{"x":{"min":5}}}`,
+			err:   "json: invalid value for Go struct field validOuter.by_name of type jsonx.validRange: empty range",
+			field: "by_name",
+		},
+	}
+	for _, tt := range tests {
+		var v validOuter
+		err := Unmarshal([]byte(tt.in), &v)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: Unmarshal: %v", tt.in, err)
+			}
+			continue
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("%s: have: %v (%T), want a *ValidationError", tt.in, err, err)
+			continue
+		}
+		if verr.Error() != tt.err {
+			t.Errorf("%s:\nhave: %s\nwant: %s", tt.in, verr, tt.err)
+		}
+		if verr.Field != tt.field {
+			t.Errorf("%s: have field: %s, want: %s", tt.in, verr.Field, tt.field)
+		}
+	}
+
+	// The error returned by Validate is wrapped.
+	var v validOuter
+	err := Unmarshal([]byte(`{"range":{"min":2,"max":1}}`), &v)
+	if err == nil || !reflect.DeepEqual(err.(*ValidationError).Unwrap(), errEmptyRange) {
+		t.Errorf("have: %v, want it to wrap %v", err, errEmptyRange)
+	}
+
+	// A value at the top level is validated without a field path.
+	var p validPercent
+	err = Unmarshal([]byte(`-5`), &p)
+	if expected := "json: invalid value of type *jsonx.validPercent: -5 is out of range"; err == nil || err.Error() != expected {
+		t.Errorf("have: %v, want: %s", err, expected)
+	}
+}
+
+type validOrder struct {
+	Ranges []*validRange `json:"ranges"`
+	calls  *[]string
+}
+
+func (o validOrder) Validate() error {
+	*o.calls = append(*o.calls, "outer")
+	return nil
+}
+
+func TestValidatorOrder(t *testing.T) {
+	var calls []string
+	v := validOrder{
+		Ranges: []*validRange{{calls: &calls}, {calls: &calls}},
+		calls:  &calls,
+	}
+	if err := Unmarshal([]byte(`{"ranges":[{"min":1,"max":2},{"min":3,"max":4}]}`), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	expected := []string{"range 1-2", "range 3-4", "outer"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("have: %v, want: %v", calls, expected)
+	}
+}